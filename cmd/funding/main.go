@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/funding"
+	"github.com/kprimice/challenge-week/pkg/scanner/sink"
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+func main() {
+	fundingFlag := flag.String("funding", "./data/funding.csv", "Funding updates CSV written by orders-scanner -block-events.")
+	tradesFlag := flag.String("trades", "./data/liquidations.csv", "Trades CSV written by the same scan.")
+	inFlag := flag.String("in", "", "Read a -format=jsonl scan output instead of -funding and -trades (optional).")
+	marketFlag := flag.String("market", "", "Market ID to keep (optional). If empty, keep all markets.")
+	outFlag := flag.String("out", "./data/funding_payments.csv", "Funding payments CSV to write.")
+
+	flag.Parse()
+
+	// 1) Inputs, merged in block order
+	var readers []sink.RecordReader
+	if *inFlag != "" {
+		readers = append(readers, sink.NewJSONLReader(open(*inFlag)))
+	} else {
+		derivative := types.CSVRecord{MarketType: types.MarketDerivative}
+		fundingCSV := derivative
+		fundingCSV.Action = "FUNDING"
+		for _, in := range []struct {
+			path string
+			base types.CSVRecord
+		}{{*fundingFlag, fundingCSV}, {*tradesFlag, derivative}} {
+			r, err := sink.NewCSVReader(open(in.path), in.base)
+			if err != nil {
+				log.Fatalf("failed to read %s: %v", in.path, err)
+			}
+			readers = append(readers, r)
+		}
+	}
+
+	// 2) Replay them through the ledger
+	outFile, err := os.Create(*outFlag)
+	if err != nil {
+		log.Fatalf("failed to create %s: %v", *outFlag, err)
+	}
+	ledger := funding.NewLedger(sink.NewFundingPaymentsCSV(outFile))
+
+	var records int64
+	err = sink.MergeByBlock(readers, func(rec types.CSVRecord) error {
+		if *marketFlag != "" && rec.MarketID != *marketFlag {
+			return nil
+		}
+		records++
+		return sink.Write(ledger, rec)
+	})
+	if cerr := ledger.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Fatalf("Funding ledger error: %v", err)
+	}
+
+	log.Printf("Done! %d records replayed => %d funding payments in %s", records, ledger.Payments, *outFlag)
+}
+
+// open opens an input file, left open until the process exits.
+func open(name string) *os.File {
+	f, err := os.Open(name)
+	if err != nil {
+		log.Fatalf("failed to open %s: %v", name, err)
+	}
+	return f
+}
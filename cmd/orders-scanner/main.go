@@ -1,11 +1,21 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/kprimice/challenge-week/pkg/scanner"
+	"github.com/kprimice/challenge-week/pkg/scanner/position"
+	"github.com/kprimice/challenge-week/pkg/scanner/ratelimit"
+	"github.com/kprimice/challenge-week/pkg/scanner/retry"
+	"github.com/kprimice/challenge-week/pkg/scanner/sink"
+	"github.com/kprimice/challenge-week/pkg/scanner/source"
 	"github.com/kprimice/challenge-week/pkg/scanner/types"
 )
 
@@ -13,32 +23,256 @@ func main() {
 	startFlag := flag.Uint64("start", 96000000, "Block number to start scanning downward from.")
 	endFlag := flag.Uint64("end", 103000000, "Block number to stop at (inclusive).")
 	marketFlag := flag.String("market", "", "Market ID to filter (optional). If empty, fetch all derivative trades for all markets.")
+	marketTypeFlag := flag.String("market-type", "derivative", "Markets to keep: derivative, spot or all.")
+	concurrencyFlag := flag.Int("concurrency", 4, "Number of block chunks fetched in parallel.")
+	chunkBlocksFlag := flag.Uint64("chunk-blocks", 100, "Blocks per chunk (the first chunks' size with -chunk-txs).")
+	chunkTxsFlag := flag.Int("chunk-txs", 0, "Resize chunks to about this many txs each, from the density seen so far (0 = fixed -chunk-blocks). Ignored with -record and -replay.")
+	chunkLatencyFlag := flag.Duration("chunk-latency", 30*time.Second, "With -chunk-txs, also shrink chunks that take longer than this to fetch.")
+	maxChunkFlag := flag.Uint64("max-chunk-blocks", 100000, "With -chunk-txs, never make a chunk larger than this many blocks.")
+	checkpointFlag := flag.String("checkpoint", "./data/orders-scanner.checkpoint.json", "File where scan progress is saved after every chunk.")
+	resumeFlag := flag.Bool("resume", false, "Resume from the checkpoint file, appending to the existing output.")
+	verifyFlag := flag.Bool("verify", false, "Check fetched txs per block against each block's tx count (read with GetBlocks, about one call per 100 blocks).")
+	refetchFlag := flag.Bool("refetch", true, "With -verify, re-fetch incomplete blocks before recording them in the ledger.")
+	ledgerFlag := flag.String("ledger", "./data/failed-chunks.jsonl", "File where chunks that could not be fetched are recorded (see cmd/redrive). Not with -format=parquet or jsonl.")
+	networkFlag := flag.String("network", "mainnet", "Injective network: mainnet, testnet, devnet or local.")
+	explorerFlag := flag.String("explorer-grpc", "", "Explorer gRPC endpoint, e.g. localhost:9911 (default: the network's).")
+	tlsFlag := flag.String("tls", "", "gRPC transport: tls or insecure (default: the network's).")
+	retriesFlag := flag.Int("retries", 5, "Attempts per RPC call before giving up, including the first.")
+	retryElapsedFlag := flag.Duration("retry-max-elapsed", 5*time.Minute, "Give up retrying a call after this long.")
+	attemptTimeoutFlag := flag.Duration("attempt-timeout", 60*time.Second, "Timeout of each RPC attempt.")
+	retryCodesFlag := flag.String("retry-codes", "", "gRPC codes to retry, comma-separated (default: Unavailable,ResourceExhausted,DeadlineExceeded,Aborted).")
+	rpsFlag := flag.Float64("rps", 10, "Max RPC calls per second, shared by all workers (0 = no limit). Halved while the server returns rate-limit errors.")
+	burstFlag := flag.Int("burst", 20, "Calls allowed at once above -rps after an idle period.")
+	sourceFlag := flag.String("source", "explorer", "Where to read txs from: explorer, chain (CometBFT RPC) or dir (recorded responses).")
+	nodeFlag := flag.String("node", "", "CometBFT RPC for -source=chain (default: the network's).")
+	sourceDirFlag := flag.String("source-dir", "", "Directory of recorded responses for -source=dir.")
+	recordFlag := flag.String("record", "", "Save every source response under this directory, for a later -replay.")
+	replayFlag := flag.String("replay", "", "Serve responses recorded with -record from this directory instead of the network (same as -source=dir -source-dir).")
+	blockEventsFlag := flag.Bool("block-events", false, "Also parse BeginBlock/EndBlock events from CometBFT block_results (fills of resting orders).")
+	tmFlag := flag.String("tm-endpoint", "", "CometBFT RPC for -block-events (default: the network's).")
+	archiveFlag := flag.String("archive", "", "Keep the raw txs of every chunk under this directory, for cmd/reparse (optional).")
+	followFlag := flag.Bool("follow", false, "Backfill from -start to the chain head (ignoring -end), then keep tailing new blocks.")
+	formatFlag := flag.String("format", "csv", "Output format: csv, parquet, sqlite or jsonl.")
+	outFlag := flag.String("out", "./data/records.jsonl", "File for -format=jsonl, or - for stdout.")
+	dbFlag := flag.String("db", "./data/scanner.db", "SQLite database for -format=sqlite, created if missing.")
+	rowGroupFlag := flag.Int64("parquet-row-group", 1_000_000, "Rows per parquet row group.")
+	compressionFlag := flag.String("parquet-compression", "zstd", "Parquet compression: zstd, snappy, gzip, lz4 or none.")
+	positionsFlag := flag.String("positions", "", "Also track positions and write a snapshot per changed position and block to this CSV (optional).")
+	positionsReportFlag := flag.String("positions-report", "./data/open_positions.csv", "With -positions, CSV of the positions still open when the scan ends.")
 
 	flag.Parse()
 
-	ordersFile, err := os.Create("./data/orders.csv")
+	if *replayFlag != "" {
+		*sourceFlag, *sourceDirFlag = "dir", *replayFlag
+	}
+	netCfg := source.NetworkConfig{Name: *networkFlag, ExplorerEndpoint: *explorerFlag, TLS: *tlsFlag}
+	network, err := netCfg.Load()
 	if err != nil {
-		log.Fatalf("failed to create orders CSV file: %w", err)
+		log.Fatalf("invalid network: %v", err)
 	}
-	defer ordersFile.Close()
 
-	tradesFile, err := os.Create("./data/liquidations.csv")
+	retryCodes, err := retry.ParseCodes(*retryCodesFlag)
 	if err != nil {
-		log.Fatalf("failed to create trades CSV file: %w", err)
+		log.Fatalf("invalid -retry-codes: %v", err)
+	}
+	policy := retry.Policy{
+		MaxAttempts:    *retriesFlag,
+		MaxElapsed:     *retryElapsedFlag,
+		AttemptTimeout: *attemptTimeoutFlag,
+		Codes:          retryCodes,
+		Limiter:        ratelimit.New(*rpsFlag, *burstFlag),
+	}
+
+	src, err := source.Open(*sourceFlag, network, *nodeFlag, *sourceDirFlag, policy)
+	if err != nil {
+		log.Fatalf("failed to open source: %v", err)
+	}
+	if *recordFlag != "" {
+		if src, err = source.NewRecorder(src, *recordFlag); err != nil {
+			log.Fatalf("failed to open record directory: %v", err)
+		}
+	}
+	// Block events come from the same node when scanning one
+	if *tmFlag == "" && *sourceFlag == "chain" {
+		*tmFlag = *nodeFlag
 	}
-	defer tradesFile.Close()
 
 	cfg := types.Config{
 		StartBlock: *startFlag,
 		EndBlock:   *endFlag,
 		MarketID:   *marketFlag,
+		MarketType: *marketTypeFlag,
+
+		Concurrency:    *concurrencyFlag,
+		ChunkBlocks:    *chunkBlocksFlag,
+		ChunkTxs:       *chunkTxsFlag,
+		ChunkLatency:   *chunkLatencyFlag,
+		MaxChunkBlocks: *maxChunkFlag,
+		CheckpointPath: *checkpointFlag,
+		Resume:         *resumeFlag,
+		LedgerPath:     *ledgerFlag,
+
+		Verify:            *verifyFlag,
+		RefetchMismatched: *refetchFlag,
+
+		Network: netCfg,
+		Source:  src,
+		Retry:   policy,
+
+		BlockEvents: *blockEventsFlag,
+		TmEndpoint:  *tmFlag,
+
+		Follow: *followFlag,
+
+		ArchiveDir: *archiveFlag,
+	}
+
+	// Keep the CSV scan's checkpoint and ledger intact unless a path is given explicitly
+	if *formatFlag != "csv" && !flagSet("checkpoint") {
+		cfg.CheckpointPath = "./data/orders-scanner." + *formatFlag + ".checkpoint.json"
+	}
+	if *formatFlag != "csv" && !flagSet("ledger") {
+		cfg.LedgerPath = "./data/failed-chunks." + *formatFlag + ".jsonl"
+	}
+	// cmd/redrive can only merge into CSVs and upsert into SQLite, so a ledger of
+	// another format would list holes nothing can fill: a failed chunk stops the scan
+	if *formatFlag == "parquet" || *formatFlag == "jsonl" {
+		if flagSet("ledger") {
+			log.Fatalf("-ledger is not supported with -format=%s (cmd/redrive cannot write it)", *formatFlag)
+		}
+		cfg.LedgerPath = ""
+	}
+
+	if err := types.CheckMarketType(*marketTypeFlag); err != nil {
+		log.Fatalf("invalid -market-type: %v", err)
+	}
+	spot := types.KeepMarketType(*marketTypeFlag, types.MarketSpot)
+	derivative := types.KeepMarketType(*marketTypeFlag, types.MarketDerivative)
+
+	var out sink.Sink
+	switch *formatFlag {
+	case "csv":
+		out = openCSV(*resumeFlag, spot, derivative)
+	case "parquet":
+		// Parquet files are only readable once closed, so there is nothing to resume from
+		if *resumeFlag || *followFlag {
+			log.Fatalf("-resume and -follow are not supported with -format=parquet")
+		}
+		cfg.CheckpointPath = ""
+		out = openParquet(sink.ParquetOptions{RowGroupRows: *rowGroupFlag, Compression: *compressionFlag}, spot, derivative)
+	case "sqlite":
+		db, err := sink.NewSQLite(*dbFlag)
+		if err != nil {
+			log.Fatalf("failed to open database: %v", err)
+		}
+		out = db
+	case "jsonl":
+		if *outFlag == "-" {
+			// A pipe cannot be rewound, and stdout carries only records (logs go to stderr)
+			if *resumeFlag {
+				log.Fatalf("-resume is not supported with -out=-")
+			}
+			cfg.CheckpointPath = ""
+			out = sink.NewJSONL(os.Stdout)
+			break
+		}
+		out = sink.NewJSONL(openOutput(*outFlag, *resumeFlag))
+	default:
+		log.Fatalf("unknown -format %q (csv, parquet, sqlite or jsonl)", *formatFlag)
+	}
 
-		// You can add more fields if needed (like concurrency, pageSize, chain network, etc.)
+	// Positions are rebuilt from the first block scanned, so they cannot be resumed
+	var tracker *position.Tracker
+	if *positionsFlag != "" {
+		if *resumeFlag {
+			log.Fatalf("-resume is not supported with -positions (replay the output with cmd/positions instead)")
+		}
+		tracker = position.NewTracker(
+			sink.NewPositionsCSV(openOutput(*positionsFlag, false)),
+			sink.NewPositionsCSV(openOutput(*positionsReportFlag, false)),
+		)
+		out = sink.NewTee(out, tracker)
 	}
 
-	if err := scanner.RunScanner(cfg, ordersFile, tradesFile); err != nil {
+	// Ctrl-C / SIGTERM stop the run cleanly; a second signal kills it as usual
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+
+	err = scanner.RunScanner(ctx, cfg, out)
+	// Close flushes what was written, also when the scan was stopped
+	if cerr := out.Close(); cerr != nil {
+		log.Fatalf("failed to close output: %v", cerr)
+	}
+	if errors.Is(err, context.Canceled) {
+		log.Println("Interrupted.")
+		os.Exit(130)
+	}
+	if err != nil {
 		log.Fatalf("Scanner error: %v", err)
 	}
 
+	if tracker != nil {
+		log.Printf("%d position snapshot(s) in %s, open positions in %s.", tracker.Snapshots, *positionsFlag, *positionsReportFlag)
+	}
 	log.Println("Done!")
 }
+
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// openOutput creates an output file, left open until the process exits.
+func openOutput(name string, resume bool) *os.File {
+	// When resuming, keep the existing file: the scanner trims it back to the checkpoint
+	open := os.Create
+	if resume {
+		open = func(name string) (*os.File, error) {
+			return os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0644)
+		}
+	}
+	f, err := open(name)
+	if err != nil {
+		log.Fatalf("failed to create %s: %v", name, err)
+	}
+	return f
+}
+
+// openCSV creates ./data/orders.csv and ./data/liquidations.csv, plus
+// ./data/spot_orders.csv and ./data/spot_trades.csv with spot, and
+// ./data/conditional_orders.csv and ./data/funding.csv with derivative.
+func openCSV(resume, spot, derivative bool) *sink.CSV {
+	out := sink.NewCSV(openOutput("./data/orders.csv", resume), openOutput("./data/liquidations.csv", resume))
+	if spot {
+		out.WithSpot(openOutput("./data/spot_orders.csv", resume), openOutput("./data/spot_trades.csv", resume))
+	}
+	if derivative {
+		out.WithConditional(openOutput("./data/conditional_orders.csv", resume))
+		out.WithFunding(openOutput("./data/funding.csv", resume))
+	}
+	return out
+}
+
+// openParquet creates ./data/orders.parquet and ./data/trades.parquet, plus
+// ./data/spot_orders.parquet and ./data/spot_trades.parquet with spot, and
+// ./data/conditional_orders.parquet and ./data/funding.parquet with derivative.
+func openParquet(opts sink.ParquetOptions, spot, derivative bool) *sink.Parquet {
+	out, err := sink.NewParquet(openOutput("./data/orders.parquet", false), openOutput("./data/trades.parquet", false), opts)
+	if err != nil {
+		log.Fatalf("invalid parquet options: %v", err)
+	}
+	if spot {
+		out.WithSpot(openOutput("./data/spot_orders.parquet", false), openOutput("./data/spot_trades.parquet", false))
+	}
+	if derivative {
+		out.WithConditional(openOutput("./data/conditional_orders.parquet", false))
+		out.WithFunding(openOutput("./data/funding.parquet", false))
+	}
+	return out
+}
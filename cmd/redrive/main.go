@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/kprimice/challenge-week/pkg/scanner"
+	"github.com/kprimice/challenge-week/pkg/scanner/ratelimit"
+	"github.com/kprimice/challenge-week/pkg/scanner/retry"
+	"github.com/kprimice/challenge-week/pkg/scanner/sink"
+	"github.com/kprimice/challenge-week/pkg/scanner/source"
+)
+
+func main() {
+	ledgerFlag := flag.String("ledger", "./data/failed-chunks.jsonl", "Ledger of failed chunks written by orders-scanner (default for -format=sqlite: ./data/failed-chunks.sqlite.jsonl).")
+	formatFlag := flag.String("format", "csv", "Format of the scan: csv (merge into the CSVs) or sqlite (upsert into -db).")
+	dbFlag := flag.String("db", "./data/scanner.db", "SQLite database of the scan, for -format=sqlite.")
+	ordersFlag := flag.String("orders", "./data/orders.csv", "Orders CSV to merge recovered rows into.")
+	tradesFlag := flag.String("trades", "./data/liquidations.csv", "Trades CSV to merge recovered rows into.")
+	marketTypeFlag := flag.String("market-type", "derivative", "Markets kept by the original scan: derivative, spot or all.")
+	spotOrdersFlag := flag.String("spot-orders", "./data/spot_orders.csv", "Spot orders CSV to merge recovered rows into (with -market-type spot or all).")
+	spotTradesFlag := flag.String("spot-trades", "./data/spot_trades.csv", "Spot trades CSV to merge recovered rows into (with -market-type spot or all).")
+	conditionalFlag := flag.String("conditional-orders", "./data/conditional_orders.csv", "Conditional orders CSV to merge recovered rows into (empty for scans made without one).")
+	fundingFlag := flag.String("funding", "./data/funding.csv", "Funding updates CSV to merge recovered rows into (empty for scans made without one).")
+	checkpointFlag := flag.String("checkpoint", "./data/orders-scanner.checkpoint.json", "Checkpoint of the scan, kept in sync with the merged files (optional).")
+	marketFlag := flag.String("market", "", "Market ID used for the original scan (optional).")
+	verifyFlag := flag.Bool("verify", true, "Check recovered chunks against each block's tx count.")
+	networkFlag := flag.String("network", "mainnet", "Injective network: mainnet, testnet, devnet or local.")
+	explorerFlag := flag.String("explorer-grpc", "", "Explorer gRPC endpoint, e.g. localhost:9911 (default: the network's).")
+	tlsFlag := flag.String("tls", "", "gRPC transport: tls or insecure (default: the network's).")
+	retriesFlag := flag.Int("retries", 5, "Attempts per RPC call before giving up, including the first.")
+	retryElapsedFlag := flag.Duration("retry-max-elapsed", 5*time.Minute, "Give up retrying a call after this long.")
+	attemptTimeoutFlag := flag.Duration("attempt-timeout", 60*time.Second, "Timeout of each RPC attempt.")
+	retryCodesFlag := flag.String("retry-codes", "", "gRPC codes to retry, comma-separated (default: Unavailable,ResourceExhausted,DeadlineExceeded,Aborted).")
+	rpsFlag := flag.Float64("rps", 10, "Max RPC calls per second, shared by all workers (0 = no limit). Halved while the server returns rate-limit errors.")
+	burstFlag := flag.Int("burst", 20, "Calls allowed at once above -rps after an idle period.")
+	sourceFlag := flag.String("source", "explorer", "Where to read txs from: explorer, chain (CometBFT RPC) or dir (recorded responses).")
+	nodeFlag := flag.String("node", "", "CometBFT RPC for -source=chain (default: the network's).")
+	sourceDirFlag := flag.String("source-dir", "", "Directory of recorded responses for -source=dir.")
+	recordFlag := flag.String("record", "", "Save every source response under this directory, for a later -replay.")
+	replayFlag := flag.String("replay", "", "Serve responses recorded with -record from this directory instead of the network (same as -source=dir -source-dir).")
+	archiveFlag := flag.String("archive", "", "Raw tx archive of the scan (its -archive), to add recovered chunks to (optional).")
+	blockEventsFlag := flag.Bool("block-events", false, "Also recover block events (use if the scan ran with -block-events).")
+	tmFlag := flag.String("tm-endpoint", "", "CometBFT RPC for -block-events (default: the network's).")
+
+	flag.Parse()
+
+	if *replayFlag != "" {
+		*sourceFlag, *sourceDirFlag = "dir", *replayFlag
+	}
+	netCfg := source.NetworkConfig{Name: *networkFlag, ExplorerEndpoint: *explorerFlag, TLS: *tlsFlag}
+	network, err := netCfg.Load()
+	if err != nil {
+		log.Fatalf("invalid network: %v", err)
+	}
+
+	retryCodes, err := retry.ParseCodes(*retryCodesFlag)
+	if err != nil {
+		log.Fatalf("invalid -retry-codes: %v", err)
+	}
+	policy := retry.Policy{
+		MaxAttempts:    *retriesFlag,
+		MaxElapsed:     *retryElapsedFlag,
+		AttemptTimeout: *attemptTimeoutFlag,
+		Codes:          retryCodes,
+		Limiter:        ratelimit.New(*rpsFlag, *burstFlag),
+	}
+
+	src, err := source.Open(*sourceFlag, network, *nodeFlag, *sourceDirFlag, policy)
+	if err != nil {
+		log.Fatalf("failed to open source: %v", err)
+	}
+	if *recordFlag != "" {
+		if src, err = source.NewRecorder(src, *recordFlag); err != nil {
+			log.Fatalf("failed to open record directory: %v", err)
+		}
+	}
+	// Block events come from the same node when scanning one
+	if *tmFlag == "" && *sourceFlag == "chain" {
+		*tmFlag = *nodeFlag
+	}
+
+	var out sink.Sink
+	switch *formatFlag {
+	case "csv":
+	case "sqlite":
+		if !flagSet("ledger") {
+			*ledgerFlag = "./data/failed-chunks.sqlite.jsonl"
+		}
+		db, err := sink.NewSQLite(*dbFlag)
+		if err != nil {
+			log.Fatalf("failed to open database: %v", err)
+		}
+		out = db
+	default:
+		// Parquet files cannot be written into once closed, and JSONL is not keyed
+		log.Fatalf("-format %q cannot be re-driven (csv or sqlite)", *formatFlag)
+	}
+
+	cfg := scanner.RedriveConfig{
+		MarketID:       *marketFlag,
+		LedgerPath:     *ledgerFlag,
+		OrdersPath:     *ordersFlag,
+		TradesPath:     *tradesFlag,
+		MarketType:     *marketTypeFlag,
+		SpotOrdersPath: *spotOrdersFlag,
+		SpotTradesPath: *spotTradesFlag,
+
+		ConditionalOrdersPath: *conditionalFlag,
+		FundingPath:           *fundingFlag,
+
+		CheckpointPath: *checkpointFlag,
+		Verify:         *verifyFlag,
+		Network:        netCfg,
+		Source:         src,
+		Retry:          policy,
+
+		BlockEvents: *blockEventsFlag,
+		TmEndpoint:  *tmFlag,
+
+		ArchiveDir: *archiveFlag,
+
+		Out: out,
+	}
+
+	// Ctrl-C / SIGTERM stop the run cleanly; a second signal kills it as usual
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+
+	err = scanner.RunRedrive(ctx, cfg)
+	if out != nil {
+		if cerr := out.Close(); cerr != nil {
+			log.Fatalf("failed to close output: %v", cerr)
+		}
+	}
+	if errors.Is(err, context.Canceled) {
+		log.Println("Interrupted.")
+		os.Exit(130)
+	}
+	if err != nil {
+		log.Fatalf("Redrive error: %v", err)
+	}
+
+	log.Println("Done! Dataset has no recorded holes.")
+}
+
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/kprimice/challenge-week/pkg/scanner"
+	"github.com/kprimice/challenge-week/pkg/scanner/sink"
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+func main() {
+	archiveFlag := flag.String("archive", "./data/archive", "Raw tx archive written by orders-scanner -archive.")
+	startFlag := flag.Uint64("start", 100000000, "First block to re-parse.")
+	endFlag := flag.Uint64("end", 103000000, "Last block to re-parse (inclusive).")
+	marketFlag := flag.String("market", "", "Market ID to filter (optional). If empty, keep all markets.")
+	marketTypeFlag := flag.String("market-type", "derivative", "Markets to keep: derivative, spot or all.")
+	formatFlag := flag.String("format", "csv", "Output format: csv, parquet, sqlite or jsonl.")
+	ordersFlag := flag.String("orders", "./data/orders.csv", "Orders CSV for -format=csv.")
+	tradesFlag := flag.String("trades", "./data/liquidations.csv", "Trades CSV for -format=csv.")
+	spotOrdersFlag := flag.String("spot-orders", "./data/spot_orders.csv", "Spot orders CSV for -format=csv (with -market-type spot or all).")
+	spotTradesFlag := flag.String("spot-trades", "./data/spot_trades.csv", "Spot trades CSV for -format=csv (with -market-type spot or all).")
+	conditionalFlag := flag.String("conditional-orders", "./data/conditional_orders.csv", "Conditional orders CSV for -format=csv (with -market-type derivative or all).")
+	fundingFlag := flag.String("funding", "./data/funding.csv", "Funding updates CSV for -format=csv (with -market-type derivative or all).")
+	outFlag := flag.String("out", "./data/records.jsonl", "File for -format=jsonl, or - for stdout.")
+	dbFlag := flag.String("db", "./data/scanner.db", "SQLite database for -format=sqlite, created if missing.")
+	msgsFlag := flag.String("msgs", "", "Also run the msg parser and write its records (orders as submitted) to this JSONL file (optional).")
+
+	flag.Parse()
+
+	if err := types.CheckMarketType(*marketTypeFlag); err != nil {
+		log.Fatalf("invalid -market-type: %v", err)
+	}
+	spot := types.KeepMarketType(*marketTypeFlag, types.MarketSpot)
+
+	var out sink.Sink
+	switch *formatFlag {
+	case "csv":
+		csvOut := sink.NewCSV(create(*ordersFlag), create(*tradesFlag))
+		if spot {
+			csvOut.WithSpot(create(*spotOrdersFlag), create(*spotTradesFlag))
+		}
+		if types.KeepMarketType(*marketTypeFlag, types.MarketDerivative) {
+			csvOut.WithConditional(create(*conditionalFlag))
+			csvOut.WithFunding(create(*fundingFlag))
+		}
+		out = csvOut
+	case "parquet":
+		if spot {
+			log.Fatalf("-market-type=%s is not supported with -format=parquet (derivative only)", *marketTypeFlag)
+		}
+		parquet, err := sink.NewParquet(create("./data/orders.parquet"), create("./data/trades.parquet"), sink.ParquetOptions{})
+		if err != nil {
+			log.Fatalf("failed to open parquet output: %v", err)
+		}
+		out = parquet
+	case "sqlite":
+		db, err := sink.NewSQLite(*dbFlag)
+		if err != nil {
+			log.Fatalf("failed to open database: %v", err)
+		}
+		out = db
+	case "jsonl":
+		if *outFlag == "-" {
+			out = sink.NewJSONL(os.Stdout)
+			break
+		}
+		out = sink.NewJSONL(create(*outFlag))
+	default:
+		log.Fatalf("unknown -format %q (csv, parquet, sqlite or jsonl)", *formatFlag)
+	}
+
+	cfg := scanner.ReparseConfig{
+		ArchiveDir: *archiveFlag,
+		MarketID:   *marketFlag,
+		MarketType: *marketTypeFlag,
+		StartBlock: *startFlag,
+		EndBlock:   *endFlag,
+	}
+	var msgs sink.Sink
+	if *msgsFlag != "" {
+		msgs = sink.NewJSONL(create(*msgsFlag))
+		cfg.Messages = msgs
+	}
+
+	// Ctrl-C / SIGTERM stop the run cleanly; a second signal kills it as usual
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+
+	err := scanner.RunReparse(ctx, cfg, out)
+	if cerr := out.Close(); cerr != nil {
+		log.Fatalf("failed to close output: %v", cerr)
+	}
+	if msgs != nil {
+		if cerr := msgs.Close(); cerr != nil {
+			log.Fatalf("failed to close %s: %v", *msgsFlag, cerr)
+		}
+	}
+	if errors.Is(err, context.Canceled) {
+		log.Println("Interrupted.")
+		os.Exit(130)
+	}
+	if err != nil {
+		log.Fatalf("Reparse error: %v", err)
+	}
+
+	log.Println("Done!")
+}
+
+// create creates an output file, left open until the process exits.
+func create(name string) *os.File {
+	f, err := os.Create(name)
+	if err != nil {
+		log.Fatalf("failed to create %s: %v", name, err)
+	}
+	return f
+}
@@ -1,21 +1,63 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/kprimice/challenge-week/pkg/scanner"
+	"github.com/kprimice/challenge-week/pkg/scanner/ratelimit"
+	"github.com/kprimice/challenge-week/pkg/scanner/retry"
+	"github.com/kprimice/challenge-week/pkg/scanner/sink"
+	"github.com/kprimice/challenge-week/pkg/scanner/source"
 )
 
 func main() {
 	marketFlag := flag.String("market", "0x4ca0f92fc28be0c9761326016b5a1a2177dd6375558365116b5bdda9abc229ce", "Market ID to filter.")
 	startBlockFlag := flag.Uint64("start", 0, "Start block (optional). If zero, no time-based filtering is applied.")
 	endBlockFlag := flag.Uint64("end", 0, "End block (optional). If zero, no time-based filtering is applied.")
+	networkFlag := flag.String("network", "mainnet", "Injective network: mainnet, testnet, devnet or local.")
+	exchangeFlag := flag.String("exchange-grpc", "", "Exchange gRPC endpoint, e.g. localhost:9910 (default: the network's).")
+	explorerFlag := flag.String("explorer-grpc", "", "Explorer gRPC endpoint, used for block times with -start/-end (default: the network's).")
+	tlsFlag := flag.String("tls", "", "gRPC transport: tls or insecure (default: the network's).")
+	checkpointFlag := flag.String("checkpoint", "./data/derivative_trades.checkpoint.json", "File where the next page offset is saved after every page.")
+	resumeFlag := flag.Bool("resume", false, "Resume from the checkpoint file, appending to the existing CSV.")
+	skipFlag := flag.Uint64("skip", 0, "Offset of the first page to fetch (ignored with -resume).")
+	concurrencyFlag := flag.Int("concurrency", 4, "Number of pages fetched in parallel.")
+	retriesFlag := flag.Int("retries", 5, "Attempts per RPC call before giving up, including the first.")
+	retryElapsedFlag := flag.Duration("retry-max-elapsed", 5*time.Minute, "Give up retrying a call after this long.")
+	attemptTimeoutFlag := flag.Duration("attempt-timeout", 60*time.Second, "Timeout of each RPC attempt.")
+	retryCodesFlag := flag.String("retry-codes", "", "gRPC codes to retry, comma-separated (default: Unavailable,ResourceExhausted,DeadlineExceeded,Aborted).")
+	rpsFlag := flag.Float64("rps", 10, "Max RPC calls per second, shared by all workers (0 = no limit). Halved while the server returns rate-limit errors.")
+	burstFlag := flag.Int("burst", 20, "Calls allowed at once above -rps after an idle period.")
 
 	flag.Parse()
 
-	file, err := os.Create("./data/derivative_trades.csv")
+	retryCodes, err := retry.ParseCodes(*retryCodesFlag)
+	if err != nil {
+		log.Fatalf("invalid -retry-codes: %v", err)
+	}
+	policy := retry.Policy{
+		MaxAttempts:    *retriesFlag,
+		MaxElapsed:     *retryElapsedFlag,
+		AttemptTimeout: *attemptTimeoutFlag,
+		Codes:          retryCodes,
+		Limiter:        ratelimit.New(*rpsFlag, *burstFlag),
+	}
+
+	// When resuming, keep the existing file: it is trimmed back to the checkpoint
+	open := os.Create
+	if *resumeFlag {
+		open = func(name string) (*os.File, error) {
+			return os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0644)
+		}
+	}
+	file, err := open("./data/derivative_trades.csv")
 	if err != nil {
 		log.Fatalf("Failed to create trades CSV file: %v", err)
 	}
@@ -27,10 +69,36 @@ func main() {
 		StartBlock: *startBlockFlag,
 		EndBlock:   *endBlockFlag,
 		PageSize:   100, // default or let user pass a --limit if you want
+		Network: source.NetworkConfig{
+			Name:             *networkFlag,
+			ExplorerEndpoint: *explorerFlag,
+			ExchangeEndpoint: *exchangeFlag,
+			TLS:              *tlsFlag,
+		},
+		Retry: policy,
+
+		Skip:           *skipFlag,
+		CheckpointPath: *checkpointFlag,
+		Resume:         *resumeFlag,
+		Concurrency:    *concurrencyFlag,
 	}
 
-	if err := scanner.RunDerivativeTrades(cfg, file); err != nil {
-		log.Fatalf("RunDerivativeTrades error: %v", err)
+	out := sink.NewDerivativeTradesCSV(file)
+	// Ctrl-C / SIGTERM stop the run cleanly; a second signal kills it as usual
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+
+	err = scanner.RunDerivativeTrades(ctx, cfg, out)
+	if cerr := out.Close(); cerr != nil {
+		log.Fatalf("Failed to close output: %v", cerr)
+	}
+	if errors.Is(err, context.Canceled) {
+		log.Println("Interrupted.")
+		os.Exit(130)
+	}
+	if err != nil {
+		log.Fatalf("RunDerivativeTrades error: %v (rerun with -resume to continue)", err)
 	}
 	log.Println("Done fetching derivative trades!")
 }
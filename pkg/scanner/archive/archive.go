@@ -0,0 +1,155 @@
+// Package archive stores the raw txs a scan fetched, so that new or fixed parsers can
+// be run again over them (see scanner.RunReparse) without downloading anything.
+//
+// Layout: one gzipped JSONL file per scanned chunk, grouped in one directory per
+// PartitionBlocks blocks:
+//
+//	<root>/00100000000-00100099999/00100000000-00100000099.jsonl.gz
+//
+// Files are written atomically. A range that is scanned again (a resumed scan, a
+// re-driven block) simply adds or replaces files; Read drops duplicate txs.
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	explorerPB "github.com/InjectiveLabs/sdk-go/exchange/explorer_rpc/pb"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+// PartitionBlocks is the number of blocks per archive directory.
+const PartitionBlocks = uint64(100_000)
+
+// Tx is one archived tx: the raw fields of the Explorer's TxData that the parsers read.
+type Tx struct {
+	Block     uint64 `json:"block"`
+	BlockTime string `json:"block_time"`
+	Hash      string `json:"hash"`
+	Code      uint32 `json:"code,omitempty"`
+	Codespace string `json:"codespace,omitempty"`
+	ErrorLog  string `json:"error_log,omitempty"`
+	Messages  string `json:"messages,omitempty"`
+	Logs      string `json:"logs,omitempty"`
+
+	// Events is set when the events did not come from Logs: SDK 0.50 txs whose events
+	// were read from the tx detail, and block events (Hash "finalize_block:<height>").
+	Events []types.TxEvent `json:"events,omitempty"`
+}
+
+// FromTxData copies the raw fields of tx.
+func FromTxData(tx *explorerPB.TxData) Tx {
+	return Tx{
+		Block:     tx.BlockNumber,
+		BlockTime: tx.BlockTimestamp,
+		Hash:      tx.Hash,
+		Code:      tx.Code,
+		Codespace: tx.Codespace,
+		ErrorLog:  tx.ErrorLog,
+		Messages:  string(tx.Messages),
+		Logs:      string(tx.Logs),
+	}
+}
+
+// TxData converts t back to the Explorer type the parsers take.
+func (t Tx) TxData() *explorerPB.TxData {
+	return &explorerPB.TxData{
+		BlockNumber:    t.Block,
+		BlockTimestamp: t.BlockTime,
+		Hash:           t.Hash,
+		Code:           t.Code,
+		Codespace:      t.Codespace,
+		ErrorLog:       t.ErrorLog,
+		Messages:       []byte(t.Messages),
+		Logs:           []byte(t.Logs),
+	}
+}
+
+// Writer writes chunks of txs under a root directory.
+type Writer struct {
+	root string
+}
+
+// NewWriter returns a Writer for root, creating it if needed.
+func NewWriter(root string) (*Writer, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &Writer{root: root}, nil
+}
+
+// WriteChunk archives the txs of the block range [low..high], in the order given.
+// A range that spans partitions is split, one file per partition. Empty ranges are
+// written too, so the archive shows what was scanned.
+func (w *Writer) WriteChunk(low, high uint64, txs []Tx) error {
+	for low <= high {
+		partLow, partHigh := partition(low)
+		fileHigh := min(high, partHigh)
+
+		var part []Tx
+		for _, tx := range txs {
+			if tx.Block >= low && tx.Block <= fileHigh {
+				part = append(part, tx)
+			}
+		}
+		dir := filepath.Join(w.root, rangeName(partLow, partHigh))
+		if err := writeFile(dir, rangeName(low, fileHigh)+".jsonl.gz", part); err != nil {
+			return fmt.Errorf("failed to archive blocks %d..%d: %w", low, fileHigh, err)
+		}
+
+		if fileHigh == high {
+			break
+		}
+		low = fileHigh + 1
+	}
+	return nil
+}
+
+// writeFile writes txs to dir/name through a temporary file and a rename.
+func writeFile(dir, name string, txs []Tx) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".archive-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	zw := gzip.NewWriter(tmp)
+	bw := bufio.NewWriter(zw)
+	enc := json.NewEncoder(bw)
+	for _, tx := range txs {
+		if err := enc.Encode(tx); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, name))
+}
+
+// partition returns the block range of the partition holding block.
+func partition(block uint64) (uint64, uint64) {
+	low := block / PartitionBlocks * PartitionBlocks
+	return low, low + PartitionBlocks - 1
+}
+
+func rangeName(low, high uint64) string {
+	return fmt.Sprintf("%011d-%011d", low, high)
+}
@@ -0,0 +1,135 @@
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Read calls fn for every archived tx of the blocks [low..high], in block order and
+// in the order they were scanned within a block. A tx found in several files (an
+// overlapping re-scan) is only passed once, from the first file holding it.
+func Read(root string, low, high uint64, fn func(Tx) error) error {
+	parts, err := listRanges(root, "")
+	if err != nil {
+		return err
+	}
+	for _, p := range parts {
+		if p.high < low || p.low > high {
+			continue
+		}
+		if err := readPartition(filepath.Join(root, p.name), low, high, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readPartition merges the files of one partition. Files are read by ascending
+// first block; txs of blocks below the next file's first block cannot move any more
+// and are passed on, the rest wait for the next file.
+func readPartition(dir string, low, high uint64, fn func(Tx) error) error {
+	files, err := listRanges(dir, ".jsonl.gz")
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	var pending []Tx
+	for i, f := range files {
+		if f.high < low || f.low > high {
+			continue
+		}
+		err := readFile(filepath.Join(dir, f.name), func(tx Tx) {
+			if tx.Block < low || tx.Block > high || seen[tx.Hash] {
+				return
+			}
+			seen[tx.Hash] = true
+			pending = append(pending, tx)
+		})
+		if err != nil {
+			return err
+		}
+
+		until := high + 1
+		if i+1 < len(files) && files[i+1].low < until {
+			until = files[i+1].low
+		}
+		sort.SliceStable(pending, func(a, b int) bool { return pending[a].Block < pending[b].Block })
+		n := 0
+		for n < len(pending) && pending[n].Block < until {
+			if err := fn(pending[n]); err != nil {
+				return err
+			}
+			n++
+		}
+		pending = pending[n:]
+	}
+	for _, tx := range pending {
+		if err := fn(tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readFile(path string, fn func(Tx)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	dec := json.NewDecoder(bufio.NewReader(zr))
+	for dec.More() {
+		var tx Tx
+		if err := dec.Decode(&tx); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		fn(tx)
+	}
+	return nil
+}
+
+type blockRange struct {
+	name      string
+	low, high uint64
+}
+
+// listRanges returns the "<low>-<high><suffix>" entries of dir, sorted by low then high.
+// Anything else (e.g. leftover temporary files) is ignored.
+func listRanges(dir, suffix string) ([]blockRange, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var ranges []blockRange
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasSuffix(name, suffix) || (suffix == "") != e.IsDir() {
+			continue
+		}
+		var r blockRange
+		if _, err := fmt.Sscanf(strings.TrimSuffix(name, suffix), "%d-%d", &r.low, &r.high); err != nil {
+			continue
+		}
+		r.name = name
+		ranges = append(ranges, r)
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		if ranges[i].low != ranges[j].low {
+			return ranges[i].low < ranges[j].low
+		}
+		return ranges[i].high < ranges[j].high
+	})
+	return ranges, nil
+}
@@ -0,0 +1,124 @@
+package archive
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// chunk is one WriteChunk call. Its txs are "block:hash" pairs; Messages records
+// which chunk a tx was read from.
+type chunk struct {
+	low, high uint64
+	txs       []string
+}
+
+func (c chunk) archived(from int) []Tx {
+	var txs []Tx
+	for _, s := range c.txs {
+		var tx Tx
+		if _, err := fmt.Sscanf(s, "%d:%s", &tx.Block, &tx.Hash); err != nil {
+			panic(err)
+		}
+		tx.Messages = fmt.Sprint(from)
+		txs = append(txs, tx)
+	}
+	return txs
+}
+
+func TestRead(t *testing.T) {
+	const p = PartitionBlocks
+	tests := []struct {
+		name      string
+		chunks    []chunk
+		low, high uint64
+		want      []string // "block:hash@chunk"
+	}{
+		{
+			name:   "disjoint chunks",
+			chunks: []chunk{{1, 10, []string{"2:a", "5:b"}}, {11, 20, []string{"11:c"}}},
+			low:    1, high: 20,
+			want: []string{"2:a@0", "5:b@0", "11:c@1"},
+		},
+		{
+			name:   "written out of order",
+			chunks: []chunk{{11, 20, []string{"11:c", "20:d"}}, {1, 10, []string{"2:a"}}},
+			low:    1, high: 20,
+			want: []string{"2:a@1", "11:c@0", "20:d@0"},
+		},
+		{
+			name:   "txs of a chunk out of block order",
+			chunks: []chunk{{1, 10, []string{"9:b", "3:a", "9:c"}}},
+			low:    1, high: 10,
+			want: []string{"3:a@0", "9:b@0", "9:c@0"},
+		},
+		{
+			name: "overlapping re-scan",
+			chunks: []chunk{
+				{1, 10, []string{"2:a", "5:b", "8:c"}},
+				{5, 15, []string{"5:b", "5:x", "8:c", "12:d"}},
+			},
+			low: 1, high: 20,
+			want: []string{"2:a@0", "5:b@0", "5:x@1", "8:c@0", "12:d@1"},
+		},
+		{
+			name: "re-scan inside a chunk",
+			chunks: []chunk{
+				{1, 20, []string{"2:a", "7:b", "15:c"}},
+				{5, 10, []string{"7:b", "7:x"}},
+			},
+			low: 1, high: 20,
+			want: []string{"2:a@0", "7:b@0", "7:x@1", "15:c@0"},
+		},
+		{
+			name: "same range archived again replaces it",
+			chunks: []chunk{
+				{1, 10, []string{"2:a", "5:b"}},
+				{1, 10, []string{"5:b", "2:a"}},
+			},
+			low: 1, high: 10,
+			want: []string{"2:a@1", "5:b@1"},
+		},
+		{
+			name:   "chunk across partitions",
+			chunks: []chunk{{p - 10, p + 10, []string{"99995:a", "100000:b", "100005:c"}}},
+			low:    p - 10, high: p + 10,
+			want: []string{"99995:a@0", "100000:b@0", "100005:c@0"},
+		},
+		{
+			name: "only the blocks asked for",
+			chunks: []chunk{
+				{1, 10, []string{"2:a", "5:b", "8:c"}},
+				{p, p + 10, []string{"100001:d"}},
+			},
+			low: 4, high: 8,
+			want: []string{"5:b@0", "8:c@0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			w, err := NewWriter(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, c := range tt.chunks {
+				if err := w.WriteChunk(c.low, c.high, c.archived(i)); err != nil {
+					t.Fatalf("WriteChunk(%d, %d): %v", c.low, c.high, err)
+				}
+			}
+
+			var got []string
+			err = Read(root, tt.low, tt.high, func(tx Tx) error {
+				got = append(got, fmt.Sprintf("%d:%s@%s", tx.Block, tx.Hash, tx.Messages))
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Read() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	explorerPB "github.com/InjectiveLabs/sdk-go/exchange/explorer_rpc/pb"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/archive"
+	logParser "github.com/kprimice/challenge-week/pkg/scanner/logs"
+	"github.com/kprimice/challenge-week/pkg/scanner/source"
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+// BlockEventsTxHash prefixes the TxHash of records parsed from block events, which
+// belong to no tx: "finalize_block:<height>". It keeps (tx hash, event index) unique.
+const BlockEventsTxHash = "finalize_block:"
+
+// blockResults is the part of CometBFT's /block_results we read. CometBFT 0.38 puts
+// BeginBlock and EndBlock events together in finalize_block_events; older nodes
+// return them separately.
+type blockResults struct {
+	FinalizeBlockEvents []abciEvent `json:"finalize_block_events"`
+	BeginBlockEvents    []abciEvent `json:"begin_block_events"`
+	EndBlockEvents      []abciEvent `json:"end_block_events"`
+}
+
+type abciEvent struct {
+	Type       string                 `json:"type"`
+	Attributes []types.EventAttribute `json:"attributes"`
+}
+
+// fetchBlockEvents reads the block-level events (BeginBlocker / EndBlocker, e.g.
+// batch matching of resting limit orders) of every block in [job.low..job.high] from
+// a CometBFT RPC endpoint, and parses them with the same handlers as tx logs.
+//
+// blockTimes gives the timestamp of blocks that had txs; other blocks are looked up.
+// Each block with exchange events is returned as one stand-in tx (see BlockEventsTxHash).
+// That is one call per block, which is why chunks are capped at maxBlockEventsChunk
+// blocks with block events.
+func fetchBlockEvents(
+	ctx context.Context,
+	job chunkJob,
+	cfg types.Config,
+	blockTimes map[uint64]string,
+) chunkResult {
+	// Same policy as every other call, so the shared limiter paces block_results too
+	rpc := source.NewRPC(cfg.TmEndpoint, cfg.Retry)
+	out := chunkResult{job: job}
+	for height := job.low; height <= job.high; height++ {
+		var res blockResults
+		if err := rpc.Call(ctx, "block_results", source.Height(height), &res); err != nil {
+			out.err = fmt.Errorf("block_results %d: %w", height, err)
+			return out
+		}
+
+		events := append(res.BeginBlockEvents, res.FinalizeBlockEvents...)
+		events = append(events, res.EndBlockEvents...)
+		if !hasExchangeEvent(events) {
+			continue
+		}
+
+		timestamp, ok := blockTimes[height]
+		if !ok {
+			t, err := tmBlockTime(ctx, rpc, height)
+			if err != nil {
+				out.err = fmt.Errorf("header %d: %w", height, err)
+				return out
+			}
+			timestamp = t
+		}
+
+		// A stand-in tx so the handlers can stamp block, time and a unique "hash"
+		tx := &explorerPB.TxData{
+			BlockNumber:    height,
+			BlockTimestamp: timestamp,
+			Hash:           BlockEventsTxHash + strconv.FormatUint(height, 10),
+		}
+		txEvents := blockTxEvents(events)
+		raw := archive.FromTxData(tx)
+		raw.Events = txEvents
+		out.txs = append(out.txs, raw)
+		out.records = append(out.records, logParser.ParseTxEvents(tx, txEvents, cfg.MarketID)...)
+	}
+	return out
+}
+
+func hasExchangeEvent(events []abciEvent) bool {
+	for _, e := range events {
+		if strings.HasPrefix(e.Type, "injective.exchange.v1beta1.") {
+			return true
+		}
+	}
+	return false
+}
+
+// blockTxEvents converts block events, dropping the "mode" attribute CometBFT adds
+// (BeginBlock / EndBlock) so handlers see the same attributes as in tx logs.
+func blockTxEvents(in []abciEvent) []types.TxEvent {
+	events := make([]types.TxEvent, 0, len(in))
+	for _, e := range in {
+		ev := types.TxEvent{MsgIndex: -1, Type: e.Type}
+		for _, a := range e.Attributes {
+			if a.Key == "mode" {
+				continue
+			}
+			ev.Attributes = append(ev.Attributes, a)
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+// tmBlockTime returns the block time of height in the Explorer's format.
+func tmBlockTime(ctx context.Context, rpc *source.RPC, height uint64) (string, error) {
+	var res struct {
+		Header struct {
+			Time time.Time `json:"time"`
+		} `json:"header"`
+	}
+	if err := rpc.Call(ctx, "header", source.Height(height), &res); err != nil {
+		return "", err
+	}
+	return source.FormatBlockTime(res.Header.Time), nil
+}
+
+// addBlockEvents adds block-event records and txs to a chunk's tx records, after the
+// txs of their block (EndBlocker runs once the txs are delivered). Blocks left out by
+// verification are skipped: they are re-driven whole.
+func addBlockEvents(res *chunkResult, blocks chunkResult) {
+	skip := make(map[uint64]bool)
+	for _, m := range res.mismatches {
+		skip[m.Block] = true
+	}
+	added := false
+	for _, rec := range blocks.records {
+		if !skip[rec.Block] {
+			res.records = append(res.records, rec)
+			added = true
+		}
+	}
+	for _, tx := range blocks.txs {
+		if !skip[tx.Block] {
+			res.txs = append(res.txs, tx)
+			added = true
+		}
+	}
+	if added {
+		sortByBlock(res)
+	}
+}
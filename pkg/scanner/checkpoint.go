@@ -0,0 +1,159 @@
+package scanner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/sink"
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+// Checkpoint records how far a RunScanner run got. It is rewritten after every chunk
+// once that chunk's rows are durable in the sink, so it never points past data on disk.
+type Checkpoint struct {
+	MarketID   string `json:"market_id"`
+	StartBlock uint64 `json:"start_block"`
+	EndBlock   uint64 `json:"end_block"`
+
+	// Last fully written chunk (both zero before the first chunk is done)
+	LastChunkLow  uint64 `json:"last_chunk_low"`
+	LastChunkHigh uint64 `json:"last_chunk_high"`
+	// NextBlock is the first block that has not been written yet
+	NextBlock uint64 `json:"next_block"`
+
+	// Offsets is the sink position after the last written chunk
+	// (for CSV output: the size in bytes of "orders" and "trades")
+	Offsets sink.Position `json:"offsets"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// LoadCheckpoint reads a checkpoint file. It returns (nil, nil) if the file does not exist.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint %s: %w", path, err)
+	}
+
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("failed to decode checkpoint %s: %w", path, err)
+	}
+	return &cp, nil
+}
+
+// Save writes the checkpoint atomically: a temp file is synced then renamed over path,
+// so a crash leaves either the previous or the new checkpoint, never a torn one.
+func (cp *Checkpoint) Save(path string) error {
+	cp.UpdatedAt = time.Now().UTC()
+	return saveJSON(path, cp)
+}
+
+// TradesCheckpoint records how far a RunDerivativeTrades run got. It is rewritten
+// after every page once that page is durable in the sink.
+type TradesCheckpoint struct {
+	MarketID   string `json:"market_id"`
+	StartBlock uint64 `json:"start_block"`
+	EndBlock   uint64 `json:"end_block"`
+
+	// Skip is the offset of the first page not written yet
+	Skip uint64 `json:"skip"`
+	// Trades is the number of trades written so far
+	Trades uint64 `json:"trades"`
+
+	// Offsets is the sink position after the last written page
+	Offsets sink.Position `json:"offsets"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// LoadTradesCheckpoint reads a trades checkpoint file. It returns (nil, nil) if the file does not exist.
+func LoadTradesCheckpoint(path string) (*TradesCheckpoint, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint %s: %w", path, err)
+	}
+
+	var cp TradesCheckpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("failed to decode checkpoint %s: %w", path, err)
+	}
+	return &cp, nil
+}
+
+// Save writes the checkpoint atomically, like Checkpoint.Save.
+func (cp *TradesCheckpoint) Save(path string) error {
+	cp.UpdatedAt = time.Now().UTC()
+	return saveJSON(path, cp)
+}
+
+// checkResumable makes sure a checkpoint belongs to the download described by cfg.
+// The time window must be the same, or the skip offset would point elsewhere.
+func (cp *TradesCheckpoint) checkResumable(cfg DerivativeTradesConfig) error {
+	if cp.MarketID != cfg.MarketID {
+		return fmt.Errorf("checkpoint is for market %q, not %q", cp.MarketID, cfg.MarketID)
+	}
+	if cp.StartBlock != cfg.StartBlock || cp.EndBlock != cfg.EndBlock {
+		return fmt.Errorf("checkpoint is for blocks %d..%d, not %d..%d",
+			cp.StartBlock, cp.EndBlock, cfg.StartBlock, cfg.EndBlock)
+	}
+	return nil
+}
+
+// saveJSON writes v as indented JSON to path through a synced temp file.
+func saveJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp checkpoint: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace checkpoint %s: %w", path, err)
+	}
+	return nil
+}
+
+// checkResumable makes sure a checkpoint belongs to the scan described by cfg.
+// The end block may differ so a finished scan can be extended.
+func (cp *Checkpoint) checkResumable(cfg types.Config) error {
+	if cp.MarketID != cfg.MarketID {
+		return fmt.Errorf("checkpoint is for market %q, not %q", cp.MarketID, cfg.MarketID)
+	}
+	if cp.StartBlock != cfg.StartBlock {
+		return fmt.Errorf("checkpoint starts at block %d, not %d", cp.StartBlock, cfg.StartBlock)
+	}
+	return nil
+}
+
+// fileOffset returns the current write offset of f.
+func fileOffset(f *os.File) (int64, error) {
+	return f.Seek(0, io.SeekCurrent)
+}
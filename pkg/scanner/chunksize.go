@@ -0,0 +1,113 @@
+package scanner
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+const (
+	defaultChunkLatency   = 30 * time.Second
+	defaultMaxChunkBlocks = uint64(100_000)
+
+	// maxBlockEventsChunk caps chunks with cfg.BlockEvents, which costs one
+	// block_results call per block of the chunk
+	maxBlockEventsChunk = uint64(1_000)
+)
+
+// chunkSizer picks the number of blocks of the next chunk. With cfg.ChunkTxs unset
+// it always returns cfg.ChunkBlocks; otherwise every finished chunk moves the size
+// towards ChunkTxs txs and at most ChunkLatency per chunk, by at most 2x per step
+// so one odd chunk does not swing it.
+type chunkSizer struct {
+	mu   sync.Mutex
+	size uint64
+
+	adaptive   bool
+	targetTxs  float64
+	maxLatency time.Duration
+	min, max   uint64
+}
+
+func newChunkSizer(cfg types.Config) *chunkSizer {
+	s := &chunkSizer{
+		size:       chunkBlocks(cfg),
+		adaptive:   cfg.ChunkTxs > 0,
+		targetTxs:  float64(cfg.ChunkTxs),
+		maxLatency: cfg.ChunkLatency,
+		min:        cfg.MinChunkBlocks,
+		max:        cfg.MaxChunkBlocks,
+	}
+	if s.maxLatency <= 0 {
+		s.maxLatency = defaultChunkLatency
+	}
+	if s.min < 1 {
+		s.min = 1
+	}
+	if s.max < s.min {
+		s.max = max(defaultMaxChunkBlocks, s.min)
+	}
+	if cfg.BlockEvents {
+		s.max = max(min(s.max, maxBlockEventsChunk), s.min)
+	}
+	s.size = min(max(s.size, s.min), s.max)
+	return s
+}
+
+// chunkBlocks returns the configured (or first) chunk size in blocks, at most
+// maxBlockEventsChunk with block events.
+func chunkBlocks(cfg types.Config) uint64 {
+	size := cfg.ChunkBlocks
+	if size == 0 {
+		size = chunkSize
+	}
+	if cfg.BlockEvents {
+		size = min(size, maxBlockEventsChunk)
+	}
+	return size
+}
+
+// next returns the size of the next chunk.
+func (s *chunkSizer) next() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// observe adjusts the size after a chunk of blocks blocks returned txs txs in elapsed.
+// A failed chunk halves it: smaller chunks mean fewer pages to get through.
+func (s *chunkSizer) observe(blocks uint64, txs int, elapsed time.Duration, failed bool) {
+	if !s.adaptive || blocks == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var want float64
+	switch {
+	case failed:
+		want = float64(s.size) / 2
+	case txs == 0:
+		want = float64(s.size) * 2 // empty range: jump ahead
+	default:
+		// 1) Size for the target tx count at the density just seen
+		want = s.targetTxs * float64(blocks) / float64(txs)
+		// 2) ... unless that chunk was already too slow for its size
+		if elapsed > s.maxLatency {
+			want = min(want, float64(blocks)*float64(s.maxLatency)/float64(elapsed))
+		}
+	}
+
+	// At most double or halve per step, within [min..max]
+	want = min(max(want, float64(s.size)/2), float64(s.size)*2)
+	size := min(max(uint64(want), s.min), s.max)
+	if size != s.size {
+		if size >= 2*s.size || 2*size <= s.size || size == s.min || size == s.max {
+			log.Printf("[Chunks] %d txs in %d blocks (%s) => chunk size %d blocks",
+				txs, blocks, elapsed.Round(time.Millisecond), size)
+		}
+		s.size = size
+	}
+}
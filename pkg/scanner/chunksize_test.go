@@ -0,0 +1,67 @@
+package scanner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+func TestChunkSizerObserve(t *testing.T) {
+	adaptive := types.Config{ChunkBlocks: 100, ChunkTxs: 500, ChunkLatency: 30 * time.Second, MaxChunkBlocks: 1000}
+
+	tests := []struct {
+		name    string
+		cfg     types.Config
+		blocks  uint64
+		txs     int
+		elapsed time.Duration
+		failed  bool
+		want    uint64
+	}{
+		{"fixed size ignores observations", types.Config{ChunkBlocks: 100}, 100, 10_000, time.Second, false, 100},
+		{"sized for the target density", adaptive, 100, 1000, time.Second, false, 50},
+		{"grows at most 2x per step", adaptive, 100, 10, time.Second, false, 200},
+		{"shrinks at most 2x per step", adaptive, 100, 100_000, time.Second, false, 50},
+		{"empty chunk doubles", adaptive, 100, 0, time.Second, false, 200},
+		{"failed chunk halves", adaptive, 100, 500, time.Second, true, 50},
+		{"slow chunk shrinks below the density size", adaptive, 100, 400, 40 * time.Second, false, 75},
+		{"on target stays", adaptive, 100, 500, time.Second, false, 100},
+		{"capped at MaxChunkBlocks", types.Config{ChunkBlocks: 100, ChunkTxs: 500, MaxChunkBlocks: 150}, 100, 0, time.Second, false, 150},
+		{"at least MinChunkBlocks", types.Config{ChunkBlocks: 100, ChunkTxs: 500, MinChunkBlocks: 80}, 100, 100_000, time.Second, false, 80},
+		{"capped with block events", types.Config{ChunkBlocks: 800, ChunkTxs: 500, BlockEvents: true}, 800, 0, time.Second, false, maxBlockEventsChunk},
+		{"empty observation is ignored", adaptive, 0, 0, time.Second, false, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newChunkSizer(tt.cfg)
+			s.observe(tt.blocks, tt.txs, tt.elapsed, tt.failed)
+			if got := s.next(); got != tt.want {
+				t.Errorf("next() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChunkBlocks(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  types.Config
+		want uint64
+	}{
+		{"default", types.Config{}, chunkSize},
+		{"configured", types.Config{ChunkBlocks: 5000}, 5000},
+		{"capped with block events", types.Config{ChunkBlocks: 5000, BlockEvents: true}, maxBlockEventsChunk},
+		{"below the cap with block events", types.Config{ChunkBlocks: 50, BlockEvents: true}, 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chunkBlocks(tt.cfg); got != tt.want {
+				t.Errorf("chunkBlocks() = %d, want %d", got, tt.want)
+			}
+			if got := newChunkSizer(tt.cfg).next(); got != tt.want {
+				t.Errorf("first chunk = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
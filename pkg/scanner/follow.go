@@ -0,0 +1,136 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	explorerPB "github.com/InjectiveLabs/sdk-go/exchange/explorer_rpc/pb"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/retry"
+	"github.com/kprimice/challenge-week/pkg/scanner/source"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+// streamRetryDelay is how long to wait before re-opening a broken tx stream.
+const streamRetryDelay = 5 * time.Second
+
+// headWatcher follows the Explorer tx stream and remembers the highest block seen.
+//
+// Streamed txs have no logs, so they are only used as a signal: once a tx of block
+// B shows up, every block below B is final and can be fetched with GetTxs through
+// the same path as a normal scan. A stream that drops txs or reconnects therefore
+// cannot leave holes, the next signal covers the whole range since the last one.
+type headWatcher struct {
+	latest atomic.Uint64
+	notify chan struct{}
+}
+
+// watchHead opens the tx stream and keeps it open (reconnecting) until ctx is done.
+func watchHead(ctx context.Context, client source.TxSource) *headWatcher {
+	w := &headWatcher{notify: make(chan struct{}, 1)}
+	go w.run(ctx, client)
+	return w
+}
+
+func (w *headWatcher) run(ctx context.Context, client source.TxSource) {
+	for ctx.Err() == nil {
+		stream, err := client.StreamTxs(ctx)
+		if err != nil {
+			log.Printf("StreamTxs error => retrying in %s: %v", streamRetryDelay, err)
+			sleepCtx(ctx, streamRetryDelay)
+			continue
+		}
+
+		for {
+			tx, err := stream.Recv()
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Tx stream broken => reconnecting in %s: %v", streamRetryDelay, err)
+					sleepCtx(ctx, streamRetryDelay)
+				}
+				break
+			}
+			if tx.BlockNumber > w.latest.Load() {
+				w.latest.Store(tx.BlockNumber)
+				// Wake the follow loop without blocking; one pending wake-up is enough
+				select {
+				case w.notify <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}
+}
+
+// chainHead returns the height of the newest block known to the Explorer.
+func chainHead(ctx context.Context, client source.TxSource, policy retry.Policy) (uint64, error) {
+	res, err := GetBlocksWithRetry(ctx, client, &explorerPB.GetBlocksRequest{}, policy)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get latest blocks: %w", err)
+	}
+	var head uint64
+	for _, b := range res.Data {
+		if b.Height > head {
+			head = b.Height
+		}
+	}
+	if head == 0 {
+		return 0, fmt.Errorf("explorer returned no blocks")
+	}
+	return head, nil
+}
+
+// followChain writes every block from next onwards as the stream reports newer
+// blocks, one chunk at a time through emit, until ctx is done or emit fails.
+func followChain(
+	ctx context.Context,
+	client source.TxSource,
+	cfg types.Config,
+	w *headWatcher,
+	next uint64,
+	emit func(chunkResult) error,
+) error {
+	log.Printf("Following the chain from block %d...", next)
+
+	var seq uint64
+	for {
+		select {
+		case <-w.notify:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		// Blocks below the newest streamed one are complete
+		latest := w.latest.Load()
+		if latest == 0 || latest-1 < next {
+			continue
+		}
+		final := latest - 1
+
+		for next <= final {
+			high := next + chunkBlocks(cfg) - 1
+			if high > final {
+				high = final
+			}
+			if err := emit(runChunk(ctx, client, cfg, chunkJob{seq: seq, low: next, high: high})); err != nil {
+				return err
+			}
+			seq++
+			next = high + 1
+		}
+	}
+}
+
+// sleepCtx sleeps for d or until ctx is done.
+func sleepCtx(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
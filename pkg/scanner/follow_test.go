@@ -0,0 +1,82 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	explorerPB "github.com/InjectiveLabs/sdk-go/exchange/explorer_rpc/pb"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/sink"
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+// withOrders makes every tx of s succeed with one new order whose hash is the tx's.
+func withOrders(s *fakeSource) {
+	for _, tx := range s.txs {
+		tx.Code = 0
+		tx.Logs = []byte(fmt.Sprintf(`[{"msg_index":"0","events":[{"type":"injective.exchange.v1beta1.EventNewDerivativeOrders","attributes":[`+
+			`{"key":"market_id","value":"\"0xmarket\""},`+
+			`{"key":"buy_orders","value":"[{\"order_info\":{\"subaccount_id\":\"0xsub\",\"price\":\"1\",\"quantity\":\"1\"},\"order_type\":\"BUY\",\"margin\":\"1\",\"order_hash\":\"%s\"}]"}]}]}]`,
+			tx.Hash))
+	}
+}
+
+// hookSink calls onOrder after each order it keeps.
+type hookSink struct {
+	*sink.Memory
+	onOrder func(rec types.CSVRecord)
+}
+
+func (s hookSink) WriteOrder(rec types.CSVRecord) error {
+	if err := s.Memory.WriteOrder(rec); err != nil {
+		return err
+	}
+	s.onOrder(rec)
+	return nil
+}
+
+func TestFollowHandover(t *testing.T) {
+	// Head 20 is still being indexed when the scan starts: one of its txs only shows
+	// up once block 25 is streamed
+	client := newFakeSource(1, 30, 2)
+	withOrders(client)
+	client.head = 20
+	client.unindexed = map[string]bool{"0x20-1": true}
+	client.stream = make(chan *explorerPB.StreamTxsResponse, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	out := hookSink{Memory: &sink.Memory{}}
+	out.onOrder = func(rec types.CSVRecord) {
+		switch rec.OrderHash {
+		case "0x19-1": // backfill done
+			client.mu.Lock()
+			delete(client.unindexed, "0x20-1")
+			client.mu.Unlock()
+			client.stream <- &explorerPB.StreamTxsResponse{BlockNumber: 25}
+		case "0x24-1": // blocks below 25 written
+			cancel()
+		}
+	}
+
+	cfg := types.Config{StartBlock: 1, ChunkBlocks: 10, Concurrency: 1, Follow: true, Source: client}
+	if err := RunScanner(ctx, cfg, out); !errors.Is(err, context.Canceled) {
+		t.Fatalf("RunScanner = %v, want context.Canceled", err)
+	}
+
+	// Every tx of blocks 1..24 exactly once, in block order
+	var want []string
+	for b := 1; b <= 24; b++ {
+		want = append(want, fmt.Sprintf("0x%d-0", b), fmt.Sprintf("0x%d-1", b))
+	}
+	var got []string
+	for _, rec := range out.Orders {
+		got = append(got, rec.OrderHash)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("orders =\n%v\nwant\n%v", got, want)
+	}
+}
@@ -0,0 +1,89 @@
+package funding
+
+import (
+	"github.com/kprimice/challenge-week/pkg/scanner/position"
+	"github.com/kprimice/challenge-week/pkg/scanner/sink"
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+// Ledger derives funding payments from the records of a scan: it rebuilds positions
+// from EXECUTION records (see position.Book), and at every FUNDING record each open
+// position of the market pays quantity * the change of the cumulative funding, like
+// the chain does (longs pay when it rises, shorts receive).
+//
+// It is a sink.Sink (and sink.FundingSink): feed it records in block order, e.g.
+// with sink.Write. Funding is applied in the BeginBlocker, so within a block the
+// FUNDING records are applied before the block's executions, whatever their order.
+//
+// Payments only cover positions opened after the first record fed to it, and the
+// first FUNDING record of each market only sets its baseline.
+type Ledger struct {
+	out    sink.FundingPaymentSink
+	book   *position.Book
+	blocks *position.BlockBuffer
+
+	Payments int64
+}
+
+// NewLedger returns a Ledger writing payments to out. Closing it closes out.
+func NewLedger(out sink.FundingPaymentSink) *Ledger {
+	l := &Ledger{out: out, book: position.NewBook()}
+	l.blocks = position.NewBlockBuffer(l.applyBlock)
+	return l
+}
+
+func (l *Ledger) WriteOrder(rec types.CSVRecord) error {
+	return nil // orders do not move positions
+}
+
+func (l *Ledger) WriteTrade(rec types.CSVRecord) error {
+	return l.blocks.Add(rec)
+}
+
+func (l *Ledger) WriteFunding(rec types.CSVRecord) error {
+	return l.blocks.Add(rec)
+}
+
+// applyBlock applies the records of one block and writes its payments.
+func (l *Ledger) applyBlock(records []types.CSVRecord) error {
+	payments, err := l.book.ApplyBlock(records)
+	if err != nil {
+		return err
+	}
+	rec := records[0]
+
+	for _, p := range payments {
+		err := l.out.WriteFundingPayment(types.FundingPayment{
+			Block:             rec.Block,
+			BlockTimestamp:    rec.BlockTimestamp,
+			MarketID:          p.MarketID,
+			SubaccountID:      p.SubaccountID,
+			Quantity:          p.Quantity.String(),
+			CumulativeFunding: l.book.CumulativeFunding(p.MarketID).String(),
+			FundingDelta:      p.Delta.String(),
+			Payment:           p.Amount.String(),
+		})
+		if err != nil {
+			return err
+		}
+		l.Payments++
+	}
+	return nil
+}
+
+// Flush applies the current block and flushes the payments. Only call it at a block
+// boundary, e.g. when the input is exhausted.
+func (l *Ledger) Flush() error {
+	if err := l.blocks.Flush(); err != nil {
+		return err
+	}
+	return l.out.Flush()
+}
+
+func (l *Ledger) Close() error {
+	if err := l.Flush(); err != nil {
+		l.out.Close()
+		return err
+	}
+	return l.out.Close()
+}
@@ -0,0 +1,163 @@
+package funding
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/sink"
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+const (
+	btc = "0xbtc"
+	eth = "0xeth"
+)
+
+func fill(block uint64, marketID, subaccountID string, isBuy bool, qty string) types.CSVRecord {
+	return types.CSVRecord{
+		Block:        block,
+		Action:       "EXECUTION",
+		MarketType:   types.MarketDerivative,
+		MarketID:     marketID,
+		SubaccountID: subaccountID,
+		IsBuy:        isBuy,
+		ExecQuantity: qty,
+		ExecPrice:    "100",
+		ExecMargin:   "10",
+	}
+}
+
+func funding(block uint64, marketID, cumulative string) types.CSVRecord {
+	return types.CSVRecord{
+		Block:             block,
+		Action:            "FUNDING",
+		MarketType:        types.MarketDerivative,
+		MarketID:          marketID,
+		CumulativeFunding: cumulative,
+	}
+}
+
+// payment is a FundingPayment with the decimals the ledger writes.
+func payment(block uint64, marketID, subaccountID, qty, cumulative, delta, amount string) types.FundingPayment {
+	return types.FundingPayment{
+		Block:             block,
+		MarketID:          marketID,
+		SubaccountID:      subaccountID,
+		Quantity:          qty + ".000000000000000000",
+		CumulativeFunding: cumulative + ".000000000000000000",
+		FundingDelta:      delta + ".000000000000000000",
+		Payment:           amount + ".000000000000000000",
+	}
+}
+
+func TestLedger(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []types.CSVRecord
+		want    []types.FundingPayment
+		wantErr bool
+	}{
+		{
+			name: "first update only sets the baseline",
+			records: []types.CSVRecord{
+				fill(1, btc, "0xa", true, "2"),
+				funding(2, btc, "5"),
+			},
+		},
+		{
+			name: "long pays a rising cumulative funding",
+			records: []types.CSVRecord{
+				funding(1, btc, "5"),
+				fill(1, btc, "0xa", true, "2"),
+				funding(2, btc, "8"),
+			},
+			want: []types.FundingPayment{payment(2, btc, "0xa", "2", "8", "3", "-6")},
+		},
+		{
+			name: "short receives it",
+			records: []types.CSVRecord{
+				funding(1, btc, "5"),
+				fill(1, btc, "0xb", false, "3"),
+				funding(2, btc, "8"),
+			},
+			want: []types.FundingPayment{payment(2, btc, "0xb", "-3", "8", "3", "9")},
+		},
+		{
+			name: "funding applies before the executions of its block",
+			records: []types.CSVRecord{
+				funding(1, btc, "5"),
+				fill(1, btc, "0xa", true, "2"),
+				fill(2, btc, "0xa", true, "2"),
+				funding(2, btc, "8"),
+			},
+			want: []types.FundingPayment{payment(2, btc, "0xa", "2", "8", "3", "-6")},
+		},
+		{
+			name: "no change, no payment",
+			records: []types.CSVRecord{
+				funding(1, btc, "5"),
+				fill(1, btc, "0xa", true, "2"),
+				funding(2, btc, "5"),
+			},
+		},
+		{
+			name: "closed positions do not pay",
+			records: []types.CSVRecord{
+				funding(1, btc, "5"),
+				fill(1, btc, "0xa", true, "2"),
+				fill(2, btc, "0xa", false, "2"),
+				funding(3, btc, "8"),
+			},
+		},
+		{
+			name: "markets are funded separately",
+			records: []types.CSVRecord{
+				funding(1, btc, "5"),
+				funding(1, eth, "1"),
+				fill(1, btc, "0xa", true, "2"),
+				fill(1, eth, "0xa", false, "4"),
+				funding(2, eth, "0"),
+				funding(3, btc, "6"),
+			},
+			want: []types.FundingPayment{
+				payment(2, eth, "0xa", "-4", "0", "-1", "-4"),
+				payment(3, btc, "0xa", "2", "6", "1", "-2"),
+			},
+		},
+		{
+			name: "bad cumulative funding",
+			records: []types.CSVRecord{
+				funding(1, btc, "5"),
+				funding(2, btc, "oops"),
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &sink.Memory{}
+			ledger := NewLedger(out)
+			var err error
+			for _, rec := range tt.records {
+				if err = sink.Write(ledger, rec); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				err = ledger.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(out.FundingPayments, tt.want) {
+				t.Errorf("payments = %+v\nwant %+v", out.FundingPayments, tt.want)
+			}
+			if ledger.Payments != int64(len(tt.want)) {
+				t.Errorf("Payments = %d, want %d", ledger.Payments, len(tt.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package scanner
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FailedChunk is one block range that could not be fully fetched.
+// Its rows are left out of the CSVs (unless Kept); RunRedrive fetches them again
+// later and replaces whatever the CSVs have in the range.
+type FailedChunk struct {
+	Low  uint64 `json:"low"`
+	High uint64 `json:"high"`
+
+	// Partial is true when some pages came back before the error
+	Partial bool `json:"partial"`
+	// Kept is true when the rows fetched were written anyway: the pages were
+	// stable but fewer distinct txs than ExpectedTxs came back
+	Kept         bool `json:"kept,omitempty"`
+	PagesFetched int  `json:"pages_fetched"`
+	TxsFetched   int  `json:"txs_fetched"`
+
+	// ExpectedTxs is set when the range failed completeness verification, or
+	// with Kept to the tx count the source reported
+	ExpectedTxs int `json:"expected_txs,omitempty"`
+
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// Ledger is an append-only JSONL file of FailedChunks.
+type Ledger struct {
+	mu   sync.Mutex
+	path string
+}
+
+// OpenLedger returns a ledger writing to path. The file is created on the first Record.
+func OpenLedger(path string) *Ledger {
+	return &Ledger{path: path}
+}
+
+// Record appends fc to the ledger and syncs it, so a recorded failure survives a crash.
+func (l *Ledger) Record(fc FailedChunk) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	line, err := json.Marshal(fc)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open ledger %s: %w", l.path, err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to append to ledger %s: %w", l.path, err)
+	}
+	return f.Sync()
+}
+
+// LoadLedger reads every entry of a ledger file, sorted by block.
+// A missing file is an empty ledger.
+func LoadLedger(path string) ([]FailedChunk, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ledger %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var entries []FailedChunk
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var fc FailedChunk
+		if err := json.Unmarshal(sc.Bytes(), &fc); err != nil {
+			return nil, fmt.Errorf("ledger %s line %d: %w", path, line, err)
+		}
+		entries = append(entries, fc)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Low < entries[j].Low })
+	return entries, nil
+}
+
+// TrimLedger keeps only the entries of the ledger at path below block from: the
+// others belong to blocks a scan is about to fetch again (from 0 empties it).
+func TrimLedger(path string, from uint64) error {
+	entries, err := LoadLedger(path)
+	if err != nil {
+		return err
+	}
+	kept := entries[:0]
+	for _, fc := range entries {
+		if fc.Low < from {
+			kept = append(kept, fc)
+		}
+	}
+	if dropped := len(entries) - len(kept); dropped > 0 {
+		log.Printf("Dropped %d ledger entries from block %d on, they are scanned again.", dropped, from)
+	}
+	return RewriteLedger(path, kept)
+}
+
+// RewriteLedger atomically replaces the ledger with entries (removing it if there are none).
+func RewriteLedger(path string, entries []FailedChunk) error {
+	if len(entries) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, fc := range entries {
+		if err := enc.Encode(fc); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,137 @@
+package logs
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	explorerPB "github.com/InjectiveLabs/sdk-go/exchange/explorer_rpc/pb"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+// Conditional (stop / take-profit) orders wait off the book until the mark price
+// crosses their trigger price. The trigger usually happens in the EndBlocker, so
+// CONDITIONAL_TRIGGER records mostly come from block events (Config.BlockEvents).
+// Hashes are base64, like the order hashes of every other event.
+
+func handleEventNewConditionalOrder(tx *explorerPB.TxData, attrs []types.EventAttribute, filterMarketID string) []types.CSVRecord {
+	var records []types.CSVRecord
+	marketID := attrMarketID(attrs)
+	if filterMarketID != "" && filterMarketID != marketID {
+		return records // empty
+	}
+
+	var lo types.LimitOrder
+	var hash string
+	var isMarket, found bool
+	for _, attr := range attrs {
+		switch attr.Key {
+		case "order":
+			found = json.Unmarshal([]byte(attr.Value), &lo) == nil
+		case "hash":
+			hash = strings.Trim(attr.Value, `"`)
+		case "is_market":
+			isMarket = (attr.Value == "true")
+		}
+	}
+	if !found {
+		return records
+	}
+
+	lo.OrderHash = hash
+	return append(records, conditionalRecord(tx, "CONDITIONAL_NEW", marketID, lo, isMarket))
+}
+
+func handleEventCancelConditionalOrder(tx *explorerPB.TxData, attrs []types.EventAttribute, filterMarketID string) []types.CSVRecord {
+	var records []types.CSVRecord
+	marketID := attrMarketID(attrs)
+	if filterMarketID != "" && filterMarketID != marketID {
+		return records // empty
+	}
+
+	// Only one of limit_order / market_order is set, the other is null
+	for _, attr := range attrs {
+		if attr.Key != "limit_order" && attr.Key != "market_order" {
+			continue
+		}
+		var lo *types.LimitOrder
+		if err := json.Unmarshal([]byte(attr.Value), &lo); err != nil || lo == nil {
+			continue
+		}
+		isMarket := attr.Key == "market_order"
+		records = append(records, conditionalRecord(tx, "CONDITIONAL_CANCEL", marketID, *lo, isMarket))
+	}
+	return records
+}
+
+func handleEventConditionalOrderTrigger(tx *explorerPB.TxData, attrs []types.EventAttribute, filterMarketID string) []types.CSVRecord {
+	var records []types.CSVRecord
+
+	rec := types.CSVRecord{
+		TxHash:         tx.Hash,
+		Block:          tx.BlockNumber,
+		BlockTimestamp: tx.BlockTimestamp,
+		Action:         "CONDITIONAL_TRIGGER",
+		MarketType:     types.MarketDerivative,
+		IsMarket:       true,
+	}
+	for _, attr := range attrs {
+		value := strings.Trim(attr.Value, `"`)
+		switch attr.Key {
+		case "market_id":
+			// Bytes here, unlike the hex string of the other events
+			rec.MarketID = bytesToHex(value)
+		case "isLimitTrigger":
+			rec.IsMarket = (value != "true")
+		case "triggered_order_hash":
+			rec.OrderHash = value
+		case "placed_order_hash":
+			rec.PlacedOrderHash = value
+		case "triggered_order_cid":
+			rec.Cid = value
+		}
+	}
+
+	if filterMarketID != "" && filterMarketID != rec.MarketID {
+		return records // empty
+	}
+	return append(records, rec)
+}
+
+func conditionalRecord(tx *explorerPB.TxData, action, marketID string, lo types.LimitOrder, isMarket bool) types.CSVRecord {
+	if lo.MarketId == "" {
+		lo.MarketId = marketID
+	}
+	return types.CSVRecord{
+		TxHash:         tx.Hash,
+		Block:          tx.BlockNumber,
+		BlockTimestamp: tx.BlockTimestamp,
+		Action:         action,
+		MarketID:       lo.MarketId,
+		MarketType:     types.MarketDerivative,
+		Price:          lo.OrderInfo.Price,
+		Quantity:       lo.OrderInfo.Quantity,
+		OrderType:      lo.OrderType,
+		SubaccountID:   lo.OrderInfo.SubaccountID,
+		Margin:         lo.Margin,
+		OrderHash:      lo.OrderHash,
+		Cid:            lo.OrderInfo.Cid,
+		TriggerPrice:   lo.TriggerPrice,
+		IsMarket:       isMarket,
+	}
+}
+
+// bytesToHex turns a base64 bytes attribute into a 0x-prefixed hex string, or
+// returns it unchanged if it is already hex or not base64.
+func bytesToHex(value string) string {
+	if strings.HasPrefix(value, "0x") {
+		return value
+	}
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return value
+	}
+	return "0x" + hex.EncodeToString(raw)
+}
@@ -0,0 +1,178 @@
+package logs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	explorerPB "github.com/InjectiveLabs/sdk-go/exchange/explorer_rpc/pb"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+var testTx = &explorerPB.TxData{Hash: "0xtx", BlockNumber: 100, BlockTimestamp: "2025-01-01 00:00:00 +0000 UTC"}
+
+// The BTC/USDT perpetual, as hex and as the base64 bytes of trigger events
+const (
+	btcPerp    = "0x4ca0f92fc28be0c9761326016b5a1a2177dd6375558365116b5bdda9abc229ce"
+	btcPerpB64 = "TKD5L8KL4Ml2EyYBa1oaIXfdY3VVg2URa1vdqavCKc4="
+	ethPerp    = "0x54d4505adef6a5cef26bc403a33d595620ded4e15b9e2bc3dd489b714813366a"
+)
+
+// parseEvents parses events (JSON, as in a tx's logs) as one message of testTx.
+// Indexes are cleared: they are covered by the ParseEvents tests.
+func parseEvents(marketID string, events ...string) []types.CSVRecord {
+	logs := `[{"msg_index":"0","events":[` + strings.Join(events, ",") + `]}]`
+	records := ParseTxEvents(testTx, ParseEvents([]byte(logs)), marketID)
+	for i := range records {
+		records[i].MsgIndex, records[i].EventIndex, records[i].ItemIndex = 0, 0, 0
+	}
+	return records
+}
+
+// txRecord is a record of testTx.
+func txRecord(rec types.CSVRecord) types.CSVRecord {
+	rec.TxHash, rec.Block, rec.BlockTimestamp = testTx.Hash, testTx.BlockNumber, testTx.BlockTimestamp
+	return rec
+}
+
+func TestConditionalEvents(t *testing.T) {
+	const (
+		newStop = `{"type":"injective.exchange.v1beta1.EventNewConditionalDerivativeOrder","attributes":[
+			{"key":"market_id","value":"\"` + btcPerp + `\""},
+			{"key":"order","value":"{\"market_id\":\"` + btcPerp + `\",\"order_info\":{\"subaccount_id\":\"0xsub\",\"fee_recipient\":\"inj1fee\",\"price\":\"95000.000000000000000000\",\"quantity\":\"0.010000000000000000\",\"cid\":\"stop-1\"},\"order_type\":\"STOP_SELL\",\"margin\":\"0.000000000000000000\",\"trigger_price\":\"96000.000000000000000000\"}"},
+			{"key":"hash","value":"\"0xstop\""},
+			{"key":"is_market","value":"true"}]}`
+		newTake = `{"type":"injective.exchange.v1beta1.EventNewConditionalDerivativeOrder","attributes":[
+			{"key":"market_id","value":"\"` + btcPerp + `\""},
+			{"key":"order","value":"{\"market_id\":\"` + btcPerp + `\",\"order_info\":{\"subaccount_id\":\"0xsub\",\"price\":\"110000.000000000000000000\",\"quantity\":\"0.010000000000000000\"},\"order_type\":\"TAKE_SELL\",\"margin\":\"1100.000000000000000000\",\"trigger_price\":\"109000.000000000000000000\"}"},
+			{"key":"hash","value":"\"0xtake\""},
+			{"key":"is_market","value":"false"}]}`
+		cancelLimit = `{"type":"injective.exchange.v1beta1.EventCancelConditionalDerivativeOrder","attributes":[
+			{"key":"market_id","value":"\"` + btcPerp + `\""},
+			{"key":"isLimitCancel","value":"true"},
+			{"key":"limit_order","value":"{\"order_info\":{\"subaccount_id\":\"0xsub\",\"price\":\"110000.000000000000000000\",\"quantity\":\"0.010000000000000000\"},\"order_type\":\"TAKE_SELL\",\"margin\":\"1100.000000000000000000\",\"trigger_price\":\"109000.000000000000000000\",\"order_hash\":\"0xtake\"}"},
+			{"key":"market_order","value":"null"}]}`
+		cancelMarket = `{"type":"injective.exchange.v1beta1.EventCancelConditionalDerivativeOrder","attributes":[
+			{"key":"market_id","value":"\"` + btcPerp + `\""},
+			{"key":"isLimitCancel","value":"false"},
+			{"key":"limit_order","value":"null"},
+			{"key":"market_order","value":"{\"order_info\":{\"subaccount_id\":\"0xsub\",\"price\":\"95000.000000000000000000\",\"quantity\":\"0.010000000000000000\"},\"order_type\":\"STOP_SELL\",\"margin\":\"0.000000000000000000\",\"trigger_price\":\"96000.000000000000000000\",\"order_hash\":\"0xstop\"}"}]}`
+		trigger = `{"type":"injective.exchange.v1beta1.EventConditionalDerivativeOrderTrigger","attributes":[
+			{"key":"market_id","value":"\"` + btcPerpB64 + `\""},
+			{"key":"isLimitTrigger","value":"false"},
+			{"key":"triggered_order_hash","value":"\"0xstop\""},
+			{"key":"placed_order_hash","value":"\"0xplaced\""},
+			{"key":"triggered_order_cid","value":"\"stop-1\""}]}`
+		// The market order placed by the trigger, in the same EndBlocker
+		placed = `{"type":"injective.exchange.v1beta1.EventNewDerivativeOrders","attributes":[
+			{"key":"market_id","value":"\"` + btcPerp + `\""},
+			{"key":"buy_orders","value":"[]"},
+			{"key":"sell_orders","value":"[{\"order_info\":{\"subaccount_id\":\"0xsub\",\"price\":\"95000.000000000000000000\",\"quantity\":\"0.010000000000000000\",\"cid\":\"stop-1\"},\"order_type\":\"SELL\",\"margin\":\"0.000000000000000000\",\"order_hash\":\"0xplaced\"}]"}]}`
+	)
+
+	tests := []struct {
+		name     string
+		marketID string
+		events   []string
+		want     []types.CSVRecord
+	}{
+		{
+			name:   "new stop market order",
+			events: []string{newStop},
+			want: []types.CSVRecord{{
+				Action: "CONDITIONAL_NEW", MarketID: btcPerp, MarketType: types.MarketDerivative,
+				OrderHash: "0xstop", SubaccountID: "0xsub", Cid: "stop-1", OrderType: "STOP_SELL",
+				Price: "95000.000000000000000000", Quantity: "0.010000000000000000", Margin: "0.000000000000000000",
+				TriggerPrice: "96000.000000000000000000", IsMarket: true,
+			}},
+		},
+		{
+			name:   "new take-profit limit order",
+			events: []string{newTake},
+			want: []types.CSVRecord{{
+				Action: "CONDITIONAL_NEW", MarketID: btcPerp, MarketType: types.MarketDerivative,
+				OrderHash: "0xtake", SubaccountID: "0xsub", OrderType: "TAKE_SELL",
+				Price: "110000.000000000000000000", Quantity: "0.010000000000000000", Margin: "1100.000000000000000000",
+				TriggerPrice: "109000.000000000000000000",
+			}},
+		},
+		{
+			name:   "cancel of a limit order",
+			events: []string{cancelLimit},
+			want: []types.CSVRecord{{
+				Action: "CONDITIONAL_CANCEL", MarketID: btcPerp, MarketType: types.MarketDerivative,
+				OrderHash: "0xtake", SubaccountID: "0xsub", OrderType: "TAKE_SELL",
+				Price: "110000.000000000000000000", Quantity: "0.010000000000000000", Margin: "1100.000000000000000000",
+				TriggerPrice: "109000.000000000000000000",
+			}},
+		},
+		{
+			name:   "cancel of a market order",
+			events: []string{cancelMarket},
+			want: []types.CSVRecord{{
+				Action: "CONDITIONAL_CANCEL", MarketID: btcPerp, MarketType: types.MarketDerivative,
+				OrderHash: "0xstop", SubaccountID: "0xsub", OrderType: "STOP_SELL",
+				Price: "95000.000000000000000000", Quantity: "0.010000000000000000", Margin: "0.000000000000000000",
+				TriggerPrice: "96000.000000000000000000", IsMarket: true,
+			}},
+		},
+		{
+			name:   "trigger market id from base64",
+			events: []string{trigger},
+			want: []types.CSVRecord{{
+				Action: "CONDITIONAL_TRIGGER", MarketID: btcPerp, MarketType: types.MarketDerivative,
+				OrderHash: "0xstop", PlacedOrderHash: "0xplaced", Cid: "stop-1", IsMarket: true,
+			}},
+		},
+		{
+			name:   "limit trigger with a hex market id",
+			events: []string{strings.NewReplacer(btcPerpB64, btcPerp, `"isLimitTrigger","value":"false"`, `"isLimitTrigger","value":"true"`).Replace(trigger)},
+			want: []types.CSVRecord{{
+				Action: "CONDITIONAL_TRIGGER", MarketID: btcPerp, MarketType: types.MarketDerivative,
+				OrderHash: "0xstop", PlacedOrderHash: "0xplaced", Cid: "stop-1",
+			}},
+		},
+		{
+			name:     "trigger kept by a hex market filter",
+			marketID: btcPerp,
+			events:   []string{trigger},
+			want: []types.CSVRecord{{
+				Action: "CONDITIONAL_TRIGGER", MarketID: btcPerp, MarketType: types.MarketDerivative,
+				OrderHash: "0xstop", PlacedOrderHash: "0xplaced", Cid: "stop-1", IsMarket: true,
+			}},
+		},
+		{
+			name:     "other market filtered out",
+			marketID: ethPerp,
+			events:   []string{newStop, cancelLimit, trigger},
+		},
+		{
+			name:   "trigger links to the order it placed",
+			events: []string{trigger, placed},
+			want: []types.CSVRecord{
+				{
+					Action: "CONDITIONAL_TRIGGER", MarketID: btcPerp, MarketType: types.MarketDerivative,
+					OrderHash: "0xstop", PlacedOrderHash: "0xplaced", Cid: "stop-1", IsMarket: true,
+				},
+				{
+					Action: "EVENT_NEW", MarketID: btcPerp, MarketType: types.MarketDerivative,
+					OrderHash: "0xplaced", SubaccountID: "0xsub", Cid: "stop-1", OrderType: "SELL",
+					Price: "95000.000000000000000000", Quantity: "0.010000000000000000", Margin: "0.000000000000000000",
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseEvents(tt.marketID, tt.events...)
+			var want []types.CSVRecord
+			for _, rec := range tt.want {
+				want = append(want, txRecord(rec))
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got  %+v\nwant %+v", got, want)
+			}
+		})
+	}
+}
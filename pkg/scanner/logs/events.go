@@ -0,0 +1,86 @@
+package logs
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	explorerPB "github.com/InjectiveLabs/sdk-go/exchange/explorer_rpc/pb"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+// msgIndexKey is the attribute SDK 0.50 adds to events emitted by a message.
+const msgIndexKey = "msg_index"
+
+// ParseEvents reads the events from a tx's Logs JSON. Before SDK 0.50 it is a list of
+// per-message logs, each with its events. From 0.50 on those logs are empty; when the
+// Explorer fills the field at all, it is the tx's flat event list, where events carry
+// a msg_index attribute. Returns nil when neither has any event.
+func ParseEvents(raw []byte) []types.TxEvent {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	// 1) Per-message logs
+	var logs []types.TxLog
+	if err := json.Unmarshal(raw, &logs); err == nil {
+		var events []types.TxEvent
+		for _, l := range logs {
+			for _, e := range l.Events {
+				events = append(events, types.TxEvent{MsgIndex: l.MsgIndex, Type: e.Type, Attributes: e.Attributes})
+			}
+		}
+		if len(events) > 0 {
+			return events
+		}
+	}
+
+	// 2) Flat event list
+	var flat []struct {
+		Type       string                 `json:"type"`
+		Attributes []types.EventAttribute `json:"attributes"`
+	}
+	if err := json.Unmarshal(raw, &flat); err != nil {
+		return nil
+	}
+	var events []types.TxEvent
+	for _, e := range flat {
+		if e.Type == "" {
+			continue
+		}
+		events = append(events, flatEvent(e.Type, e.Attributes))
+	}
+	return events
+}
+
+// EventsFromExplorer converts the flat event list of a tx detail (GetTxByTxHash).
+// Attributes come as a map there, so they are sorted by key.
+func EventsFromExplorer(in []*explorerPB.Event) []types.TxEvent {
+	events := make([]types.TxEvent, 0, len(in))
+	for _, e := range in {
+		attrs := make([]types.EventAttribute, 0, len(e.Attributes))
+		for k, v := range e.Attributes {
+			attrs = append(attrs, types.EventAttribute{Key: k, Value: v})
+		}
+		sort.Slice(attrs, func(i, j int) bool { return attrs[i].Key < attrs[j].Key })
+		events = append(events, flatEvent(e.Type, attrs))
+	}
+	return events
+}
+
+// flatEvent moves the msg_index attribute of a flat event into TxEvent.MsgIndex.
+func flatEvent(typ string, attrs []types.EventAttribute) types.TxEvent {
+	ev := types.TxEvent{MsgIndex: -1, Type: typ}
+	for _, a := range attrs {
+		if a.Key == msgIndexKey {
+			if idx, err := strconv.Atoi(strings.Trim(a.Value, `"`)); err == nil {
+				ev.MsgIndex = idx
+			}
+			continue
+		}
+		ev.Attributes = append(ev.Attributes, a)
+	}
+	return ev
+}
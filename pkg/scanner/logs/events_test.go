@@ -0,0 +1,212 @@
+package logs
+
+import (
+	"reflect"
+	"testing"
+
+	explorerPB "github.com/InjectiveLabs/sdk-go/exchange/explorer_rpc/pb"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+// The same tx of two messages, as the per-message logs of SDK < 0.50 and as the flat
+// event list of 0.50, where tx-level events come first and others carry a msg_index.
+const (
+	perMessageLogs = `[
+		{"msg_index":"0","events":[
+			{"type":"message","attributes":[{"key":"action","value":"/injective.exchange.v1beta1.MsgBatchUpdateOrders"}]},
+			{"type":"injective.exchange.v1beta1.EventNewDerivativeOrders","attributes":[
+				{"key":"market_id","value":"\"` + btcPerp + `\""},
+				{"key":"buy_orders","value":"[{\"order_info\":{\"subaccount_id\":\"0xsub\",\"price\":\"100\",\"quantity\":\"2\"},\"order_type\":\"BUY\",\"margin\":\"200\",\"order_hash\":\"0xorder1\"},{\"order_info\":{\"subaccount_id\":\"0xsub\",\"price\":\"99\",\"quantity\":\"1\"},\"order_type\":\"BUY\",\"margin\":\"99\",\"order_hash\":\"0xorder2\"}]"},
+				{"key":"sell_orders","value":"[]"}]},
+			{"type":"injective.exchange.v1beta1.EventCancelDerivativeOrder","attributes":[
+				{"key":"market_id","value":"\"` + btcPerp + `\""},
+				{"key":"isLimitCancel","value":"true"},
+				{"key":"limit_order","value":"{\"order_info\":{\"subaccount_id\":\"0xsub\",\"price\":\"98\",\"quantity\":\"1\"},\"order_type\":\"BUY\",\"margin\":\"98\",\"order_hash\":\"0xorder0\"}"}]}]},
+		{"msg_index":"1","events":[
+			{"type":"message","attributes":[{"key":"action","value":"/injective.exchange.v1beta1.MsgCreateDerivativeLimitOrder"}]},
+			{"type":"injective.exchange.v1beta1.EventNewDerivativeOrders","attributes":[
+				{"key":"market_id","value":"\"` + btcPerp + `\""},
+				{"key":"buy_orders","value":"[]"},
+				{"key":"sell_orders","value":"[{\"order_info\":{\"subaccount_id\":\"0xsub\",\"price\":\"101\",\"quantity\":\"1\"},\"order_type\":\"SELL\",\"margin\":\"101\",\"order_hash\":\"0xorder3\"}]"}]}]}
+	]`
+
+	flatEvents = `[
+		{"type":"tx","attributes":[{"key":"fee","value":"100000inj"},{"key":"fee_payer","value":"inj1payer"}]},
+		{"type":"tx","attributes":[{"key":"acc_seq","value":"inj1payer/7"}]},
+		{"type":"message","attributes":[{"key":"action","value":"/injective.exchange.v1beta1.MsgBatchUpdateOrders"},{"key":"msg_index","value":"0"}]},
+		{"type":"injective.exchange.v1beta1.EventNewDerivativeOrders","attributes":[
+			{"key":"market_id","value":"\"` + btcPerp + `\""},
+			{"key":"buy_orders","value":"[{\"order_info\":{\"subaccount_id\":\"0xsub\",\"price\":\"100\",\"quantity\":\"2\"},\"order_type\":\"BUY\",\"margin\":\"200\",\"order_hash\":\"0xorder1\"},{\"order_info\":{\"subaccount_id\":\"0xsub\",\"price\":\"99\",\"quantity\":\"1\"},\"order_type\":\"BUY\",\"margin\":\"99\",\"order_hash\":\"0xorder2\"}]"},
+			{"key":"sell_orders","value":"[]"},
+			{"key":"msg_index","value":"0"}]},
+		{"type":"injective.exchange.v1beta1.EventCancelDerivativeOrder","attributes":[
+			{"key":"market_id","value":"\"` + btcPerp + `\""},
+			{"key":"isLimitCancel","value":"true"},
+			{"key":"limit_order","value":"{\"order_info\":{\"subaccount_id\":\"0xsub\",\"price\":\"98\",\"quantity\":\"1\"},\"order_type\":\"BUY\",\"margin\":\"98\",\"order_hash\":\"0xorder0\"}"},
+			{"key":"msg_index","value":"0"}]},
+		{"type":"message","attributes":[{"key":"action","value":"/injective.exchange.v1beta1.MsgCreateDerivativeLimitOrder"},{"key":"msg_index","value":"1"}]},
+		{"type":"injective.exchange.v1beta1.EventNewDerivativeOrders","attributes":[
+			{"key":"market_id","value":"\"` + btcPerp + `\""},
+			{"key":"buy_orders","value":"[]"},
+			{"key":"sell_orders","value":"[{\"order_info\":{\"subaccount_id\":\"0xsub\",\"price\":\"101\",\"quantity\":\"1\"},\"order_type\":\"SELL\",\"margin\":\"101\",\"order_hash\":\"0xorder3\"}]"},
+			{"key":"msg_index","value":"1"}]}
+	]`
+)
+
+// eventKey is where a record came from in its tx.
+type eventKey struct {
+	orderHash                       string
+	msgIndex, eventIndex, itemIndex int
+}
+
+func TestParseEventsRepresentations(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{name: "per-message logs", raw: perMessageLogs},
+		{name: "flat events", raw: flatEvents},
+	}
+	want := []eventKey{
+		{"0xorder1", 0, 0, 0},
+		{"0xorder2", 0, 0, 1},
+		{"0xorder0", 0, 1, 0},
+		{"0xorder3", 1, 0, 0},
+	}
+
+	var results [][]types.CSVRecord
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records := ParseTxEvents(testTx, ParseEvents([]byte(tt.raw)), "")
+			var got []eventKey
+			for _, rec := range records {
+				got = append(got, eventKey{rec.OrderHash, rec.MsgIndex, rec.EventIndex, rec.ItemIndex})
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+			results = append(results, records)
+		})
+	}
+	if len(results) == 2 && !reflect.DeepEqual(results[0], results[1]) {
+		t.Errorf("representations differ:\nlogs %+v\nflat %+v", results[0], results[1])
+	}
+}
+
+func TestParseEvents(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+
+		// want is the type and msg index of each event
+		want []string
+		msgs []int
+	}{
+		{
+			name: "per-message logs",
+			raw:  `[{"msg_index":"0","events":[{"type":"message","attributes":[]}]},{"msg_index":"1","events":[{"type":"transfer","attributes":[]}]}]`,
+			want: []string{"message", "transfer"},
+			msgs: []int{0, 1},
+		},
+		{
+			name: "flat events, tx-level ones without a message",
+			raw:  `[{"type":"tx","attributes":[{"key":"fee","value":"1inj"}]},{"type":"message","attributes":[{"key":"msg_index","value":"1"}]}]`,
+			want: []string{"tx", "message"},
+			msgs: []int{-1, 1},
+		},
+		{
+			name: "logs first when both are there",
+			raw:  `[{"msg_index":"1","events":[{"type":"message","attributes":[]}]},{"type":"tx","attributes":[]}]`,
+			want: []string{"message"},
+			msgs: []int{1},
+		},
+		{
+			name: "flat events when the logs have none",
+			raw:  `[{"msg_index":"0","events":[]},{"type":"tx","attributes":[]}]`,
+			want: []string{"tx"},
+			msgs: []int{-1},
+		},
+		{
+			name: "empty logs",
+			raw:  `[{"msg_index":"0","events":[]}]`,
+		},
+		{name: "empty list", raw: `[]`},
+		{name: "empty", raw: ``},
+		{name: "not a list", raw: `"raw_log"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := ParseEvents([]byte(tt.raw))
+			var got []string
+			var msgs []int
+			for _, e := range events {
+				got = append(got, e.Type)
+				msgs = append(msgs, e.MsgIndex)
+			}
+			if !reflect.DeepEqual(got, tt.want) || !reflect.DeepEqual(msgs, tt.msgs) {
+				t.Errorf("got %v in msgs %v, want %v in msgs %v", got, msgs, tt.want, tt.msgs)
+			}
+			if tt.want == nil && events != nil {
+				t.Errorf("got %v, want nil", events)
+			}
+		})
+	}
+}
+
+func TestFlatEvent(t *testing.T) {
+	tests := []struct {
+		name      string
+		attrs     []types.EventAttribute
+		wantMsg   int
+		wantAttrs []types.EventAttribute
+	}{
+		{
+			name:      "msg_index moved out of the attributes",
+			attrs:     []types.EventAttribute{{Key: "market_id", Value: `"0xm"`}, {Key: "msg_index", Value: "2"}},
+			wantMsg:   2,
+			wantAttrs: []types.EventAttribute{{Key: "market_id", Value: `"0xm"`}},
+		},
+		{
+			name:    "quoted msg_index",
+			attrs:   []types.EventAttribute{{Key: "msg_index", Value: `"3"`}},
+			wantMsg: 3,
+		},
+		{
+			name:      "no msg_index",
+			attrs:     []types.EventAttribute{{Key: "fee", Value: "1inj"}},
+			wantMsg:   -1,
+			wantAttrs: []types.EventAttribute{{Key: "fee", Value: "1inj"}},
+		},
+		{
+			name:    "bad msg_index",
+			attrs:   []types.EventAttribute{{Key: "msg_index", Value: "x"}},
+			wantMsg: -1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := flatEvent("test", tt.attrs)
+			if got.MsgIndex != tt.wantMsg {
+				t.Errorf("MsgIndex = %d, want %d", got.MsgIndex, tt.wantMsg)
+			}
+			if !reflect.DeepEqual(got.Attributes, tt.wantAttrs) {
+				t.Errorf("Attributes = %v, want %v", got.Attributes, tt.wantAttrs)
+			}
+		})
+	}
+}
+
+func TestEventsFromExplorer(t *testing.T) {
+	events := EventsFromExplorer([]*explorerPB.Event{
+		{Type: "tx", Attributes: map[string]string{"fee_payer": "inj1payer", "fee": "1inj"}},
+		{Type: "message", Attributes: map[string]string{"msg_index": "1", "sender": "inj1payer", "action": "/m"}},
+	})
+	want := []types.TxEvent{
+		{MsgIndex: -1, Type: "tx", Attributes: []types.EventAttribute{{Key: "fee", Value: "1inj"}, {Key: "fee_payer", Value: "inj1payer"}}},
+		{MsgIndex: 1, Type: "message", Attributes: []types.EventAttribute{{Key: "action", Value: "/m"}, {Key: "sender", Value: "inj1payer"}}},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("got %+v\nwant %+v", events, want)
+	}
+}
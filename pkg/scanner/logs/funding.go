@@ -0,0 +1,64 @@
+package logs
+
+import (
+	"encoding/json"
+	"strings"
+
+	explorerPB "github.com/InjectiveLabs/sdk-go/exchange/explorer_rpc/pb"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+// fundingInfo is the "funding" attribute of EventPerpetualMarketFundingUpdate
+type fundingInfo struct {
+	CumulativeFunding string `json:"cumulative_funding"`
+}
+
+// Funding updates come from the BeginBlocker, so only with block events
+// (Config.BlockEvents). They have no subaccount: funding.Ledger derives payments.
+func handleEventFundingUpdate(tx *explorerPB.TxData, attrs []types.EventAttribute, filterMarketID string) []types.CSVRecord {
+	var records []types.CSVRecord
+
+	rec := types.CSVRecord{
+		TxHash:         tx.Hash,
+		Block:          tx.BlockNumber,
+		BlockTimestamp: tx.BlockTimestamp,
+		Action:         "FUNDING",
+		MarketType:     types.MarketDerivative,
+	}
+	var found bool
+	for _, attr := range attrs {
+		switch attr.Key {
+		case "market_id":
+			rec.MarketID = strings.Trim(attr.Value, `"`)
+		case "funding":
+			var info fundingInfo
+			if err := json.Unmarshal([]byte(attr.Value), &info); err == nil {
+				rec.CumulativeFunding = info.CumulativeFunding
+				found = true
+			}
+		case "is_hourly_funding":
+			rec.IsHourlyFunding = (attr.Value == "true")
+		case "funding_rate":
+			rec.FundingRate = decAttr(attr.Value)
+		case "mark_price":
+			rec.MarkPrice = decAttr(attr.Value)
+		}
+	}
+
+	if filterMarketID != "" && filterMarketID != rec.MarketID {
+		return records // empty
+	}
+	if !found {
+		return records
+	}
+	return append(records, rec)
+}
+
+// decAttr unquotes an optional decimal attribute; null becomes "".
+func decAttr(value string) string {
+	if value == "null" {
+		return ""
+	}
+	return strings.Trim(value, `"`)
+}
@@ -0,0 +1,102 @@
+package logs
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+func TestFundingEvents(t *testing.T) {
+	const (
+		hourly = `{"type":"injective.exchange.v1beta1.EventPerpetualMarketFundingUpdate","attributes":[
+			{"key":"market_id","value":"\"` + btcPerp + `\""},
+			{"key":"funding","value":"{\"cumulative_funding\":\"1234.567800000000000000\",\"cumulative_price\":\"0.000000000000000000\",\"last_timestamp\":\"1735689600\"}"},
+			{"key":"is_hourly_funding","value":"true"},
+			{"key":"funding_rate","value":"\"0.000012500000000000\""},
+			{"key":"mark_price","value":"\"95012.340000000000000000\""}]}`
+		// Not hourly: rate and mark price are null
+		twap = `{"type":"injective.exchange.v1beta1.EventPerpetualMarketFundingUpdate","attributes":[
+			{"key":"market_id","value":"\"` + btcPerp + `\""},
+			{"key":"funding","value":"{\"cumulative_funding\":\"1234.567800000000000000\",\"cumulative_price\":\"-12.500000000000000000\",\"last_timestamp\":\"1735689600\"}"},
+			{"key":"is_hourly_funding","value":"false"},
+			{"key":"funding_rate","value":"null"},
+			{"key":"mark_price","value":"null"}]}`
+		noFunding = `{"type":"injective.exchange.v1beta1.EventPerpetualMarketFundingUpdate","attributes":[
+			{"key":"market_id","value":"\"` + btcPerp + `\""},
+			{"key":"is_hourly_funding","value":"true"}]}`
+	)
+
+	tests := []struct {
+		name     string
+		marketID string
+		events   []string
+		want     []types.CSVRecord
+	}{
+		{
+			name:   "hourly update",
+			events: []string{hourly},
+			want: []types.CSVRecord{{
+				Action: "FUNDING", MarketID: btcPerp, MarketType: types.MarketDerivative,
+				CumulativeFunding: "1234.567800000000000000", IsHourlyFunding: true,
+				FundingRate: "0.000012500000000000", MarkPrice: "95012.340000000000000000",
+			}},
+		},
+		{
+			name:   "null rate and mark price",
+			events: []string{twap},
+			want: []types.CSVRecord{{
+				Action: "FUNDING", MarketID: btcPerp, MarketType: types.MarketDerivative,
+				CumulativeFunding: "1234.567800000000000000",
+			}},
+		},
+		{
+			name:   "no funding attribute",
+			events: []string{noFunding},
+		},
+		{
+			name:     "market filter",
+			marketID: btcPerp,
+			events:   []string{hourly},
+			want: []types.CSVRecord{{
+				Action: "FUNDING", MarketID: btcPerp, MarketType: types.MarketDerivative,
+				CumulativeFunding: "1234.567800000000000000", IsHourlyFunding: true,
+				FundingRate: "0.000012500000000000", MarkPrice: "95012.340000000000000000",
+			}},
+		},
+		{
+			name:     "other market filtered out",
+			marketID: ethPerp,
+			events:   []string{hourly},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseEvents(tt.marketID, tt.events...)
+			var want []types.CSVRecord
+			for _, rec := range tt.want {
+				want = append(want, txRecord(rec))
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got  %+v\nwant %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestDecAttr(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: `"0.000012500000000000"`, want: "0.000012500000000000"},
+		{value: `-0.5`, want: "-0.5"},
+		{value: `null`, want: ""},
+		{value: `""`, want: ""},
+	}
+	for _, tt := range tests {
+		if got := decAttr(tt.value); got != tt.want {
+			t.Errorf("decAttr(%s) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
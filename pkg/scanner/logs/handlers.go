@@ -10,39 +10,69 @@ import (
 	"github.com/kprimice/challenge-week/pkg/scanner/types"
 )
 
+// ParseTxLogs parses the events in tx.Logs, in either representation (see ParseEvents).
 func ParseTxLogs(tx *explorerPB.TxData, marketID string) []types.CSVRecord {
-	var logs []types.TxLog
-	if err := json.Unmarshal([]byte(tx.Logs), &logs); err != nil {
-		return nil
-	}
+	return ParseTxEvents(tx, ParseEvents(tx.Logs), marketID)
+}
 
+// ParseTxEvents turns the exchange events of tx into records. tx provides the hash,
+// block and timestamp of the records.
+func ParseTxEvents(tx *explorerPB.TxData, events []types.TxEvent, marketID string) []types.CSVRecord {
 	var results []types.CSVRecord
-	for _, l := range logs {
-		for _, e := range l.Events {
-			if strings.HasPrefix(e.Type, "injective.exchange.v1beta1.") {
-				switch e.Type {
-				case "injective.exchange.v1beta1.EventCancelDerivativeOrder":
-					results = append(results, handleEventCancel(tx, e.Attributes, marketID)...)
-				case "injective.exchange.v1beta1.EventNewDerivativeOrders":
-					results = append(results, handleEventNewOrders(tx, e.Attributes, marketID)...)
-				case "injective.exchange.v1beta1.EventBatchDerivativeExecution":
-					results = append(results, handleEventBatchDerivativeExecution(tx, e.Attributes, marketID)...)
-				default:
-					if strings.Contains(e.Type, "Spot") ||
-						strings.Contains(e.Type, "Fail") ||
-						e.Type == "injective.exchange.v1beta1.EventPerpetualMarketFundingUpdate" ||
-						e.Type == "injective.exchange.v1beta1.EventSubaccountWithdraw" {
-						continue
-					}
-					log.Printf("Unknown event type: %s for tx %s with attributes: %v\n",
-						e.Type, tx.Hash, e.Attributes)
+	// Exchange events seen so far in each message
+	exchangeEvents := map[int]int{}
+	for _, e := range events {
+		if strings.HasPrefix(e.Type, "injective.exchange.v1beta1.") {
+			eventIndex := exchangeEvents[e.MsgIndex]
+			exchangeEvents[e.MsgIndex]++
+
+			var records []types.CSVRecord
+			switch e.Type {
+			case "injective.exchange.v1beta1.EventCancelDerivativeOrder":
+				records = handleEventCancel(tx, e.Attributes, marketID)
+			case "injective.exchange.v1beta1.EventNewDerivativeOrders":
+				records = handleEventNewOrders(tx, e.Attributes, marketID)
+			case "injective.exchange.v1beta1.EventBatchDerivativeExecution":
+				records = handleEventBatchDerivativeExecution(tx, e.Attributes, marketID)
+			case "injective.exchange.v1beta1.EventNewConditionalDerivativeOrder":
+				records = handleEventNewConditionalOrder(tx, e.Attributes, marketID)
+			case "injective.exchange.v1beta1.EventCancelConditionalDerivativeOrder":
+				records = handleEventCancelConditionalOrder(tx, e.Attributes, marketID)
+			case "injective.exchange.v1beta1.EventConditionalDerivativeOrderTrigger":
+				records = handleEventConditionalOrderTrigger(tx, e.Attributes, marketID)
+			case "injective.exchange.v1beta1.EventPerpetualMarketFundingUpdate":
+				records = handleEventFundingUpdate(tx, e.Attributes, marketID)
+			case "injective.exchange.v1beta1.EventCancelSpotOrder":
+				records = handleEventCancelSpotOrder(tx, e.Attributes, marketID)
+			case "injective.exchange.v1beta1.EventNewSpotOrders":
+				records = handleEventNewSpotOrders(tx, e.Attributes, marketID)
+			case "injective.exchange.v1beta1.EventBatchSpotExecution":
+				records = handleEventBatchSpotExecution(tx, e.Attributes, marketID)
+			default:
+				if strings.Contains(e.Type, "Spot") ||
+					strings.Contains(e.Type, "Fail") ||
+					e.Type == "injective.exchange.v1beta1.EventSubaccountWithdraw" {
+					continue
 				}
+				log.Printf("Unknown event type: %s for tx %s with attributes: %v\n",
+					e.Type, tx.Hash, e.Attributes)
 			}
+			results = append(results, indexed(records, e.MsgIndex, eventIndex)...)
 		}
 	}
 	return results
 }
 
+// indexed stamps records with the message and exchange event they came from.
+func indexed(records []types.CSVRecord, msgIndex, eventIndex int) []types.CSVRecord {
+	for i := range records {
+		records[i].MsgIndex = msgIndex
+		records[i].EventIndex = eventIndex
+		records[i].ItemIndex = i
+	}
+	return records
+}
+
 /*
 func BuildOrderHashMap(tx *explorerPB.TxData) map[string]string {
 	result := make(map[string]string)
@@ -102,12 +132,14 @@ func handleEventCancel(tx *explorerPB.TxData, attrs []types.EventAttribute, filt
 					BlockTimestamp: tx.BlockTimestamp,
 					Action:         "EVENT_CANCEL",
 					MarketID:       lo.MarketId,
+					MarketType:     types.MarketDerivative,
 					Price:          lo.OrderInfo.Price,
 					Quantity:       lo.OrderInfo.Quantity,
 					OrderType:      lo.OrderType,
 					SubaccountID:   lo.OrderInfo.SubaccountID,
 					Margin:         lo.Margin,
 					OrderHash:      lo.OrderHash,
+					Cid:            lo.OrderInfo.Cid,
 				}
 				records = append(records, rec)
 			}
@@ -150,12 +182,14 @@ func handleEventNewOrders(tx *explorerPB.TxData, attrs []types.EventAttribute, f
 					BlockTimestamp: tx.BlockTimestamp,
 					Action:         "EVENT_NEW",
 					MarketID:       lo.MarketId,
+					MarketType:     types.MarketDerivative,
 					Price:          lo.OrderInfo.Price,
 					Quantity:       lo.OrderInfo.Quantity,
 					OrderType:      lo.OrderType,
 					SubaccountID:   lo.OrderInfo.SubaccountID,
 					Margin:         lo.Margin,
 					OrderHash:      lo.OrderHash,
+					Cid:            lo.OrderInfo.Cid,
 				}
 				records = append(records, rec)
 			}
@@ -181,7 +215,7 @@ func handleEventBatchDerivativeExecution(
 	for _, attr := range attrs {
 		switch attr.Key {
 		case "market_id":
-			marketID = attr.Value
+			marketID = strings.Trim(attr.Value, `"`)
 		case "is_buy":
 			// "true" or "false" as string
 			isBuy = (attr.Value == "true")
@@ -221,13 +255,16 @@ func handleEventBatchDerivativeExecution(
 			BlockTimestamp: tx.BlockTimestamp,
 			Action:         "EXECUTION",
 			MarketID:       marketID,
+			MarketType:     types.MarketDerivative,
 			SubaccountID:   t.SubaccountId,
 			OrderHash:      t.OrderHash,
+			Cid:            t.Cid,
 
 			// Fill in the 'Exec' fields
 			ExecPrice:    t.PositionDelta.ExecutionPrice,
 			ExecQuantity: t.PositionDelta.ExecutionQuantity,
 			ExecFee:      t.Fee,
+			ExecMargin:   t.PositionDelta.ExecutionMargin,
 
 			// Our new fields
 			IsBuy:         isBuy,
@@ -0,0 +1,151 @@
+package logs
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+
+	sdkmath "cosmossdk.io/math"
+	explorerPB "github.com/InjectiveLabs/sdk-go/exchange/explorer_rpc/pb"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+// Spot events carry the same order shape as derivative ones, minus the margin.
+// Cancels hold it under "order" instead of "limit_order".
+
+func handleEventNewSpotOrders(tx *explorerPB.TxData, attrs []types.EventAttribute, filterMarketID string) []types.CSVRecord {
+	var records []types.CSVRecord
+	marketID := attrMarketID(attrs)
+	if filterMarketID != "" && filterMarketID != marketID {
+		return records // empty
+	}
+
+	for _, attr := range attrs {
+		if attr.Key != "buy_orders" && attr.Key != "sell_orders" {
+			continue
+		}
+		var orders []types.LimitOrder
+		if err := json.Unmarshal([]byte(attr.Value), &orders); err != nil {
+			continue
+		}
+		for _, lo := range orders {
+			records = append(records, spotOrderRecord(tx, "EVENT_NEW", marketID, lo))
+		}
+	}
+	return records
+}
+
+func handleEventCancelSpotOrder(tx *explorerPB.TxData, attrs []types.EventAttribute, filterMarketID string) []types.CSVRecord {
+	var records []types.CSVRecord
+	marketID := attrMarketID(attrs)
+	if filterMarketID != "" && filterMarketID != marketID {
+		return records // empty
+	}
+
+	for _, attr := range attrs {
+		if attr.Key != "order" {
+			continue
+		}
+		var lo types.LimitOrder
+		if err := json.Unmarshal([]byte(attr.Value), &lo); err == nil {
+			records = append(records, spotOrderRecord(tx, "EVENT_CANCEL", marketID, lo))
+		}
+	}
+	return records
+}
+
+func handleEventBatchSpotExecution(tx *explorerPB.TxData, attrs []types.EventAttribute, filterMarketID string) []types.CSVRecord {
+	var records []types.CSVRecord
+
+	var marketID, tradesRaw string
+	var isBuy bool
+	for _, attr := range attrs {
+		switch attr.Key {
+		case "market_id":
+			marketID = strings.Trim(attr.Value, `"`)
+		case "is_buy":
+			isBuy = (attr.Value == "true")
+		case "trades":
+			tradesRaw = attr.Value
+		}
+	}
+
+	if filterMarketID != "" && filterMarketID != marketID {
+		return records // empty
+	}
+	if tradesRaw == "" {
+		return records
+	}
+
+	var trades []types.BatchSpotTrade
+	if err := json.Unmarshal([]byte(tradesRaw), &trades); err != nil {
+		log.Printf("Failed to unmarshal trades in EventBatchSpotExecution: %v\n", err)
+		return records
+	}
+
+	for _, t := range trades {
+		records = append(records, types.CSVRecord{
+			TxHash:         tx.Hash,
+			Block:          tx.BlockNumber,
+			BlockTimestamp: tx.BlockTimestamp,
+			Action:         "EXECUTION",
+			MarketID:       marketID,
+			MarketType:     types.MarketSpot,
+			SubaccountID:   t.SubaccountId,
+			OrderHash:      t.OrderHash,
+			Cid:            t.Cid,
+
+			ExecPrice:    t.Price,
+			ExecQuantity: t.Quantity,
+			ExecFee:      t.Fee,
+			QuoteAmount:  quoteAmount(t.Price, t.Quantity),
+			IsBuy:        isBuy,
+		})
+	}
+	return records
+}
+
+func spotOrderRecord(tx *explorerPB.TxData, action, marketID string, lo types.LimitOrder) types.CSVRecord {
+	if lo.MarketId == "" {
+		lo.MarketId = marketID
+	}
+	return types.CSVRecord{
+		TxHash:         tx.Hash,
+		Block:          tx.BlockNumber,
+		BlockTimestamp: tx.BlockTimestamp,
+		Action:         action,
+		MarketID:       lo.MarketId,
+		MarketType:     types.MarketSpot,
+		Price:          lo.OrderInfo.Price,
+		Quantity:       lo.OrderInfo.Quantity,
+		QuoteAmount:    quoteAmount(lo.OrderInfo.Price, lo.OrderInfo.Quantity),
+		OrderType:      lo.OrderType,
+		SubaccountID:   lo.OrderInfo.SubaccountID,
+		OrderHash:      lo.OrderHash,
+		Cid:            lo.OrderInfo.Cid,
+	}
+}
+
+// attrMarketID returns the top-level market_id attribute of an event, if any.
+func attrMarketID(attrs []types.EventAttribute) string {
+	for _, attr := range attrs {
+		if attr.Key == "market_id" {
+			return strings.Trim(attr.Value, `"`)
+		}
+	}
+	return ""
+}
+
+// quoteAmount returns price * quantity, or "" if either is not a decimal.
+func quoteAmount(price, quantity string) string {
+	p, err := sdkmath.LegacyNewDecFromStr(price)
+	if err != nil {
+		return ""
+	}
+	q, err := sdkmath.LegacyNewDecFromStr(quantity)
+	if err != nil {
+		return ""
+	}
+	return p.Mul(q).String()
+}
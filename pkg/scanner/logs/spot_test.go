@@ -0,0 +1,140 @@
+package logs
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+// The INJ/USDT spot market
+const injUsdt = "0x0611780ba69656949525013d947713300f56c37b6175e02f26bffa495c3208fe"
+
+func TestQuoteAmount(t *testing.T) {
+	tests := []struct {
+		name     string
+		price    string
+		quantity string
+		want     string
+	}{
+		{name: "decimals", price: "0.000000000023450000", quantity: "1500000000000000000.000000000000000000", want: "35175000.000000000000000000"},
+		{name: "integers", price: "2", quantity: "3", want: "6.000000000000000000"},
+		{name: "rounded half to even", price: "0.000000000000000001", quantity: "0.5", want: "0.000000000000000000"},
+		{name: "rounded half to even up", price: "0.000000000000000003", quantity: "0.5", want: "0.000000000000000002"},
+		{name: "zero quantity", price: "12.5", quantity: "0", want: "0.000000000000000000"},
+		{name: "empty price", price: "", quantity: "1", want: ""},
+		{name: "invalid quantity", price: "1", quantity: "null", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := quoteAmount(tt.price, tt.quantity); got != tt.want {
+				t.Errorf("quoteAmount(%q, %q) = %q, want %q", tt.price, tt.quantity, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpotEvents(t *testing.T) {
+	const (
+		order     = `{\"market_id\":\"` + injUsdt + `\",\"order_info\":{\"subaccount_id\":\"0xsub\",\"fee_recipient\":\"inj1fee\",\"price\":\"0.000000000023450000\",\"quantity\":\"1500000000000000000.000000000000000000\",\"cid\":\"spot-1\"},\"order_type\":\"BUY\",\"fillable\":\"1500000000000000000.000000000000000000\",\"trigger_price\":null,\"order_hash\":\"0xspot\"}`
+		newOrders = `{"type":"injective.exchange.v1beta1.EventNewSpotOrders","attributes":[
+			{"key":"market_id","value":"\"` + injUsdt + `\""},
+			{"key":"buy_orders","value":"[` + order + `]"},
+			{"key":"sell_orders","value":"[]"}]}`
+		cancel = `{"type":"injective.exchange.v1beta1.EventCancelSpotOrder","attributes":[
+			{"key":"market_id","value":"\"` + injUsdt + `\""},
+			{"key":"order","value":"` + order + `"}]}`
+		// A spot cancel in the derivative shape is not a spot cancel
+		cancelAsDerivative = `{"type":"injective.exchange.v1beta1.EventCancelSpotOrder","attributes":[
+			{"key":"market_id","value":"\"` + injUsdt + `\""},
+			{"key":"limit_order","value":"` + order + `"}]}`
+		// And a derivative cancel in the spot shape is not a derivative cancel
+		derivativeCancelAsSpot = `{"type":"injective.exchange.v1beta1.EventCancelDerivativeOrder","attributes":[
+			{"key":"market_id","value":"\"` + btcPerp + `\""},
+			{"key":"isLimitCancel","value":"true"},
+			{"key":"order","value":"{\"order_info\":{\"subaccount_id\":\"0xsub\",\"price\":\"95000.000000000000000000\",\"quantity\":\"0.010000000000000000\"},\"order_type\":\"BUY\",\"margin\":\"950.000000000000000000\",\"order_hash\":\"0xperp\"}"}]}`
+		derivativeCancel = `{"type":"injective.exchange.v1beta1.EventCancelDerivativeOrder","attributes":[
+			{"key":"market_id","value":"\"` + btcPerp + `\""},
+			{"key":"isLimitCancel","value":"true"},
+			{"key":"limit_order","value":"{\"order_info\":{\"subaccount_id\":\"0xsub\",\"price\":\"95000.000000000000000000\",\"quantity\":\"0.010000000000000000\"},\"order_type\":\"BUY\",\"margin\":\"950.000000000000000000\",\"order_hash\":\"0xperp\"}"},
+			{"key":"market_order_cancel","value":"null"}]}`
+		execution = `{"type":"injective.exchange.v1beta1.EventBatchSpotExecution","attributes":[
+			{"key":"market_id","value":"\"` + injUsdt + `\""},
+			{"key":"is_buy","value":"true"},
+			{"key":"executionType","value":"\"LimitMatchNewOrder\""},
+			{"key":"trades","value":"[{\"quantity\":\"1500000000000000000.000000000000000000\",\"price\":\"0.000000000023450000\",\"subaccount_id\":\"0xsub\",\"fee\":\"35175.000000000000000000\",\"order_hash\":\"0xspot\",\"fee_recipient_address\":\"inj1fee\",\"cid\":\"spot-1\"}]"}]}`
+	)
+
+	spotOrder := types.CSVRecord{
+		MarketID: injUsdt, MarketType: types.MarketSpot,
+		OrderHash: "0xspot", SubaccountID: "0xsub", Cid: "spot-1", OrderType: "BUY",
+		Price: "0.000000000023450000", Quantity: "1500000000000000000.000000000000000000",
+		QuoteAmount: "35175000.000000000000000000",
+	}
+	withAction := func(rec types.CSVRecord, action string) types.CSVRecord {
+		rec.Action = action
+		return rec
+	}
+
+	tests := []struct {
+		name     string
+		marketID string
+		events   []string
+		want     []types.CSVRecord
+	}{
+		{
+			name:   "new order with its quote amount",
+			events: []string{newOrders},
+			want:   []types.CSVRecord{withAction(spotOrder, "EVENT_NEW")},
+		},
+		{
+			name:   "cancel holds the order under order",
+			events: []string{cancel},
+			want:   []types.CSVRecord{withAction(spotOrder, "EVENT_CANCEL")},
+		},
+		{
+			name:   "spot cancel with limit_order is ignored",
+			events: []string{cancelAsDerivative},
+		},
+		{
+			name:   "derivative cancel holds the order under limit_order",
+			events: []string{derivativeCancel},
+			want: []types.CSVRecord{{
+				Action: "EVENT_CANCEL", MarketID: btcPerp, MarketType: types.MarketDerivative,
+				OrderHash: "0xperp", SubaccountID: "0xsub", OrderType: "BUY",
+				Price: "95000.000000000000000000", Quantity: "0.010000000000000000", Margin: "950.000000000000000000",
+			}},
+		},
+		{
+			name:   "derivative cancel with order is ignored",
+			events: []string{derivativeCancelAsSpot},
+		},
+		{
+			name:   "execution with its quote amount",
+			events: []string{execution},
+			want: []types.CSVRecord{{
+				Action: "EXECUTION", MarketID: injUsdt, MarketType: types.MarketSpot,
+				OrderHash: "0xspot", SubaccountID: "0xsub", Cid: "spot-1",
+				ExecPrice: "0.000000000023450000", ExecQuantity: "1500000000000000000.000000000000000000",
+				ExecFee: "35175.000000000000000000", QuoteAmount: "35175000.000000000000000000", IsBuy: true,
+			}},
+		},
+		{
+			name:     "other market filtered out",
+			marketID: btcPerp,
+			events:   []string{newOrders, cancel, execution},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseEvents(tt.marketID, tt.events...)
+			var want []types.CSVRecord
+			for _, rec := range tt.want {
+				want = append(want, txRecord(rec))
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got  %+v\nwant %+v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package scanner
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	derivativeExchangePB "github.com/InjectiveLabs/sdk-go/exchange/derivative_exchange_rpc/pb"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/archive"
+	"github.com/kprimice/challenge-week/pkg/scanner/source"
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+// Adjust these as desired
+const (
+	chunkSize = uint64(100) // how many blocks per chunk, unless set in the config
+	pageSize  = int32(100)  // how many txs per fetch
+)
+
+// chunkJob is one block range [low..high] handed to a worker.
+// seq is its position in the scan, used to restore block order.
+type chunkJob struct {
+	seq  uint64
+	low  uint64
+	high uint64
+}
+
+// chunkStats counts what was fetched for a chunk, even if it later failed.
+type chunkStats struct {
+	pages int
+	txs   int
+
+	// blockTxs is the number of distinct tx hashes fetched per block
+	blockTxs map[uint64]int
+	// blockTimes is the timestamp of every block that had txs
+	blockTimes map[uint64]string
+}
+
+// chunkResult is what a worker produced for a chunkJob.
+type chunkResult struct {
+	job     chunkJob
+	records []types.CSVRecord
+	stats   chunkStats
+	err     error
+
+	// txs are the raw txs behind records, in the same order, for the archive
+	txs []archive.Tx
+
+	// mismatches are blocks left out because verification found missing txs
+	mismatches []BlockMismatch
+
+	// incomplete is set when the chunk is kept with fewer txs than the source reports
+	incomplete *FailedChunk
+}
+
+// workerCount returns the number of chunk workers to run (at least 1).
+func workerCount(cfg types.Config) int {
+	if cfg.Concurrency < 1 {
+		return 1
+	}
+	return cfg.Concurrency
+}
+
+// runChunk fetches, parses and (with cfg.Verify) verifies one chunk, then adds
+// block events with cfg.BlockEvents.
+func runChunk(ctx context.Context, client source.TxSource, cfg types.Config, job chunkJob) chunkResult {
+	res := fetchChunk(ctx, client, job, cfg)
+	if res.err == nil && cfg.Verify {
+		res.err = verifyChunk(ctx, client, cfg, &res)
+	}
+	if res.err == nil && cfg.BlockEvents {
+		blocks := fetchBlockEvents(ctx, job, cfg, res.stats.blockTimes)
+		res.err = blocks.err
+		addBlockEvents(&res, blocks)
+	}
+	res.records = uniqueRecords(res.records, cfg.MarketType)
+	return res
+}
+
+// recordKey identifies a record across fetches: the tx, the message and exchange
+// event within it and the item within the event.
+type recordKey struct {
+	txHash     string
+	msgIndex   int
+	eventIndex int
+	itemIndex  int
+}
+
+// uniqueRecords drops records already seen earlier in records and records of
+// market types marketType does not keep, keeping the order.
+func uniqueRecords(records []types.CSVRecord, marketType string) []types.CSVRecord {
+	seen := make(map[recordKey]bool, len(records))
+	out := records[:0]
+	for _, rec := range records {
+		key := recordKey{rec.TxHash, rec.MsgIndex, rec.EventIndex, rec.ItemIndex}
+		if seen[key] || !types.KeepMarketType(marketType, rec.MarketType) {
+			continue
+		}
+		seen[key] = true
+		out = append(out, rec)
+	}
+	return out
+}
+
+// runChunkPool fetches the chunks of [cfg.StartBlock..cfg.EndBlock] with a pool of
+// workers and calls emit once per chunk, strictly in block order.
+//
+// At most 2*workers chunks are in flight or waiting to be emitted, so a slow chunk
+// holds back the pool instead of letting buffered results grow without bound.
+// If emit returns an error, the pool is stopped and that error is returned.
+func runChunkPool(
+	ctx context.Context,
+	client source.TxSource,
+	cfg types.Config,
+	emit func(chunkResult) error,
+) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := workerCount(cfg)
+	window := make(chan struct{}, 2*workers)
+	jobs := make(chan chunkJob)
+	results := make(chan chunkResult)
+	sizer := newChunkSizer(cfg)
+
+	// 1) Producer: split the range into chunks, waiting for a free slot in the window.
+	// Each chunk is sized when its slot frees up, from the chunks finished so far
+	go func() {
+		defer close(jobs)
+		var seq uint64
+		for low := cfg.StartBlock; low <= cfg.EndBlock; {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			high := low + sizer.next() - 1
+			if high > cfg.EndBlock || high < low {
+				high = cfg.EndBlock
+			}
+			select {
+			case jobs <- chunkJob{seq: seq, low: low, high: high}:
+			case <-ctx.Done():
+				return
+			}
+			seq++
+			if high == cfg.EndBlock {
+				return
+			}
+			low = high + 1
+		}
+	}()
+
+	// 2) Workers: fetch and parse each chunk
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				start := time.Now()
+				res := runChunk(ctx, client, cfg, job)
+				if ctx.Err() == nil {
+					sizer.observe(job.high-job.low+1, res.stats.txs, time.Since(start), res.err != nil)
+				}
+				select {
+				case results <- res:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// 3) Re-order: hold results until every earlier chunk has been emitted
+	pending := make(map[uint64]chunkResult)
+	var next uint64
+	for res := range results {
+		pending[res.job.seq] = res
+		for {
+			r, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			if err := emit(r); err != nil {
+				return err
+			}
+			<-window
+		}
+	}
+	return ctx.Err()
+}
+
+// tradesPage is one page of RunDerivativeTrades, fetched at skip.
+type tradesPage struct {
+	seq    uint64
+	skip   uint64
+	trades []*derivativeExchangePB.DerivativeTrade
+	err    error
+}
+
+// runTradesPool fetches the pages of pageSize trades from skip on with a pool of
+// workers and calls emit once per page, strictly in skip order, until emit reports
+// the last page or returns an error (which is then returned).
+//
+// At most workers pages are in flight or waiting to be emitted, so with one worker
+// pages are fetched one after the other and none past the last.
+func runTradesPool(
+	ctx context.Context,
+	workers int,
+	skip, pageSize uint64,
+	fetch func(ctx context.Context, skip uint64) ([]*derivativeExchangePB.DerivativeTrade, error),
+	emit func(tradesPage) (last bool, err error),
+) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers = max(workers, 1)
+	window := make(chan struct{}, workers)
+	jobs := make(chan tradesPage)
+	results := make(chan tradesPage)
+
+	// 1) Producer: one page after the other, waiting for a free slot in the window
+	go func() {
+		defer close(jobs)
+		for seq := uint64(0); ; seq++ {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- tradesPage{seq: seq, skip: skip + seq*pageSize}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// 2) Workers: fetch each page
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for page := range jobs {
+				page.trades, page.err = fetch(ctx, page.skip)
+				select {
+				case results <- page:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// 3) Re-order: hold pages until every earlier page has been emitted
+	pending := make(map[uint64]tradesPage)
+	var next uint64
+	for page := range results {
+		pending[page.seq] = page
+		for {
+			p, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			last, err := emit(p)
+			if err != nil || last {
+				return err
+			}
+			<-window
+		}
+	}
+	return ctx.Err()
+}
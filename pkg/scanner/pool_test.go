@@ -0,0 +1,319 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	derivativeExchangePB "github.com/InjectiveLabs/sdk-go/exchange/derivative_exchange_rpc/pb"
+	explorerPB "github.com/InjectiveLabs/sdk-go/exchange/explorer_rpc/pb"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/source"
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+// fakeSource serves txs from memory, newest first like the Explorer. Its txs
+// fail (Code 1), so they are parsed without a detail lookup.
+type fakeSource struct {
+	txs       []*explorerPB.TxData
+	low, high uint64
+
+	// hidden txs are left out of GetTxs over more than one block, like an index
+	// that only finds them when the block is paged on its own
+	hidden map[string]bool
+	// blockTxs (optional) overrides the tx count GetBlock(s) report for a block
+	blockTxs map[uint64]int
+	// unlisted blocks are left out of GetBlocks, so only GetBlock has them
+	unlisted map[uint64]bool
+
+	// head (optional) is the chain head GetBlocks reports, instead of high
+	head uint64
+	// unindexed txs are left out of every GetTxs until the test clears them (under mu)
+	unindexed map[string]bool
+	// stream (optional) feeds StreamTxs
+	stream chan *explorerPB.StreamTxsResponse
+
+	// delay (optional) is how long a GetTxs call for a range starting at low takes
+	delay func(low uint64) time.Duration
+	// shift (optional) is added to the skip of call n (from 0), to mimic pages
+	// moving between calls
+	shift func(n int) int
+
+	mu          sync.Mutex
+	calls       int
+	blockCalls  int
+	blocksCalls int
+}
+
+// newFakeSource returns a fakeSource with perBlock txs in each of blocks [low..high].
+func newFakeSource(low, high uint64, perBlock int) *fakeSource {
+	s := &fakeSource{low: low, high: high}
+	for b := low; b <= high; b++ {
+		for i := 0; i < perBlock; i++ {
+			s.txs = append(s.txs, &explorerPB.TxData{
+				Hash:           fmt.Sprintf("0x%d-%d", b, i),
+				BlockNumber:    b,
+				BlockTimestamp: "2025-01-01 00:00:00 +0000 UTC",
+				Code:           1,
+			})
+		}
+	}
+	return s
+}
+
+func (s *fakeSource) GetTxs(ctx context.Context, req *explorerPB.GetTxsRequest) (*explorerPB.GetTxsResponse, error) {
+	s.mu.Lock()
+	n := s.calls
+	s.calls++
+	unindexed := maps.Clone(s.unindexed)
+	s.mu.Unlock()
+	if s.delay != nil {
+		time.Sleep(s.delay(req.After))
+	}
+
+	var in []*explorerPB.TxData
+	for _, tx := range s.txs {
+		if unindexed[tx.Hash] || s.hidden[tx.Hash] && req.After != req.Before {
+			continue
+		}
+		if tx.BlockNumber >= req.After && tx.BlockNumber <= req.Before {
+			in = append(in, tx)
+		}
+	}
+	sort.SliceStable(in, func(i, j int) bool { return in[i].BlockNumber > in[j].BlockNumber })
+
+	skip := int(req.Skip)
+	if s.shift != nil {
+		skip += s.shift(n)
+	}
+	skip = max(min(skip, len(in)), 0)
+	end := min(skip+int(req.Limit), len(in))
+	return &explorerPB.GetTxsResponse{
+		Paging: &explorerPB.Paging{Total: int64(len(in))},
+		Data:   in[skip:end],
+	}, nil
+}
+
+func (s *fakeSource) GetTxByTxHash(ctx context.Context, hash string) (*explorerPB.GetTxByTxHashResponse, error) {
+	return nil, errors.New("fakeSource: no tx details")
+}
+
+// numTxs is the tx count reported for block.
+func (s *fakeSource) numTxs(block uint64) int64 {
+	if n, ok := s.blockTxs[block]; ok {
+		return int64(n)
+	}
+	var n int64
+	for _, tx := range s.txs {
+		if tx.BlockNumber == block {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *fakeSource) GetBlock(ctx context.Context, height string) (*explorerPB.GetBlockResponse, error) {
+	s.mu.Lock()
+	s.blockCalls++
+	s.mu.Unlock()
+
+	block, err := strconv.ParseUint(height, 10, 64)
+	if err != nil || block < s.low || block > s.high {
+		return nil, fmt.Errorf("fakeSource: no block %s", height)
+	}
+	return &explorerPB.GetBlockResponse{Data: &explorerPB.BlockDetailInfo{Height: block, NumTxs: s.numTxs(block)}}, nil
+}
+
+// GetBlocks returns the blocks in [req.After..req.Before], newest first, or the
+// newest block for an empty req.
+func (s *fakeSource) GetBlocks(ctx context.Context, req *explorerPB.GetBlocksRequest) (*explorerPB.GetBlocksResponse, error) {
+	s.mu.Lock()
+	s.blocksCalls++
+	s.mu.Unlock()
+
+	if req.After == 0 && req.Before == 0 {
+		head := s.high
+		if s.head != 0 {
+			head = s.head
+		}
+		return &explorerPB.GetBlocksResponse{Data: []*explorerPB.BlockInfo{{Height: head}}}, nil
+	}
+	res := &explorerPB.GetBlocksResponse{}
+	for b := min(req.Before, s.high); b >= max(req.After, s.low) && len(res.Data) < int(req.Limit); b-- {
+		if !s.unlisted[b] {
+			res.Data = append(res.Data, &explorerPB.BlockInfo{Height: b, NumTxs: s.numTxs(b)})
+		}
+		if b == 0 {
+			break
+		}
+	}
+	return res, nil
+}
+
+func (s *fakeSource) StreamTxs(ctx context.Context) (source.TxStream, error) {
+	if s.stream == nil {
+		return nil, errors.New("fakeSource: no stream")
+	}
+	return fakeStream{ctx: ctx, txs: s.stream}, nil
+}
+
+type fakeStream struct {
+	ctx context.Context
+	txs chan *explorerPB.StreamTxsResponse
+}
+
+func (s fakeStream) Recv() (*explorerPB.StreamTxsResponse, error) {
+	select {
+	case tx := <-s.txs:
+		return tx, nil
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+}
+
+func TestRunChunkPoolEmitsInOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  types.Config
+	}{
+		{"one worker", types.Config{StartBlock: 1, EndBlock: 500, ChunkBlocks: 10, Concurrency: 1}},
+		{"workers", types.Config{StartBlock: 1, EndBlock: 500, ChunkBlocks: 10, Concurrency: 4}},
+		{"adaptive chunks", types.Config{StartBlock: 1, EndBlock: 500, ChunkBlocks: 10, ChunkTxs: 15, Concurrency: 4}},
+		{"partial last chunk", types.Config{StartBlock: 5, EndBlock: 98, ChunkBlocks: 10, Concurrency: 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeSource(tt.cfg.StartBlock, tt.cfg.EndBlock, 3)
+			// Later chunks tend to finish first
+			client.delay = func(low uint64) time.Duration {
+				return time.Duration((low*7)%5) * time.Millisecond
+			}
+
+			var emitted []chunkResult
+			err := runChunkPool(context.Background(), client, tt.cfg, func(res chunkResult) error {
+				emitted = append(emitted, res)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("runChunkPool: %v", err)
+			}
+
+			next := tt.cfg.StartBlock
+			txs := 0
+			for i, res := range emitted {
+				if res.err != nil {
+					t.Fatalf("chunk %d: %v", i, res.err)
+				}
+				if res.job.seq != uint64(i) || res.job.low != next || res.job.high < res.job.low {
+					t.Fatalf("chunk %d is seq %d [%d..%d], want seq %d from block %d",
+						i, res.job.seq, res.job.low, res.job.high, i, next)
+				}
+				for _, tx := range res.txs {
+					if tx.Block < res.job.low || tx.Block > res.job.high {
+						t.Fatalf("chunk [%d..%d] has a tx of block %d", res.job.low, res.job.high, tx.Block)
+					}
+				}
+				txs += len(res.txs)
+				next = res.job.high + 1
+			}
+			if next != tt.cfg.EndBlock+1 {
+				t.Errorf("chunks end at block %d, want %d", next-1, tt.cfg.EndBlock)
+			}
+			if txs != len(client.txs) {
+				t.Errorf("%d txs emitted, want %d", txs, len(client.txs))
+			}
+		})
+	}
+}
+
+func TestRunChunkPoolStopsOnEmitError(t *testing.T) {
+	cfg := types.Config{StartBlock: 1, EndBlock: 500, ChunkBlocks: 10, Concurrency: 4}
+	stop := errors.New("stop")
+
+	var emitted int
+	err := runChunkPool(context.Background(), newFakeSource(1, 500, 1), cfg, func(res chunkResult) error {
+		emitted++
+		if emitted == 3 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) {
+		t.Fatalf("runChunkPool() = %v, want %v", err, stop)
+	}
+	if emitted != 3 {
+		t.Errorf("%d chunks emitted, want 3", emitted)
+	}
+}
+
+func TestRunTradesPoolEmitsInOrder(t *testing.T) {
+	failed := errors.New("failed")
+	tests := []struct {
+		name    string
+		workers int
+		skip    uint64
+		trades  uint64 // available from skip 0
+		failAt  uint64 // skip of a failing page, 0 for none
+
+		wantPages  int
+		wantTrades uint64
+		wantErr    error
+	}{
+		{name: "one worker", workers: 1, trades: 950, wantPages: 10, wantTrades: 950},
+		{name: "workers", workers: 4, trades: 950, wantPages: 10, wantTrades: 950},
+		{name: "ends with an empty page", workers: 4, trades: 1000, wantPages: 11, wantTrades: 1000},
+		{name: "from a skip", workers: 3, skip: 400, trades: 950, wantPages: 6, wantTrades: 550},
+		{name: "failing page", workers: 4, trades: 950, failAt: 300, wantPages: 4, wantTrades: 300, wantErr: failed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const pageSize = 100
+			fetch := func(ctx context.Context, skip uint64) ([]*derivativeExchangePB.DerivativeTrade, error) {
+				// Later pages tend to come back first
+				time.Sleep(time.Duration((skip/pageSize*7)%5) * time.Millisecond)
+				if tt.failAt != 0 && skip == tt.failAt {
+					return nil, failed
+				}
+				var trades []*derivativeExchangePB.DerivativeTrade
+				for i := skip; i < min(skip+pageSize, tt.trades); i++ {
+					trades = append(trades, &derivativeExchangePB.DerivativeTrade{TradeId: fmt.Sprint(i)})
+				}
+				return trades, nil
+			}
+
+			var pages int
+			next := tt.skip
+			err := runTradesPool(context.Background(), tt.workers, tt.skip, pageSize, fetch, func(page tradesPage) (bool, error) {
+				pages++
+				if page.skip != next {
+					t.Fatalf("page at skip %d, want %d", page.skip, next)
+				}
+				if page.err != nil {
+					return true, page.err
+				}
+				for i, trade := range page.trades {
+					if want := fmt.Sprint(next + uint64(i)); trade.TradeId != want {
+						t.Fatalf("trade %s at skip %d, want %s", trade.TradeId, next+uint64(i), want)
+					}
+				}
+				next += uint64(len(page.trades))
+				return len(page.trades) < pageSize, nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("runTradesPool() = %v, want %v", err, tt.wantErr)
+			}
+			if pages != tt.wantPages {
+				t.Errorf("%d pages emitted, want %d", pages, tt.wantPages)
+			}
+			if got := next - tt.skip; got != tt.wantTrades {
+				t.Errorf("%d trades emitted, want %d", got, tt.wantTrades)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package position
+
+import "github.com/kprimice/challenge-week/pkg/scanner/types"
+
+// BlockBuffer collects records fed in block order and hands each block to apply once
+// it is complete, i.e. when a record of a later block arrives or on Flush. Book
+// needs whole blocks: funding is applied before the executions of its block.
+type BlockBuffer struct {
+	apply   func(records []types.CSVRecord) error
+	block   uint64
+	pending []types.CSVRecord
+}
+
+func NewBlockBuffer(apply func(records []types.CSVRecord) error) *BlockBuffer {
+	return &BlockBuffer{apply: apply}
+}
+
+// Add buffers rec, first applying the buffered block if rec starts a new one.
+func (b *BlockBuffer) Add(rec types.CSVRecord) error {
+	if rec.Block != b.block {
+		if err := b.Flush(); err != nil {
+			return err
+		}
+		b.block = rec.Block
+	}
+	b.pending = append(b.pending, rec)
+	return nil
+}
+
+// Flush applies the buffered block, if any. Only call it at a block boundary, e.g.
+// after a chunk or when the input is exhausted.
+func (b *BlockBuffer) Flush() error {
+	if len(b.pending) == 0 {
+		return nil
+	}
+	records := b.pending
+	b.pending = nil
+	return b.apply(records)
+}
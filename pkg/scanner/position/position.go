@@ -0,0 +1,237 @@
+package position
+
+import (
+	"fmt"
+	"log"
+
+	sdkmath "cosmossdk.io/math"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+// Key identifies the position of a subaccount in a derivative market.
+type Key struct {
+	SubaccountID string
+	MarketID     string
+}
+
+// Position is the state of one position, as the chain keeps it.
+type Position struct {
+	Quantity   sdkmath.LegacyDec // signed: > 0 long, < 0 short, 0 closed
+	EntryPrice sdkmath.LegacyDec
+	Margin     sdkmath.LegacyDec
+
+	// Totals since the position was first seen, kept across closes
+	RealizedPnl  sdkmath.LegacyDec
+	Funding      sdkmath.LegacyDec // > 0 received, < 0 paid
+	Liquidations int
+}
+
+// Payment is the funding one position paid or received at a funding update.
+type Payment struct {
+	Key
+	Quantity sdkmath.LegacyDec // signed size at the update
+	Delta    sdkmath.LegacyDec // change of the market's cumulative funding
+	Amount   sdkmath.LegacyDec // > 0 received, < 0 paid
+}
+
+// Book holds the position of every subaccount and market, rebuilt from the
+// EXECUTION and FUNDING records of a scan the way the exchange module applies
+// position deltas and funding. Positions opened before the first record it sees
+// are unknown to it, and the margin only counts what was added by fills and
+// funding (not margin added or removed by hand).
+type Book struct {
+	positions map[Key]*Position
+
+	// cumulative is the last cumulative funding of each market
+	cumulative map[string]sdkmath.LegacyDec
+}
+
+func NewBook() *Book {
+	return &Book{
+		positions:  make(map[Key]*Position),
+		cumulative: make(map[string]sdkmath.LegacyDec),
+	}
+}
+
+// ApplyBlock applies the records of one block: FUNDING records first (funding is
+// paid in the BeginBlocker), then the executions in order. Other records are
+// ignored. It returns the funding payments.
+func (b *Book) ApplyBlock(records []types.CSVRecord) ([]Payment, error) {
+	var payments []Payment
+	for _, rec := range records {
+		if rec.Action != "FUNDING" {
+			continue
+		}
+		p, err := b.Fund(rec)
+		if err != nil {
+			return payments, err
+		}
+		payments = append(payments, p...)
+	}
+	for _, rec := range records {
+		if err := b.Apply(rec); err != nil {
+			return payments, err
+		}
+	}
+	return payments, nil
+}
+
+// Apply adds a derivative EXECUTION record to the position of its subaccount.
+// Other records are ignored.
+func (b *Book) Apply(rec types.CSVRecord) error {
+	if rec.Action != "EXECUTION" || rec.MarketType == types.MarketSpot {
+		return nil
+	}
+	qty, err := dec(rec.ExecQuantity)
+	if err != nil {
+		return fmt.Errorf("bad quantity %q in block %d: %w", rec.ExecQuantity, rec.Block, err)
+	}
+	price, err := dec(rec.ExecPrice)
+	if err != nil {
+		return fmt.Errorf("bad price %q in block %d: %w", rec.ExecPrice, rec.Block, err)
+	}
+	margin, err := dec(rec.ExecMargin)
+	if err != nil {
+		return fmt.Errorf("bad margin %q in block %d: %w", rec.ExecMargin, rec.Block, err)
+	}
+	if !qty.IsPositive() {
+		return nil
+	}
+
+	pos := b.position(Key{SubaccountID: rec.SubaccountID, MarketID: rec.MarketID})
+	size := qty
+	if !rec.IsBuy {
+		size = qty.Neg()
+	}
+
+	// 1) Opening, or adding in the same direction: average the entry price
+	if pos.Quantity.IsZero() || pos.Quantity.IsPositive() == rec.IsBuy {
+		held := pos.Quantity.Abs()
+		pos.EntryPrice = held.Mul(pos.EntryPrice).Add(qty.Mul(price)).Quo(held.Add(qty))
+		pos.Quantity = pos.Quantity.Add(size)
+		pos.Margin = pos.Margin.Add(margin)
+		return nil
+	}
+
+	// 2) Opposite direction: close up to the position size, releasing its margin pro rata
+	held := pos.Quantity.Abs()
+	closing := sdkmath.LegacyMinDec(held, qty)
+	pnl := price.Sub(pos.EntryPrice).Mul(closing)
+	if pos.Quantity.IsNegative() {
+		pnl = pnl.Neg()
+	}
+	if chainPnl, err := sdkmath.LegacyNewDecFromStr(rec.Pnl); err == nil {
+		pnl = chainPnl // the chain's own figure, when the event has it
+	}
+	pos.RealizedPnl = pos.RealizedPnl.Add(pnl)
+	pos.Margin = pos.Margin.Sub(pos.Margin.Mul(closing).Quo(held))
+	if pos.Quantity.IsPositive() {
+		pos.Quantity = pos.Quantity.Sub(closing)
+	} else {
+		pos.Quantity = pos.Quantity.Add(closing)
+	}
+	if rec.IsLiquidation {
+		pos.Liquidations++
+	}
+	if pos.Quantity.IsZero() {
+		pos.EntryPrice, pos.Margin = sdkmath.LegacyZeroDec(), sdkmath.LegacyZeroDec()
+	}
+
+	// 3) ... and open the rest the other way (a flip), with the rest of the fill's margin
+	if rest := qty.Sub(closing); rest.IsPositive() {
+		if !rec.IsBuy {
+			rest = rest.Neg()
+		}
+		pos.Quantity = rest
+		pos.EntryPrice = price
+		pos.Margin = margin.Mul(rest.Abs()).Quo(qty)
+	}
+	return nil
+}
+
+// Fund applies a FUNDING record to the open positions of its market and returns
+// what each paid or received. The first update of a market only sets its baseline.
+func (b *Book) Fund(rec types.CSVRecord) ([]Payment, error) {
+	cumulative, err := sdkmath.LegacyNewDecFromStr(rec.CumulativeFunding)
+	if err != nil {
+		return nil, fmt.Errorf("bad cumulative funding %q in block %d: %w", rec.CumulativeFunding, rec.Block, err)
+	}
+	prev, ok := b.cumulative[rec.MarketID]
+	b.cumulative[rec.MarketID] = cumulative
+	if !ok {
+		log.Printf("[Funding] First update of market %s at block %d => baseline %s",
+			rec.MarketID, rec.Block, cumulative)
+		return nil, nil
+	}
+
+	delta := cumulative.Sub(prev)
+	if delta.IsZero() {
+		return nil, nil
+	}
+	var payments []Payment
+	for _, key := range b.Open(rec.MarketID) {
+		pos := b.positions[key]
+		amount := pos.Quantity.Mul(delta).Neg() // longs pay a rising cumulative funding
+		pos.Margin = pos.Margin.Add(amount)
+		pos.Funding = pos.Funding.Add(amount)
+		payments = append(payments, Payment{Key: key, Quantity: pos.Quantity, Delta: delta, Amount: amount})
+	}
+	return payments, nil
+}
+
+// CumulativeFunding returns the last cumulative funding seen for marketID, 0 if none.
+func (b *Book) CumulativeFunding(marketID string) sdkmath.LegacyDec {
+	if c, ok := b.cumulative[marketID]; ok {
+		return c
+	}
+	return sdkmath.LegacyZeroDec()
+}
+
+// Get returns the position of key, if it was ever seen.
+func (b *Book) Get(key Key) (Position, bool) {
+	pos, ok := b.positions[key]
+	if !ok {
+		return Position{}, false
+	}
+	return *pos, true
+}
+
+// Quantity returns the signed size of a position: > 0 long, < 0 short, 0 closed.
+func (b *Book) Quantity(key Key) sdkmath.LegacyDec {
+	if pos, ok := b.positions[key]; ok {
+		return pos.Quantity
+	}
+	return sdkmath.LegacyZeroDec()
+}
+
+// Open returns the keys of the open positions in marketID (every market if ""),
+// sorted by market and subaccount.
+func (b *Book) Open(marketID string) []Key {
+	var keys []Key
+	for key, pos := range b.positions {
+		if !pos.Quantity.IsZero() && (marketID == "" || key.MarketID == marketID) {
+			keys = append(keys, key)
+		}
+	}
+	sortKeys(keys)
+	return keys
+}
+
+func (b *Book) position(key Key) *Position {
+	pos, ok := b.positions[key]
+	if !ok {
+		zero := sdkmath.LegacyZeroDec()
+		pos = &Position{Quantity: zero, EntryPrice: zero, Margin: zero, RealizedPnl: zero, Funding: zero}
+		b.positions[key] = pos
+	}
+	return pos
+}
+
+// dec parses a decimal field, "" being 0.
+func dec(s string) (sdkmath.LegacyDec, error) {
+	if s == "" {
+		return sdkmath.LegacyZeroDec(), nil
+	}
+	return sdkmath.LegacyNewDecFromStr(s)
+}
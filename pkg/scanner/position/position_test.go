@@ -0,0 +1,189 @@
+package position
+
+import (
+	"testing"
+
+	sdkmath "cosmossdk.io/math"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+var key = Key{SubaccountID: "0xsub", MarketID: "0xmarket"}
+
+func fill(isBuy bool, qty, price, margin string) types.CSVRecord {
+	return types.CSVRecord{
+		Action:       "EXECUTION",
+		MarketType:   types.MarketDerivative,
+		MarketID:     key.MarketID,
+		SubaccountID: key.SubaccountID,
+		IsBuy:        isBuy,
+		ExecQuantity: qty,
+		ExecPrice:    price,
+		ExecMargin:   margin,
+	}
+}
+
+func buy(qty, price, margin string) types.CSVRecord  { return fill(true, qty, price, margin) }
+func sell(qty, price, margin string) types.CSVRecord { return fill(false, qty, price, margin) }
+
+func funding(cumulative string) types.CSVRecord {
+	return types.CSVRecord{Action: "FUNDING", MarketID: key.MarketID, CumulativeFunding: cumulative}
+}
+
+func TestBookApplyBlock(t *testing.T) {
+	tests := []struct {
+		name   string
+		blocks [][]types.CSVRecord
+
+		// want is Quantity, EntryPrice, Margin, RealizedPnl, Funding; nil if the
+		// position was never opened
+		want         []string
+		liquidations int
+		wantErr      bool
+	}{
+		{
+			name:   "open",
+			blocks: [][]types.CSVRecord{{buy("2", "100", "50")}},
+			want:   []string{"2", "100", "50", "0", "0"},
+		},
+		{
+			name:   "increase averages the entry price",
+			blocks: [][]types.CSVRecord{{buy("2", "100", "50")}, {buy("2", "110", "60")}},
+			want:   []string{"4", "105", "110", "0", "0"},
+		},
+		{
+			name:   "reduce releases margin pro rata",
+			blocks: [][]types.CSVRecord{{buy("2", "100", "50"), buy("2", "110", "60")}, {sell("1", "120", "0")}},
+			want:   []string{"3", "105", "82.5", "15", "0"},
+		},
+		{
+			name:   "close a short",
+			blocks: [][]types.CSVRecord{{sell("2", "100", "40")}, {buy("2", "90", "0")}},
+			want:   []string{"0", "0", "0", "20", "0"},
+		},
+		{
+			name:   "flip opens the rest with the rest of the margin",
+			blocks: [][]types.CSVRecord{{buy("2", "100", "50")}, {sell("5", "120", "20")}},
+			want:   []string{"-3", "120", "12", "40", "0"},
+		},
+		{
+			name: "chain pnl wins",
+			blocks: [][]types.CSVRecord{{buy("2", "100", "50")}, {func() types.CSVRecord {
+				rec := sell("2", "120", "0")
+				rec.Pnl = "37.5"
+				return rec
+			}()}},
+			want: []string{"0", "0", "0", "37.5", "0"},
+		},
+		{
+			name: "liquidation",
+			blocks: [][]types.CSVRecord{{buy("2", "100", "50")}, {func() types.CSVRecord {
+				rec := sell("1", "80", "0")
+				rec.IsLiquidation = true
+				return rec
+			}()}},
+			want:         []string{"1", "100", "25", "-20", "0"},
+			liquidations: 1,
+		},
+		{
+			name:   "long pays a rising funding",
+			blocks: [][]types.CSVRecord{{funding("1")}, {buy("3", "100", "90")}, {funding("1.5")}},
+			want:   []string{"3", "100", "88.5", "0", "-1.5"},
+		},
+		{
+			name:   "short receives a rising funding",
+			blocks: [][]types.CSVRecord{{funding("1")}, {sell("2", "100", "40")}, {funding("1.5")}},
+			want:   []string{"-2", "100", "41", "0", "1"},
+		},
+		{
+			name:   "first funding update is only a baseline",
+			blocks: [][]types.CSVRecord{{buy("3", "100", "90")}, {funding("1.5")}},
+			want:   []string{"3", "100", "90", "0", "0"},
+		},
+		{
+			name:   "funding before the fills of its block",
+			blocks: [][]types.CSVRecord{{funding("1")}, {buy("3", "100", "90"), funding("2")}},
+			want:   []string{"3", "100", "90", "0", "0"},
+		},
+		{
+			name: "spot fills and other actions are ignored",
+			blocks: [][]types.CSVRecord{{func() types.CSVRecord {
+				rec := buy("2", "100", "50")
+				rec.MarketType = types.MarketSpot
+				return rec
+			}(), {Action: "NEW_ORDER", MarketID: key.MarketID, SubaccountID: key.SubaccountID}}},
+		},
+		{
+			name:    "bad price",
+			blocks:  [][]types.CSVRecord{{buy("2", "abc", "50")}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := NewBook()
+			for _, records := range tt.blocks {
+				if _, err := book.ApplyBlock(records); err != nil {
+					if !tt.wantErr {
+						t.Fatalf("ApplyBlock: %v", err)
+					}
+					return
+				}
+			}
+			if tt.wantErr {
+				t.Fatal("ApplyBlock succeeded, want an error")
+			}
+
+			pos, ok := book.Get(key)
+			if tt.want == nil {
+				if ok {
+					t.Fatalf("position %+v, want none", pos)
+				}
+				return
+			}
+			if !ok {
+				t.Fatal("no position")
+			}
+			got := []sdkmath.LegacyDec{pos.Quantity, pos.EntryPrice, pos.Margin, pos.RealizedPnl, pos.Funding}
+			for i, field := range []string{"Quantity", "EntryPrice", "Margin", "RealizedPnl", "Funding"} {
+				want := sdkmath.LegacyMustNewDecFromStr(tt.want[i])
+				if !got[i].Equal(want) {
+					t.Errorf("%s = %s, want %s", field, got[i], want)
+				}
+			}
+			if pos.Liquidations != tt.liquidations {
+				t.Errorf("Liquidations = %d, want %d", pos.Liquidations, tt.liquidations)
+			}
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	position := func(qty string, liquidations int) Position {
+		return Position{Quantity: sdkmath.LegacyMustNewDecFromStr(qty), Liquidations: liquidations}
+	}
+	tests := []struct {
+		name          string
+		before, after Position
+		traded        bool
+		want          string
+	}{
+		{"funding only", position("2", 0), position("2", 0), false, "FUNDING"},
+		{"new position", Position{}, position("2", 0), true, "OPEN"},
+		{"reopened", position("0", 0), position("-1", 0), true, "OPEN"},
+		{"opened and closed", Position{}, position("0", 0), true, "CLOSE"},
+		{"closed", position("2", 0), position("0", 0), true, "CLOSE"},
+		{"flipped", position("2", 0), position("-1", 0), true, "FLIP"},
+		{"increased", position("-2", 0), position("-3", 0), true, "INCREASE"},
+		{"reduced", position("-2", 0), position("-1", 0), true, "REDUCE"},
+		{"liquidated", position("2", 0), position("1", 1), true, "LIQUIDATION"},
+		{"traded both ways", position("2", 0), position("2", 0), true, "TRADE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classify(tt.before, tt.after, tt.traded); got != tt.want {
+				t.Errorf("classify() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package position
+
+import (
+	"sort"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/sink"
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+// Tracker follows every position of a scan through a Book and writes a snapshot of
+// each position changed by a block, then, on Close, a report of the positions still
+// open. It is a sink.Sink (and sink.FundingSink): put it next to the scan output with
+// sink.NewTee, or replay a scan through it with sink.Write, in block order either way.
+type Tracker struct {
+	book      *Book
+	snapshots sink.PositionSink // nil: no per-block snapshots
+	report    sink.PositionSink // nil: no open-positions report
+
+	blocks *BlockBuffer
+	// block and timestamp are those of the last block applied
+	block     uint64
+	timestamp string
+
+	Snapshots int64
+}
+
+// NewTracker returns a Tracker writing to snapshots and report, either of which may
+// be nil. Closing it closes them.
+func NewTracker(snapshots, report sink.PositionSink) *Tracker {
+	t := &Tracker{book: NewBook(), snapshots: snapshots, report: report}
+	t.blocks = NewBlockBuffer(t.applyBlock)
+	return t
+}
+
+// Book returns the positions applied so far.
+func (t *Tracker) Book() *Book {
+	return t.book
+}
+
+func (t *Tracker) WriteOrder(rec types.CSVRecord) error {
+	return nil // orders do not move positions
+}
+
+func (t *Tracker) WriteTrade(rec types.CSVRecord) error {
+	return t.blocks.Add(rec)
+}
+
+func (t *Tracker) WriteFunding(rec types.CSVRecord) error {
+	return t.blocks.Add(rec)
+}
+
+// applyBlock applies the records of one block and writes a snapshot of each
+// position they changed.
+func (t *Tracker) applyBlock(records []types.CSVRecord) error {
+	t.block, t.timestamp = records[0].Block, records[0].BlockTimestamp
+
+	// 1) The positions the block touches, as they were before it
+	before := make(map[Key]Position)
+	traded := make(map[Key]bool)
+	for _, rec := range records {
+		switch {
+		case rec.Action == "FUNDING":
+			for _, key := range t.book.Open(rec.MarketID) {
+				before[key], _ = t.book.Get(key)
+			}
+		case rec.Action == "EXECUTION" && rec.MarketType != types.MarketSpot:
+			key := Key{SubaccountID: rec.SubaccountID, MarketID: rec.MarketID}
+			if _, ok := before[key]; !ok {
+				before[key], _ = t.book.Get(key)
+			}
+			traded[key] = true
+		}
+	}
+
+	// 2) Apply it
+	if _, err := t.book.ApplyBlock(records); err != nil {
+		return err
+	}
+	if t.snapshots == nil {
+		return nil
+	}
+
+	// 3) One snapshot per touched position, in a stable order
+	keys := make([]Key, 0, len(before))
+	for key := range before {
+		keys = append(keys, key)
+	}
+	sortKeys(keys)
+	for _, key := range keys {
+		after, _ := t.book.Get(key)
+		change := classify(before[key], after, traded[key])
+		if err := t.snapshots.WritePositionSnapshot(t.snapshot(key, after, change)); err != nil {
+			return err
+		}
+		t.Snapshots++
+	}
+	return nil
+}
+
+// classify names what a block did to a position, from its state before and after.
+func classify(before, after Position, traded bool) string {
+	was, is := before.Quantity, after.Quantity
+	switch {
+	case !traded:
+		return "FUNDING"
+	case after.Liquidations > before.Liquidations:
+		return "LIQUIDATION"
+	case was.IsNil() || was.IsZero():
+		if is.IsZero() {
+			return "CLOSE" // opened and closed within the block
+		}
+		return "OPEN"
+	case is.IsZero():
+		return "CLOSE"
+	case was.IsPositive() != is.IsPositive():
+		return "FLIP"
+	case is.Abs().GT(was.Abs()):
+		return "INCREASE"
+	case is.Abs().LT(was.Abs()):
+		return "REDUCE"
+	}
+	return "TRADE" // traded both ways, same size at the end
+}
+
+func (t *Tracker) snapshot(key Key, pos Position, change string) types.PositionSnapshot {
+	return types.PositionSnapshot{
+		Block:          t.block,
+		BlockTimestamp: t.timestamp,
+		SubaccountID:   key.SubaccountID,
+		MarketID:       key.MarketID,
+		Change:         change,
+		Quantity:       pos.Quantity.String(),
+		EntryPrice:     pos.EntryPrice.String(),
+		Margin:         pos.Margin.String(),
+		RealizedPnl:    pos.RealizedPnl.String(),
+		Funding:        pos.Funding.String(),
+		Liquidations:   pos.Liquidations,
+	}
+}
+
+// Flush applies the current block and flushes the snapshots. Only call it at a block
+// boundary, e.g. after a chunk.
+func (t *Tracker) Flush() error {
+	if err := t.blocks.Flush(); err != nil {
+		return err
+	}
+	if t.snapshots == nil {
+		return nil
+	}
+	return t.snapshots.Flush()
+}
+
+// Close applies the last block, writes an END row per open position to the report
+// (as of the last block seen) and closes both outputs.
+func (t *Tracker) Close() error {
+	err := t.Flush()
+	if err == nil && t.report != nil {
+		for _, key := range t.book.Open("") {
+			pos, _ := t.book.Get(key)
+			if err = t.report.WritePositionSnapshot(t.snapshot(key, pos, "END")); err != nil {
+				break
+			}
+		}
+	}
+	for _, out := range []sink.PositionSink{t.snapshots, t.report} {
+		if out == nil {
+			continue
+		}
+		if cerr := out.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// sortKeys sorts keys by market and subaccount.
+func sortKeys(keys []Key) {
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].MarketID != keys[j].MarketID {
+			return keys[i].MarketID < keys[j].MarketID
+		}
+		return keys[i].SubaccountID < keys[j].SubaccountID
+	})
+}
@@ -0,0 +1,140 @@
+// Package ratelimit paces outgoing RPC calls with a token bucket that slows down
+// when the server says we are going too fast.
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// recoverEvery is how long the rate has to go without a rate-limit error
+	// before it is raised again, by recoverFactor, up to the configured rate.
+	recoverEvery  = 10 * time.Second
+	recoverFactor = 1.25
+
+	// Several calls in flight usually hit the limit together; they count as one.
+	slowDownGap = time.Second
+)
+
+// Limiter is a token bucket shared by every caller: tokens come in at the
+// current rate, up to burst, and each call takes one. A nil *Limiter does not limit.
+type Limiter struct {
+	mu sync.Mutex
+
+	max     float64 // configured rate, req/s
+	min     float64 // the rate is never slowed down below this
+	rate    float64 // current rate
+	burst   float64
+	tokens  float64 // may go negative: calls queued behind the bucket
+	last    time.Time
+	changed time.Time // last slow-down or recovery step
+}
+
+// New returns a limiter allowing rps calls per second on average and bursts of
+// up to burst calls. rps <= 0 means no limit and returns nil.
+func New(rps float64, burst int) *Limiter {
+	if rps <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	now := time.Now()
+	return &Limiter{
+		max:     rps,
+		min:     rps / 32,
+		rate:    rps,
+		burst:   float64(burst),
+		tokens:  float64(burst),
+		last:    now,
+		changed: now,
+	}
+}
+
+// Wait blocks until the caller may send a call, or ctx is done.
+func (l *Limiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.advance(now)
+	l.tokens--
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if wait == 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		// Give the token back so the calls queued behind us don't wait for it
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// SlowDown halves the rate after the server returned a rate-limit error. It
+// climbs back to the configured rate once the errors stop.
+func (l *Limiter) SlowDown() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.advance(now)
+	if now.Sub(l.changed) < slowDownGap && l.rate < l.max {
+		return
+	}
+	l.rate = max(l.rate/2, l.min)
+	l.tokens = min(l.tokens, 0) // drop the burst too
+	l.changed = now
+	log.Printf("[RateLimit] Server is throttling us => slowing down to %.2f req/s", l.rate)
+}
+
+// Rate returns the current rate in calls per second.
+func (l *Limiter) Rate() float64 {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.advance(time.Now())
+	return l.rate
+}
+
+// advance refills the bucket up to now and raises a slowed-down rate back step
+// by step. l.mu must be held.
+func (l *Limiter) advance(now time.Time) {
+	for l.rate < l.max && now.Sub(l.changed) >= recoverEvery {
+		l.refill(l.changed.Add(recoverEvery))
+		l.changed = l.changed.Add(recoverEvery)
+		l.rate = min(l.rate*recoverFactor, l.max)
+		if l.rate == l.max {
+			log.Printf("[RateLimit] Back to %.2f req/s", l.rate)
+		}
+	}
+	l.refill(now)
+}
+
+func (l *Limiter) refill(now time.Time) {
+	if now.After(l.last) {
+		l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, l.burst)
+		l.last = now
+	}
+}
@@ -0,0 +1,128 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// elapse moves l's clock readings back by d, as if d had gone by.
+func elapse(l *Limiter, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.last = l.last.Add(-d)
+	l.changed = l.changed.Add(-d)
+}
+
+func TestNilLimiter(t *testing.T) {
+	l := New(0, 10)
+	if l != nil {
+		t.Fatalf("New(0, 10) = %+v, want nil", l)
+	}
+	l.SlowDown()
+	if err := l.Wait(context.Background()); err != nil {
+		t.Errorf("Wait = %v", err)
+	}
+	if got := l.Rate(); got != 0 {
+		t.Errorf("Rate = %v, want 0", got)
+	}
+}
+
+func TestWait(t *testing.T) {
+	l := New(10, 3)
+
+	// The burst goes through at once, the next call waits for a token (100ms)
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		err := l.Wait(ctx)
+		cancel()
+		if err != nil {
+			t.Fatalf("call %d of the burst: %v", i+1, err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("call past the burst = %v, want context.DeadlineExceeded", err)
+	}
+
+	// The abandoned call gave its token back, so a token later one call goes through
+	elapse(l, 100*time.Millisecond)
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); err != nil {
+		t.Errorf("call after a refill: %v", err)
+	}
+}
+
+func TestSlowDown(t *testing.T) {
+	tests := []struct {
+		name string
+		// slowDowns are SlowDown calls, each gap apart
+		slowDowns int
+		gap       time.Duration
+		want      float64
+	}{
+		{name: "halves the rate", slowDowns: 1, want: 500},
+		{name: "errors of one burst count once", slowDowns: 3, gap: 0, want: 500},
+		{name: "spaced errors halve again", slowDowns: 3, gap: slowDownGap, want: 125},
+		{name: "never below rps/32", slowDowns: 10, gap: slowDownGap, want: 1000.0 / 32},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := New(1000, 100)
+			for i := 0; i < tt.slowDowns; i++ {
+				if i > 0 {
+					elapse(l, tt.gap)
+				}
+				l.SlowDown()
+			}
+			l.mu.Lock()
+			tokens := l.tokens
+			l.mu.Unlock()
+			if tokens >= 1 { // a little may have come back since
+				t.Errorf("%v tokens left, want the burst dropped", tokens)
+			}
+			if got := l.Rate(); got != tt.want {
+				t.Errorf("Rate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		want    float64
+	}{
+		{name: "too soon", elapsed: recoverEvery - time.Second, want: 500},
+		{name: "one step", elapsed: recoverEvery, want: 625},
+		{name: "two steps", elapsed: 2 * recoverEvery, want: 781.25},
+		{name: "three steps", elapsed: 3*recoverEvery + time.Second, want: 976.5625},
+		{name: "capped at the configured rate", elapsed: 4 * recoverEvery, want: 1000},
+		{name: "long quiet spell", elapsed: time.Hour, want: 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := New(1000, 100)
+			l.SlowDown()
+			elapse(l, tt.elapsed)
+			if got := l.Rate(); got != tt.want {
+				t.Errorf("Rate after %s = %v, want %v", tt.elapsed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecoveryRestartsOnSlowDown(t *testing.T) {
+	l := New(1000, 100)
+	l.SlowDown()
+	elapse(l, recoverEvery+slowDownGap) // back to 625
+	l.SlowDown()                        // 312.5, and the recovery starts over
+	elapse(l, recoverEvery-time.Second)
+	if got := l.Rate(); got != 312.5 {
+		t.Errorf("Rate = %v, want 312.5", got)
+	}
+}
@@ -0,0 +1,383 @@
+package scanner
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/archive"
+	"github.com/kprimice/challenge-week/pkg/scanner/retry"
+	"github.com/kprimice/challenge-week/pkg/scanner/sink"
+	"github.com/kprimice/challenge-week/pkg/scanner/source"
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+// RedriveConfig configures RunRedrive
+type RedriveConfig struct {
+	MarketID   string
+	LedgerPath string
+	OrdersPath string
+	TradesPath string
+
+	// MarketType is the scan's Config.MarketType. When it keeps spot records they
+	// are merged into SpotOrdersPath and SpotTradesPath.
+	MarketType     string
+	SpotOrdersPath string
+	SpotTradesPath string
+
+	// ConditionalOrdersPath and FundingPath (optional) are where conditional orders
+	// and funding updates of derivative markets are merged, when the scan wrote them.
+	ConditionalOrdersPath string
+	FundingPath           string
+
+	// Verify checks recovered chunks against per-block tx counts (see Config.Verify).
+	// Blocks that are still incomplete go back into the ledger.
+	Verify bool
+
+	// Network selects the network and endpoints (default mainnet).
+	Network source.NetworkConfig
+	// Source is where chunks are re-fetched from (default: the Network's Explorer).
+	Source source.TxSource
+	// Retry is how failed calls are retried (see Config.Retry).
+	Retry retry.Policy
+
+	// BlockEvents also recovers block events, for scans run with Config.BlockEvents.
+	BlockEvents bool
+	TmEndpoint  string
+
+	// ArchiveDir (optional) is the raw tx archive of the scan (see Config.ArchiveDir).
+	// Recovered chunks are added to it.
+	ArchiveDir string
+
+	// CheckpointPath (optional) is the checkpoint of the scan that wrote the CSVs.
+	// Its offsets are moved to the end of the merged files so -resume keeps working.
+	CheckpointPath string
+
+	// Out (optional) receives the recovered records instead of the CSVs, for scans
+	// written to a sink that upserts (sink.SQLite): rows a chunk already had (see
+	// FailedChunk.Kept) are updated in place. The CSV paths and CheckpointPath are
+	// then unused. RunRedrive flushes Out but does not close it.
+	Out sink.Sink
+}
+
+// RunRedrive re-fetches every chunk in the ledger and merges the recovered rows into
+// the orders and trades CSVs, keeping them sorted by block, or writes them to cfg.Out.
+// Chunks that fail again stay in the ledger; an empty ledger afterwards means the
+// output has no holes.
+//
+// Cancelling ctx stops it between chunks: what was recovered so far is merged, the
+// rest stays in the ledger, and ctx's error is returned.
+func RunRedrive(ctx context.Context, cfg RedriveConfig) error {
+	entries, err := LoadLedger(cfg.LedgerPath)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		log.Printf("Ledger %s is empty => nothing to re-drive.", cfg.LedgerPath)
+		return nil
+	}
+
+	if err := types.CheckMarketType(cfg.MarketType); err != nil {
+		return err
+	}
+
+	// Output CSVs by checkpoint Position key (see sink.CSV), unless writing to cfg.Out
+	paths := map[string]string{}
+	if cfg.Out == nil {
+		paths["orders"], paths["trades"] = cfg.OrdersPath, cfg.TradesPath
+		if types.KeepMarketType(cfg.MarketType, types.MarketSpot) {
+			paths["spot_orders"], paths["spot_trades"] = cfg.SpotOrdersPath, cfg.SpotTradesPath
+		}
+		if types.KeepMarketType(cfg.MarketType, types.MarketDerivative) {
+			if cfg.ConditionalOrdersPath != "" {
+				paths["conditional_orders"] = cfg.ConditionalOrdersPath
+			}
+			if cfg.FundingPath != "" {
+				paths["funding"] = cfg.FundingPath
+			}
+		}
+	}
+
+	// The merge rewrites the files, so they must not have rows past the checkpoint
+	var cp *Checkpoint
+	if cfg.CheckpointPath != "" && cfg.Out == nil {
+		if cp, err = LoadCheckpoint(cfg.CheckpointPath); err != nil {
+			return err
+		}
+		if cp != nil {
+			for key, path := range paths {
+				if err := checkFileSize(path, cp.Offsets[key]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	network, err := cfg.Network.Load()
+	if err != nil {
+		return err
+	}
+	client := cfg.Source
+	if client == nil {
+		explorer, err := source.NewExplorer(network)
+		if err != nil {
+			return err
+		}
+		client = explorer
+	}
+
+	chunkCfg := types.Config{
+		MarketID:          cfg.MarketID,
+		Verify:            cfg.Verify,
+		RefetchMismatched: true,
+		BlockEvents:       cfg.BlockEvents,
+		TmEndpoint:        cfg.TmEndpoint,
+		Retry:             cfg.Retry,
+		MarketType:        cfg.MarketType,
+	}
+	if chunkCfg.BlockEvents && chunkCfg.TmEndpoint == "" {
+		chunkCfg.TmEndpoint = network.TmEndpoint
+	}
+
+	var arch *archive.Writer
+	if cfg.ArchiveDir != "" {
+		if arch, err = archive.NewWriter(cfg.ArchiveDir); err != nil {
+			return fmt.Errorf("failed to open archive: %w", err)
+		}
+	}
+
+	log.Printf("Re-driving %d failed chunk(s) from %s...", len(entries), cfg.LedgerPath)
+
+	// 1) Fetch every failed range again, oldest first
+	recovered := &sink.Memory{}
+	var target sink.Sink = recovered
+	if cfg.Out != nil {
+		target = cfg.Out
+	}
+	var replaced []blockRange
+	var remaining []FailedChunk
+	for i, fc := range entries {
+		job := chunkJob{seq: uint64(i), low: fc.Low, high: fc.High}
+		res := runChunk(ctx, client, chunkCfg, job)
+		if ctx.Err() != nil {
+			log.Printf("Stopped => %d of %d chunk(s) processed, the rest stay in the ledger.", i, len(entries))
+			remaining = append(remaining, entries[i:]...)
+			break
+		}
+		records, stats, mismatches, err := res.records, res.stats, res.mismatches, res.err
+		if err != nil {
+			log.Printf("Chunk [%d..%d] failed again: %v", fc.Low, fc.High, err)
+			fc.Partial = stats.pages > 0
+			fc.PagesFetched = stats.pages
+			fc.TxsFetched = stats.txs
+			fc.Error = err.Error()
+			fc.FailedAt = time.Now().UTC()
+			remaining = append(remaining, fc)
+			continue
+		}
+		for _, m := range mismatches {
+			remaining = append(remaining, m.asFailedChunk())
+		}
+		// Still short: merge what was found, but keep it in the ledger
+		if res.incomplete != nil {
+			remaining = append(remaining, *res.incomplete)
+		}
+		if arch != nil {
+			if err := arch.WriteChunk(fc.Low, fc.High, res.txs); err != nil {
+				return err
+			}
+		}
+
+		for _, rec := range records {
+			if err := sink.Write(target, rec); err != nil {
+				return err
+			}
+		}
+		replaced = append(replaced, blockRange{fc.Low, fc.High})
+		log.Printf("Recovered chunk [%d..%d]: %d txs, %d records", fc.Low, fc.High, stats.txs, len(records))
+	}
+
+	// 2) Merge the recovered rows into the existing files (cfg.Out has them already)
+	if cfg.Out != nil {
+		if err := cfg.Out.Flush(); err != nil {
+			return fmt.Errorf("failed to flush output: %w", err)
+		}
+	}
+	rows := map[string][][]string{}
+	for _, rec := range recovered.Orders {
+		rows["orders"] = append(rows["orders"], rec.AsOrderRow())
+	}
+	for _, rec := range recovered.Trades {
+		rows["trades"] = append(rows["trades"], rec.AsTradeRow())
+	}
+	for _, rec := range recovered.SpotOrders {
+		rows["spot_orders"] = append(rows["spot_orders"], rec.AsSpotOrderRow())
+	}
+	for _, rec := range recovered.SpotTrades {
+		rows["spot_trades"] = append(rows["spot_trades"], rec.AsSpotTradeRow())
+	}
+	for _, rec := range recovered.Conditionals {
+		rows["conditional_orders"] = append(rows["conditional_orders"], rec.AsConditionalRow())
+	}
+	for _, rec := range recovered.Fundings {
+		rows["funding"] = append(rows["funding"], rec.AsFundingRow())
+	}
+	offsets := sink.Position{}
+	for key, path := range paths {
+		size, err := mergeCSVByBlock(path, rows[key], replaced)
+		if err != nil {
+			return fmt.Errorf("failed to merge %s: %w", strings.ReplaceAll(key, "_", " "), err)
+		}
+		offsets[key] = size
+	}
+	if cp != nil {
+		cp.Offsets = offsets
+		if err := cp.Save(cfg.CheckpointPath); err != nil {
+			return err
+		}
+	}
+
+	// 3) Only the chunks that failed again stay in the ledger
+	if err := RewriteLedger(cfg.LedgerPath, remaining); err != nil {
+		return fmt.Errorf("failed to rewrite ledger: %w", err)
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	log.Printf("Re-drive done => %d ledger entries processed, %d still failing.",
+		len(entries), len(remaining))
+	if len(remaining) > 0 {
+		return fmt.Errorf("%d chunk(s) are still missing, see %s", len(remaining), cfg.LedgerPath)
+	}
+	return nil
+}
+
+// csvBlockColumn is the index of the "Block" column in every CSV of the CSV sink.
+const csvBlockColumn = 1
+
+// blockRange is an inclusive range of blocks.
+type blockRange struct {
+	low, high uint64
+}
+
+// inRanges reports whether block is in one of ranges.
+func inRanges(block uint64, ranges []blockRange) bool {
+	for _, r := range ranges {
+		if r.low <= block && block <= r.high {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeCSVByBlock inserts rows (sorted by block) into the CSV at path, which is itself
+// sorted by block, and returns the new file size. Rows of path in the replaced ranges
+// are dropped first, so merging the same recovered chunk twice (e.g. one written
+// before a crash and still in the ledger) keeps its rows once. The result replaces
+// path atomically.
+func mergeCSVByBlock(path string, rows [][]string, replaced []blockRange) (int64, error) {
+	if len(rows) == 0 && len(replaced) == 0 {
+		info, err := os.Stat(path)
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	tmpPath := path + ".merge"
+	out, err := os.Create(tmpPath)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmpPath) // no-op once renamed
+
+	reader := csv.NewReader(in)
+	reader.FieldsPerRecord = -1
+	writer := csv.NewWriter(out)
+
+	// Header goes through untouched
+	header, err := reader.Read()
+	if err != nil {
+		out.Close()
+		return 0, fmt.Errorf("failed to read header of %s: %w", path, err)
+	}
+	writer.Write(header)
+
+	next := 0
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			out.Close()
+			return 0, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		block := rowBlock(row)
+		for next < len(rows) && rowBlock(rows[next]) < block {
+			writer.Write(rows[next])
+			next++
+		}
+		if inRanges(block, replaced) {
+			continue
+		}
+		writer.Write(row)
+	}
+	for ; next < len(rows); next++ {
+		writer.Write(rows[next])
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		out.Close()
+		return 0, err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return 0, err
+	}
+	size, err := fileOffset(out)
+	if err != nil {
+		out.Close()
+		return 0, err
+	}
+	if err := out.Close(); err != nil {
+		return 0, err
+	}
+	return size, os.Rename(tmpPath, path)
+}
+
+func rowBlock(row []string) uint64 {
+	if len(row) <= csvBlockColumn {
+		return 0
+	}
+	block, _ := strconv.ParseUint(row[csvBlockColumn], 10, 64)
+	return block
+}
+
+func checkFileSize(path string, want int64) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Size() != want {
+		return fmt.Errorf("%s is %d bytes but the checkpoint says %d; resume the scan before re-driving",
+			path, info.Size(), want)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package scanner
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/sink"
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+func TestMergeCSVByBlock(t *testing.T) {
+	const header = "TxHash,Block\n"
+	tests := []struct {
+		name     string
+		file     string // without the header
+		rows     [][]string
+		replaced []blockRange
+		want     string // without the header
+	}{
+		{
+			name: "nothing to merge",
+			file: "a,10\nb,20\n",
+			want: "a,10\nb,20\n",
+		},
+		{
+			name: "inserted in block order",
+			file: "a,10\nb,20\nc,30\n",
+			rows: [][]string{{"x", "15"}, {"y", "25"}},
+			want: "a,10\nx,15\nb,20\ny,25\nc,30\n",
+		},
+		{
+			name: "before the first and after the last row",
+			file: "a,10\nb,20\n",
+			rows: [][]string{{"x", "5"}, {"y", "40"}},
+			want: "x,5\na,10\nb,20\ny,40\n",
+		},
+		{
+			name: "after existing rows of the same block",
+			file: "a,10\nb,20\nc,30\n",
+			rows: [][]string{{"x", "20"}},
+			want: "a,10\nb,20\nx,20\nc,30\n",
+		},
+		{
+			name:     "replaced range merged again",
+			file:     "a,10\nx,20\ny,21\nc,30\n",
+			rows:     [][]string{{"x", "20"}, {"y", "21"}},
+			replaced: []blockRange{{20, 29}},
+			want:     "a,10\nx,20\ny,21\nc,30\n",
+		},
+		{
+			name:     "replaced ranges without rows",
+			file:     "a,10\nb,20\nc,30\nd,40\n",
+			replaced: []blockRange{{15, 25}, {40, 40}},
+			want:     "a,10\nc,30\n",
+		},
+		{
+			name: "header only",
+			rows: [][]string{{"x", "15"}},
+			want: "x,15\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "trades.csv")
+			if err := os.WriteFile(path, []byte(header+tt.file), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			size, err := mergeCSVByBlock(path, tt.rows, tt.replaced)
+			if err != nil {
+				t.Fatalf("mergeCSVByBlock: %v", err)
+			}
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != header+tt.want {
+				t.Errorf("merged file:\n%s\nwant:\n%s", got, header+tt.want)
+			}
+			if size != int64(len(got)) {
+				t.Errorf("size = %d, want %d", size, len(got))
+			}
+			if _, err := os.Stat(path + ".merge"); !os.IsNotExist(err) {
+				t.Errorf("%s.merge left behind", path)
+			}
+		})
+	}
+}
+
+func TestRunRedriveToSink(t *testing.T) {
+	dir := t.TempDir()
+	client := newFakeSource(1, 30, 2)
+	withOrders(client)
+
+	out, err := sink.NewSQLite(filepath.Join(dir, "scan.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	cfg := RedriveConfig{
+		LedgerPath: filepath.Join(dir, "failed-chunks.sqlite.jsonl"),
+		MarketType: types.MarketDerivative,
+		Source:     client,
+		Out:        out,
+	}
+	// The same chunk re-driven twice, e.g. after a crash before the ledger was rewritten
+	for i := 0; i < 2; i++ {
+		if err := OpenLedger(cfg.LedgerPath).Record(FailedChunk{Low: 11, High: 20, Kept: true}); err != nil {
+			t.Fatal(err)
+		}
+		if err := RunRedrive(context.Background(), cfg); err != nil {
+			t.Fatalf("RunRedrive #%d: %v", i+1, err)
+		}
+		left, err := LoadLedger(cfg.LedgerPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(left) != 0 {
+			t.Fatalf("ledger still has %v", left)
+		}
+	}
+
+	db, err := sql.Open("sqlite", filepath.Join(dir, "scan.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var n, low, high int
+	if err := db.QueryRow(`SELECT COUNT(*), MIN(block), MAX(block) FROM orders`).Scan(&n, &low, &high); err != nil {
+		t.Fatal(err)
+	}
+	if n != 20 || low != 11 || high != 20 {
+		t.Errorf("orders: %d rows in [%d..%d], want 20 in [11..20]", n, low, high)
+	}
+}
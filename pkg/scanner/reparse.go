@@ -0,0 +1,113 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/archive"
+	logParser "github.com/kprimice/challenge-week/pkg/scanner/logs"
+	msgParser "github.com/kprimice/challenge-week/pkg/scanner/msg"
+	"github.com/kprimice/challenge-week/pkg/scanner/sink"
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+// ReparseConfig configures RunReparse
+type ReparseConfig struct {
+	ArchiveDir string
+	MarketID   string
+	StartBlock uint64
+	EndBlock   uint64
+
+	// MarketType filters the records like Config.MarketType (default derivative only).
+	MarketType string
+
+	// Messages (optional) receives the records of the msg parser through WriteOrder:
+	// PLACE_ORDER / CANCEL_ORDER, the orders as submitted in the tx messages.
+	Messages sink.Sink
+}
+
+// RunReparse runs the parsers again over the txs archived by a scan (Config.ArchiveDir)
+// for [cfg.StartBlock..cfg.EndBlock], and writes the records to out like RunScanner
+// would, without fetching anything. Blocks missing from the archive are skipped.
+// Cancelling ctx stops it after the current tx; out is flushed.
+func RunReparse(ctx context.Context, cfg ReparseConfig, out sink.Sink) error {
+	if cfg.StartBlock > cfg.EndBlock {
+		return fmt.Errorf(
+			"start block %d must be <= end block %d",
+			cfg.StartBlock, cfg.EndBlock,
+		)
+	}
+	if err := types.CheckMarketType(cfg.MarketType); err != nil {
+		return err
+	}
+
+	log.Printf("Re-parsing blocks %d up to %d from %s...", cfg.StartBlock, cfg.EndBlock, cfg.ArchiveDir)
+
+	var totalTxs, totalMatches, totalMsgs int64
+	var lastBlock uint64
+	err := archive.Read(cfg.ArchiveDir, cfg.StartBlock, cfg.EndBlock, func(raw archive.Tx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		totalTxs++
+		lastBlock = raw.Block
+		tx := raw.TxData()
+
+		// 1) Logs, or the events stored alongside when they came from elsewhere
+		events := raw.Events
+		if events == nil {
+			events = logParser.ParseEvents(tx.Logs)
+		}
+		records := logParser.ParseTxEvents(tx, events, cfg.MarketID)
+		for _, rec := range records {
+			if !types.KeepMarketType(cfg.MarketType, rec.MarketType) {
+				continue
+			}
+			if err := sink.Write(out, rec); err != nil {
+				return fmt.Errorf("failed to write block %d: %w", rec.Block, err)
+			}
+			totalMatches++
+		}
+
+		// 2) Messages, with order hashes looked up from the new orders in the logs
+		if cfg.Messages == nil || len(tx.Messages) == 0 {
+			return nil
+		}
+		hashMap := make(map[string]string)
+		for _, rec := range records {
+			if rec.Action == "EVENT_NEW" && rec.Cid != "" {
+				hashMap[rec.SubaccountID+"|"+rec.Cid] = rec.OrderHash
+			}
+		}
+		for _, rec := range msgParser.ParseTxMessages(tx, hashMap) {
+			if cfg.MarketID != "" && rec.MarketID != cfg.MarketID {
+				continue
+			}
+			rec.BlockTimestamp = tx.BlockTimestamp
+			if err := cfg.Messages.WriteOrder(rec); err != nil {
+				return fmt.Errorf("failed to write message of block %d: %w", rec.Block, err)
+			}
+			totalMsgs++
+		}
+		return nil
+	})
+
+	if ferr := out.Flush(); ferr != nil && err == nil {
+		err = ferr
+	}
+	if cfg.Messages != nil {
+		if ferr := cfg.Messages.Flush(); ferr != nil && err == nil {
+			err = ferr
+		}
+	}
+	if ctx.Err() != nil {
+		log.Printf("Stopped => %d archived txs re-parsed, up to block %d; the output stops there.", totalTxs, lastBlock)
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Finished => %d records and %d message records from %d archived txs.", totalMatches, totalMsgs, totalTxs)
+	return nil
+}
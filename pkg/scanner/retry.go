@@ -2,54 +2,71 @@ package scanner
 
 import (
 	"context"
-	"log"
-	"strings"
-	"time"
 
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
-
-	explorerclient "github.com/InjectiveLabs/sdk-go/client/explorer"
+	exchangeclient "github.com/InjectiveLabs/sdk-go/client/exchange"
+	derivativeExchangePB "github.com/InjectiveLabs/sdk-go/exchange/derivative_exchange_rpc/pb"
 	explorerPB "github.com/InjectiveLabs/sdk-go/exchange/explorer_rpc/pb"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/retry"
+	"github.com/kprimice/challenge-week/pkg/scanner/source"
 )
 
-// GetTxsWithRetry tries up to N times to call GetTxs
+// GetTxsWithRetry calls GetTxs, retrying transient errors as policy allows
 func GetTxsWithRetry(
 	ctx context.Context,
-	client explorerclient.ExplorerClient,
+	client source.TxSource,
 	req *explorerPB.GetTxsRequest,
-	attempts int,
+	policy retry.Policy,
 ) (*explorerPB.GetTxsResponse, error) {
-	var lastErr error
-	for i := 0; i < attempts; i++ {
-		res, err := client.GetTxs(ctx, req)
-		if err == nil {
-			return res, nil // success
-		}
-
-		log.Printf("[Retry %d/%d] GetTxs error: %v", i+1, attempts, err)
-		lastErr = err
-
-		// If error is transient, wait & retry
-		if isTransientError(err) {
-			backoff := time.Duration(1+i) * time.Second
-			time.Sleep(backoff)
-			continue
-		}
-		// Otherwise return immediately
-		return nil, err
-	}
-	return nil, lastErr
+	return retry.Do(ctx, policy, "GetTxs", func(ctx context.Context) (*explorerPB.GetTxsResponse, error) {
+		return client.GetTxs(ctx, req)
+	})
+}
+
+// GetBlockWithRetry calls GetBlock, retrying transient errors as policy allows
+func GetBlockWithRetry(
+	ctx context.Context,
+	client source.TxSource,
+	height string,
+	policy retry.Policy,
+) (*explorerPB.GetBlockResponse, error) {
+	return retry.Do(ctx, policy, "GetBlock", func(ctx context.Context) (*explorerPB.GetBlockResponse, error) {
+		return client.GetBlock(ctx, height)
+	})
+}
+
+// GetBlocksWithRetry calls GetBlocks, retrying transient errors as policy allows
+func GetBlocksWithRetry(
+	ctx context.Context,
+	client source.TxSource,
+	req *explorerPB.GetBlocksRequest,
+	policy retry.Policy,
+) (*explorerPB.GetBlocksResponse, error) {
+	return retry.Do(ctx, policy, "GetBlocks", func(ctx context.Context) (*explorerPB.GetBlocksResponse, error) {
+		return client.GetBlocks(ctx, req)
+	})
+}
+
+// GetTxByTxHashWithRetry calls GetTxByTxHash, retrying transient errors as policy allows
+func GetTxByTxHashWithRetry(
+	ctx context.Context,
+	client source.TxSource,
+	hash string,
+	policy retry.Policy,
+) (*explorerPB.GetTxByTxHashResponse, error) {
+	return retry.Do(ctx, policy, "GetTxByTxHash", func(ctx context.Context) (*explorerPB.GetTxByTxHashResponse, error) {
+		return client.GetTxByTxHash(ctx, hash)
+	})
 }
 
-// isTransientError checks for typical "unavailable" or "connection refused"
-func isTransientError(err error) bool {
-	st, ok := status.FromError(err)
-	if ok && st.Code() == codes.Unavailable {
-		return true
-	}
-	if strings.Contains(err.Error(), "connection refused") {
-		return true
-	}
-	return false
+// GetDerivativeTradesWithRetry calls GetDerivativeTradesV2, retrying transient errors as policy allows
+func GetDerivativeTradesWithRetry(
+	ctx context.Context,
+	client exchangeclient.ExchangeClient,
+	req *derivativeExchangePB.TradesV2Request,
+	policy retry.Policy,
+) (*derivativeExchangePB.TradesV2Response, error) {
+	return retry.Do(ctx, policy, "GetDerivativeTradesV2", func(ctx context.Context) (*derivativeExchangePB.TradesV2Response, error) {
+		return client.GetDerivativeTradesV2(ctx, req)
+	})
 }
@@ -0,0 +1,238 @@
+// Package retry runs RPC calls again on transient errors, with exponential backoff.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/ratelimit"
+)
+
+// DefaultCodes are the gRPC codes retried when Policy.Codes is nil. grpc-go reports
+// HTTP 429 and 502-504 answers from a gateway as Unavailable.
+var DefaultCodes = []codes.Code{
+	codes.Unavailable,
+	codes.ResourceExhausted,
+	codes.DeadlineExceeded,
+	codes.Aborted,
+}
+
+// Policy says how often and how fast a call is retried. Zero fields take the
+// defaults noted on each, so the zero Policy is usable.
+type Policy struct {
+	// MaxAttempts is the number of calls, including the first (default 5).
+	MaxAttempts int
+	// MaxElapsed caps the time spent on all attempts and waits (default 5m).
+	// No new attempt is started once the next wait would go past it.
+	MaxElapsed time.Duration
+	// AttemptTimeout bounds each call (default 60s). Hitting it is always retried,
+	// whatever Codes says (gRPC reports it as DeadlineExceeded).
+	AttemptTimeout time.Duration
+
+	// Backoff before retry n is InitialBackoff * Multiplier^(n-1), at most MaxBackoff,
+	// minus a random part of up to Jitter of it, so parallel workers spread out.
+	InitialBackoff time.Duration // default 1s
+	MaxBackoff     time.Duration // default 30s
+	Multiplier     float64       // default 2
+	Jitter         float64       // 0..1, default 0.5
+
+	// Codes are the gRPC status codes worth retrying (default DefaultCodes).
+	// Network errors and HTTP 429/5xx answers from plain HTTP endpoints are always retried.
+	Codes []codes.Code
+
+	// Limiter (optional) paces every attempt. Share one between all policies so the
+	// whole process stays under the server's limit; it slows down on rate-limit errors.
+	Limiter *ratelimit.Limiter
+}
+
+func (p Policy) withDefaults() Policy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 5
+	}
+	if p.MaxElapsed <= 0 {
+		p.MaxElapsed = 5 * time.Minute
+	}
+	if p.AttemptTimeout <= 0 {
+		p.AttemptTimeout = 60 * time.Second
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = time.Second
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = 30 * time.Second
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = 2
+	}
+	if p.Jitter <= 0 || p.Jitter > 1 {
+		p.Jitter = 0.5
+	}
+	if p.Codes == nil {
+		p.Codes = DefaultCodes
+	}
+	return p
+}
+
+// Backoff returns the wait before retry n (n >= 1), jitter included.
+func (p Policy) Backoff(n int) time.Duration {
+	p = p.withDefaults()
+	d := float64(p.InitialBackoff)
+	for i := 1; i < n && d < float64(p.MaxBackoff); i++ {
+		d *= p.Multiplier
+	}
+	d = min(d, float64(p.MaxBackoff))
+	return time.Duration(d * (1 - p.Jitter*rand.Float64()))
+}
+
+// Retryable reports whether err is worth another attempt under p.
+func (p Policy) Retryable(err error) bool {
+	p = p.withDefaults()
+	if st, ok := status.FromError(err); ok && st.Code() != codes.Unknown {
+		for _, c := range p.Codes {
+			if st.Code() == c {
+				return true
+			}
+		}
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true // the attempt timed out
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode >= 500
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		strings.Contains(err.Error(), "connection refused")
+}
+
+// HTTPError is a non-2xx answer from a plain HTTP endpoint that carried no usable body.
+type HTTPError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *HTTPError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("HTTP %d", e.StatusCode)
+	}
+	return fmt.Sprintf("HTTP %d: %v", e.StatusCode, e.Err)
+}
+
+func (e *HTTPError) Unwrap() error { return e.Err }
+
+// IsRateLimited reports whether err means the server is throttling us:
+// ResourceExhausted, or an HTTP 429 passed through gRPC or plain HTTP.
+func IsRateLimited(err error) bool {
+	if err == nil {
+		return false
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusTooManyRequests
+	}
+	if st, ok := status.FromError(err); ok {
+		if st.Code() == codes.ResourceExhausted {
+			return true
+		}
+		msg := strings.ToLower(st.Message())
+		return strings.Contains(msg, "429") || strings.Contains(msg, "too many requests")
+	}
+	return false
+}
+
+// Do calls call until it succeeds, fails with a non-retryable error, or p runs out
+// of attempts or time; the last error is returned then. Each attempt waits for
+// p.Limiter and gets its own context bounded by p.AttemptTimeout; an attempt cut
+// short by that timeout is retried whatever its error. name is used in log lines.
+func Do[T any](ctx context.Context, p Policy, name string, call func(ctx context.Context) (T, error)) (T, error) {
+	p = p.withDefaults()
+	start := time.Now()
+
+	for attempt := 1; ; attempt++ {
+		if err := p.Limiter.Wait(ctx); err != nil {
+			var zero T
+			return zero, err
+		}
+		attemptCtx, cancel := context.WithTimeout(ctx, p.AttemptTimeout)
+		res, err := call(attemptCtx)
+		timedOut := attemptCtx.Err() != nil // ctx itself is checked below
+		cancel()
+		if err == nil {
+			return res, nil
+		}
+		if ctx.Err() != nil {
+			return res, ctx.Err() // cancelled, not a failure of the call
+		}
+		if IsRateLimited(err) {
+			p.Limiter.SlowDown()
+		}
+		if !timedOut && !p.Retryable(err) {
+			return res, err
+		}
+		if attempt >= p.MaxAttempts {
+			return res, fmt.Errorf("%s failed after %d attempts: %w", name, attempt, err)
+		}
+		wait := p.Backoff(attempt)
+		if time.Since(start)+wait > p.MaxElapsed {
+			return res, fmt.Errorf("%s failed after %d attempts in %s: %w",
+				name, attempt, time.Since(start).Round(time.Second), err)
+		}
+
+		log.Printf("[Retry %d/%d] %s error => retrying in %s: %v", attempt, p.MaxAttempts, name, wait.Round(time.Millisecond), err)
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return res, ctx.Err()
+		}
+	}
+}
+
+// ParseCodes parses a comma-separated list of gRPC code names, such as
+// "Unavailable,ResourceExhausted" (case and underscores are ignored).
+// An empty list gives nil, i.e. DefaultCodes.
+func ParseCodes(list string) ([]codes.Code, error) {
+	var out []codes.Code
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		c, ok := codeByName(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown gRPC code %q", name)
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+func codeByName(name string) (codes.Code, bool) {
+	norm := func(s string) string { return strings.ToLower(strings.ReplaceAll(s, "_", "")) }
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		if norm(c.String()) == norm(name) {
+			return c, true
+		}
+	}
+	return 0, false
+}
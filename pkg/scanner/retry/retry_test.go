@@ -0,0 +1,231 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/ratelimit"
+)
+
+func TestBackoff(t *testing.T) {
+	p := Policy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 3, Jitter: 0.25}
+	tests := []struct {
+		n    int
+		want time.Duration // before jitter
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 300 * time.Millisecond},
+		{3, 900 * time.Millisecond},
+		{4, time.Second},
+		{10, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.n), func(t *testing.T) {
+			for i := 0; i < 20; i++ {
+				got := p.Backoff(tt.n)
+				if got > tt.want || got < tt.want*3/4 {
+					t.Fatalf("Backoff(%d) = %s, want %s minus up to 25%%", tt.n, got, tt.want)
+				}
+			}
+		})
+	}
+
+	// Defaults: 1s doubling up to 30s, minus up to half
+	if got := (Policy{}).Backoff(6); got > 30*time.Second || got < 15*time.Second {
+		t.Errorf("default Backoff(6) = %s, want 15s..30s", got)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name  string
+		codes []codes.Code
+		err   error
+		want  bool
+	}{
+		{name: "unavailable", err: status.Error(codes.Unavailable, "502 bad gateway"), want: true},
+		{name: "resource exhausted", err: status.Error(codes.ResourceExhausted, "slow down"), want: true},
+		{name: "deadline exceeded", err: status.Error(codes.DeadlineExceeded, "timeout"), want: true},
+		{name: "aborted", err: status.Error(codes.Aborted, "conflict"), want: true},
+		{name: "invalid argument", err: status.Error(codes.InvalidArgument, "bad height"), want: false},
+		{name: "not found", err: status.Error(codes.NotFound, "no such tx"), want: false},
+		{name: "wrapped code", err: fmt.Errorf("GetTxs: %w", status.Error(codes.Unavailable, "down")), want: true},
+		{name: "code outside Codes", codes: []codes.Code{codes.Internal}, err: status.Error(codes.Unavailable, "down"), want: false},
+		{name: "code in Codes", codes: []codes.Code{codes.Internal}, err: status.Error(codes.Internal, "oops"), want: true},
+		{name: "attempt timed out", err: context.DeadlineExceeded, want: true},
+		{name: "cancelled", err: context.Canceled, want: false},
+		{name: "http 429", err: &HTTPError{StatusCode: 429}, want: true},
+		{name: "http 503", err: &HTTPError{StatusCode: 503}, want: true},
+		{name: "http 404", err: &HTTPError{StatusCode: 404}, want: false},
+		{name: "network error", err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("no route to host")}, want: true},
+		{name: "connection reset", err: fmt.Errorf("read: %w", syscall.ECONNRESET), want: true},
+		{name: "unexpected eof", err: io.ErrUnexpectedEOF, want: true},
+		{name: "unknown code, refused connection", err: status.Error(codes.Unknown, "dial tcp: connection refused"), want: true},
+		{name: "plain error", err: errors.New("bad json"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (Policy{Codes: tt.codes}).Retryable(tt.err); got != tt.want {
+				t.Errorf("Retryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsRateLimited(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "resource exhausted", err: status.Error(codes.ResourceExhausted, "quota"), want: true},
+		{name: "429 through grpc", err: status.Error(codes.Unavailable, "unexpected HTTP status code received from server: 429 (Too Many Requests)"), want: true},
+		{name: "502 through grpc", err: status.Error(codes.Unavailable, "unexpected HTTP status code received from server: 502 (Bad Gateway)"), want: false},
+		{name: "http 429", err: fmt.Errorf("blockchain: %w", &HTTPError{StatusCode: 429}), want: true},
+		{name: "http 503", err: &HTTPError{StatusCode: 503}, want: false},
+		{name: "plain error", err: errors.New("too many requests"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRateLimited(tt.err); got != tt.want {
+				t.Errorf("IsRateLimited(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDo(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "down")
+	invalid := status.Error(codes.InvalidArgument, "bad request")
+	fast := Policy{InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+
+	tests := []struct {
+		name   string
+		policy Policy
+		errs   []error // returned by the attempts in turn, then nil
+		// hang makes the attempts wait for their context to end first
+		hang bool
+
+		wantCalls int
+		wantErr   error // matched with errors.Is
+	}{
+		{name: "first attempt", policy: fast, wantCalls: 1},
+		{name: "transient errors", policy: fast, errs: []error{unavailable, unavailable}, wantCalls: 3},
+		{name: "not retryable", policy: fast, errs: []error{invalid}, wantCalls: 1, wantErr: invalid},
+		{
+			name:      "out of attempts",
+			policy:    Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+			errs:      []error{unavailable, unavailable, unavailable, unavailable},
+			wantCalls: 3,
+			wantErr:   unavailable,
+		},
+		{
+			// Waits of ~40ms then ~80ms: the second one would go past 50ms
+			name:      "elapsed cap",
+			policy:    Policy{MaxElapsed: 50 * time.Millisecond, InitialBackoff: 40 * time.Millisecond, Jitter: 0.01},
+			errs:      []error{unavailable, unavailable, unavailable},
+			wantCalls: 2,
+			wantErr:   unavailable,
+		},
+		{
+			name:      "timed out attempt retried whatever its error",
+			policy:    Policy{AttemptTimeout: 5 * time.Millisecond, InitialBackoff: time.Millisecond, Codes: []codes.Code{codes.Unavailable}},
+			errs:      []error{invalid},
+			hang:      true,
+			wantCalls: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			got, err := Do(context.Background(), tt.policy, "test", func(ctx context.Context) (int, error) {
+				calls++
+				if calls > len(tt.errs) {
+					return 42, nil
+				}
+				if tt.hang {
+					<-ctx.Done()
+				}
+				return 0, tt.errs[calls-1]
+			})
+			if calls != tt.wantCalls {
+				t.Errorf("%d calls, want %d", calls, tt.wantCalls)
+			}
+			if tt.wantErr == nil {
+				if err != nil || got != 42 {
+					t.Errorf("Do = %d, %v, want 42", got, err)
+				}
+			} else if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Do error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDoCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	_, err := Do(ctx, Policy{InitialBackoff: time.Hour}, "test", func(ctx context.Context) (int, error) {
+		calls++
+		cancel()
+		return 0, status.Error(codes.Unavailable, "down")
+	})
+	if !errors.Is(err, context.Canceled) || calls != 1 {
+		t.Errorf("Do = %v after %d calls, want context.Canceled after 1", err, calls)
+	}
+}
+
+func TestDoSlowsDownLimiter(t *testing.T) {
+	limiter := ratelimit.New(1000, 100)
+	errs := []error{
+		status.Error(codes.ResourceExhausted, "quota"),
+		status.Error(codes.Unavailable, "down"), // not a rate limit
+	}
+	calls := 0
+	_, err := Do(context.Background(), Policy{InitialBackoff: time.Millisecond, Limiter: limiter}, "test", func(ctx context.Context) (int, error) {
+		calls++
+		if calls > len(errs) {
+			return 0, nil
+		}
+		return 0, errs[calls-1]
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := limiter.Rate(); got != 500 {
+		t.Errorf("rate = %v after one rate-limit error, want 500", got)
+	}
+}
+
+func TestParseCodes(t *testing.T) {
+	tests := []struct {
+		list    string
+		want    []codes.Code
+		wantErr bool
+	}{
+		{list: "", want: nil},
+		{list: "Unavailable", want: []codes.Code{codes.Unavailable}},
+		{list: "unavailable, RESOURCE_EXHAUSTED,,deadline_exceeded", want: []codes.Code{codes.Unavailable, codes.ResourceExhausted, codes.DeadlineExceeded}},
+		{list: "Unavailable,Nope", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseCodes(tt.list)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseCodes(%q) error = %v, wantErr %v", tt.list, err, tt.wantErr)
+			continue
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("ParseCodes(%q) = %v, want %v", tt.list, got, tt.want)
+		}
+	}
+}
@@ -3,156 +3,521 @@ package scanner
 import (
 	"context"
 	"encoding/base64"
-	"encoding/csv"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"io"
 	"log"
-	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/InjectiveLabs/sdk-go/client/common"
 	exchangeclient "github.com/InjectiveLabs/sdk-go/client/exchange"
 	explorerclient "github.com/InjectiveLabs/sdk-go/client/explorer"
 	derivativeExchangePB "github.com/InjectiveLabs/sdk-go/exchange/derivative_exchange_rpc/pb"
 	explorerPB "github.com/InjectiveLabs/sdk-go/exchange/explorer_rpc/pb"
 
 	// Import your sub-packages
+	"github.com/kprimice/challenge-week/pkg/scanner/archive"
 	logParser "github.com/kprimice/challenge-week/pkg/scanner/logs"
 	// msgParser "github.com/kprimice/challenge-week/pkg/scanner/msg" // if you want messages
+	"github.com/kprimice/challenge-week/pkg/scanner/retry"
+	"github.com/kprimice/challenge-week/pkg/scanner/sink"
+	"github.com/kprimice/challenge-week/pkg/scanner/source"
 	"github.com/kprimice/challenge-week/pkg/scanner/types"
 )
 
-func RunScanner(cfg types.Config, ordersFile *os.File, tradesFile *os.File) error {
-	if cfg.StartBlock > cfg.EndBlock {
+// RunScanner scans [cfg.StartBlock..cfg.EndBlock] and writes every parsed order and
+// trade to out, in block order. Checkpointing (cfg.CheckpointPath) requires out to
+// implement sink.Resumable. RunScanner flushes out but does not close it.
+//
+// With cfg.Follow, EndBlock is replaced by the block below the current chain head
+// and RunScanner then keeps writing new blocks, from the head on, as they are
+// produced; it only returns on error or when ctx is done.
+//
+// Cancelling ctx stops the scan after the chunks already written: out is flushed
+// and checkpointed up to the last completed block, and ctx's error is returned.
+func RunScanner(ctx context.Context, cfg types.Config, out sink.Sink) error {
+	if !cfg.Follow && cfg.StartBlock > cfg.EndBlock {
 		return fmt.Errorf(
 			"start block %d must be <= end block %d",
 			cfg.StartBlock, cfg.EndBlock,
 		)
 	}
+	if err := types.CheckMarketType(cfg.MarketType); err != nil {
+		return err
+	}
+
+	var resumable sink.Resumable
+	if cfg.CheckpointPath != "" {
+		r, ok := out.(sink.Resumable)
+		if !ok {
+			return fmt.Errorf("checkpointing needs a resumable sink, %T is not", out)
+		}
+		resumable = r
+	}
 
-	// Load network info and create an Explorer client
-	network := common.LoadNetwork("mainnet", "lb")
-	client, err := explorerclient.NewExplorerClient(network)
+	// Default to the network's Explorer when no source is configured
+	network, err := cfg.Network.Load()
 	if err != nil {
-		return fmt.Errorf("failed to create explorer client: %w", err)
+		return err
+	}
+	client := cfg.Source
+	if client == nil {
+		explorer, err := source.NewExplorer(network)
+		if err != nil {
+			return err
+		}
+		client = explorer
 	}
 
-	// Prepare CSV output
-	ordersWriter := csv.NewWriter(ordersFile)
-	tradesWriter := csv.NewWriter(tradesFile)
-	defer ordersWriter.Flush()
-	defer tradesWriter.Flush()
+	if cfg.BlockEvents && cfg.TmEndpoint == "" {
+		cfg.TmEndpoint = network.TmEndpoint
+	}
 
-	ordersWriter.Write([]string{
-		"OrderHash", "Block", "Action", "Price", "Quantity", "Margin", "OrderType", "SubaccountID", "MarketID",
-	})
+	// Adaptive chunks depend on timing, so a recording could not be replayed
+	if cfg.ChunkTxs > 0 && source.Recorded(client) {
+		log.Printf("Recorded source => fixed chunks of %d blocks (adaptive sizing is off).", chunkBlocks(cfg))
+		cfg.ChunkTxs = 0
+	}
 
-	tradesWriter.Write([]string{
-		"OrderHash", "Block", "Action", "ExecPrice", "ExecQuantity", "ExecFee", "IsBuy", "IsLiquidation", "Pnl", "Payout", "SubaccountID", "MarketID",
-	})
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	log.Printf("Scanning from block %d up to %d...", cfg.StartBlock, cfg.EndBlock)
+	// In follow mode, open the stream before reading the head: blocks produced while
+	// backfilling up to the head are then signalled by the stream, not missed
+	var watcher *headWatcher
+	if cfg.Follow {
+		watcher = watchHead(ctx, client)
+		head, err := chainHead(ctx, client, cfg.Retry)
+		if err != nil {
+			return err
+		}
+		// Like followChain, only treat the blocks below the head as final: the head
+		// itself may still be indexed, so the follow loop picks it up instead
+		log.Printf("Follow mode => backfilling up to block %d below chain head %d, then tailing new blocks.", head-1, head)
+		cfg.EndBlock = head - 1
+	}
 
-	// Keep track of how many log records we produce
-	var totalMatches int64
+	// Work out where to start: from scratch, or right after the last checkpointed chunk
+	cp := &Checkpoint{
+		MarketID:   cfg.MarketID,
+		StartBlock: cfg.StartBlock,
+		EndBlock:   cfg.EndBlock,
+		NextBlock:  cfg.StartBlock,
+	}
+	resumed := false
+	if cfg.Resume {
+		if cfg.CheckpointPath == "" {
+			return fmt.Errorf("resume requested but no checkpoint path configured")
+		}
+		prev, err := LoadCheckpoint(cfg.CheckpointPath)
+		if err != nil {
+			return err
+		}
+		if prev != nil {
+			if err := prev.checkResumable(cfg); err != nil {
+				return fmt.Errorf("cannot resume from %s: %w", cfg.CheckpointPath, err)
+			}
+			cp = prev
+			cp.EndBlock = cfg.EndBlock
+			resumed = true
+		} else {
+			log.Printf("No checkpoint at %s => starting from block %d", cfg.CheckpointPath, cfg.StartBlock)
+		}
+	}
+
+	// saveProgress makes the written chunks durable and records the sink position
+	saveProgress := func() error {
+		if resumable == nil {
+			return out.Flush()
+		}
+		pos, err := resumable.Position()
+		if err != nil {
+			return err
+		}
+		cp.Offsets = pos
+		return cp.Save(cfg.CheckpointPath)
+	}
 
-	// For storing subaccount+cid -> orderHash
-	// orderHashMap := make(map[string]string)
+	// Drop anything written after the checkpoint (or everything, on a fresh start)
+	if resumable != nil {
+		if err := resumable.Rewind(cp.Offsets); err != nil {
+			return err
+		}
+		if err := saveProgress(); err != nil {
+			return err
+		}
+	}
+
+	if cp.NextBlock > cfg.EndBlock && !cfg.Follow {
+		log.Printf("Checkpoint already covers up to block %d => nothing to do.", cp.NextBlock-1)
+		return nil
+	}
 
-	// Adjust these as desired
-	const chunkSize = uint64(100) // how many blocks per chunk
-	const pageSize = int32(100)   // how many txs per fetch
+	scanCfg := cfg
+	scanCfg.StartBlock = cp.NextBlock
 
-	// Outer loop: chunk over block ranges
-	for chunkLow := cfg.StartBlock; chunkLow <= cfg.EndBlock; chunkLow += chunkSize {
-		chunkHigh := chunkLow + chunkSize - 1
-		if chunkHigh > cfg.EndBlock {
-			chunkHigh = cfg.EndBlock
+	log.Printf("Scanning from block %d up to %d with %d worker(s)...",
+		scanCfg.StartBlock, cfg.EndBlock, workerCount(cfg))
+
+	// Keep track of how many log records we produce
+	var totalMatches int64
+	var failedChunks int
+	var incompleteBlocks int
+	var incompleteChunks int
+
+	// The ledger must only list holes of the output: a fresh scan starts it over, and
+	// a resumed one drops the entries of chunks past the checkpoint (possibly written
+	// after the last save), which it fetches again
+	var ledger *Ledger
+	if cfg.LedgerPath != "" {
+		from := uint64(0)
+		if resumed {
+			from = cp.NextBlock
 		}
+		if err := TrimLedger(cfg.LedgerPath, from); err != nil {
+			return err
+		}
+		ledger = OpenLedger(cfg.LedgerPath)
+	}
 
-		log.Printf("Processing block chunk %d .. %d", chunkLow, chunkHigh)
+	var arch *archive.Writer
+	if cfg.ArchiveDir != "" {
+		w, err := archive.NewWriter(cfg.ArchiveDir)
+		if err != nil {
+			return fmt.Errorf("failed to open archive: %w", err)
+		}
+		arch = w
+	}
 
-		// We'll keep fetching in pages until no more Tx
-		var skip uint64
+	// Chunks are fetched concurrently but handed back here in block order
+	emit := func(res chunkResult) error {
+		// Once cancelled, chunks fail or are cut short: stop at the last complete one
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
-		for {
-			req := &explorerPB.GetTxsRequest{
-				// These define the block range we want
-				After:  chunkLow,  // >= chunkLow
-				Before: chunkHigh, // <= chunkHigh
+		// A failed chunk is left out entirely and recorded in the ledger for RunRedrive
+		records := res.records
+		if res.err != nil {
+			log.Printf("GetTxs error for chunk [%d..%d]: %v", res.job.low, res.job.high, res.err)
+			if err := recordFailure(ledger, res); err != nil {
+				return err
+			}
+			failedChunks++
+			records = nil
+		}
 
-				// Normal pagination
-				Limit: pageSize,
-				Skip:  skip,
+		// A chunk kept short of its reported tx count is a hole even with its rows written
+		if res.err == nil && res.incomplete != nil {
+			if err := recordIncomplete(ledger, *res.incomplete); err != nil {
+				return err
 			}
+			incompleteChunks++
+		}
 
-			// Retry if the Explorer node is momentarily unavailable
-			res, err := GetTxsWithRetry(context.Background(), client, req, 3)
-			if err != nil {
-				log.Printf("GetTxs error for chunk [%d..%d]: %v", chunkLow, chunkHigh, err)
-				// Break this chunk and continue with the next
-				break
+		// Blocks that failed verification are holes too, one ledger entry each
+		for _, m := range res.mismatches {
+			if err := recordMismatch(ledger, m); err != nil {
+				return err
 			}
-			// log number of lines returned
-			// log.Printf("Number of lines returned: %d", len(res.Data))
+		}
+		incompleteBlocks += len(res.mismatches)
 
-			txs := res.Data
-			if len(txs) == 0 {
-				// No more txs in this block range
-				break
+		// Keep the raw txs before the chunk counts as written
+		if arch != nil && res.err == nil {
+			if err := arch.WriteChunk(res.job.low, res.job.high, res.txs); err != nil {
+				return err
 			}
+		}
 
-			// Process each transaction
-			for _, tx := range txs {
-				// log txid parsed & block
-				// 1) Update orderHashMap from logs (you parse 'buy_orders', 'sell_orders', etc.)
-				/*
-					newHashes := logParser.BuildOrderHashMap(tx)
-					for k, v := range newHashes {
-						orderHashMap[k] = v
-					}
-				*/
-
-				// 2) (Optional) parse messages if you want
-				// msgRecords := msgParser.ParseTxMessages(tx, orderHashMap)
-
-				// 3) Parse logs for actual events (new orders, cancels, executions, etc.)
-				// log.Printf("Processing tx %s from block %d", tx.Hash, tx.BlockNumber)
-				logRecords := logParser.ParseTxLogs(tx, cfg.MarketID)
-
-				// Write all log-based records to CSV
-				for _, rec := range logRecords {
-					switch rec.Action {
-					case "EVENT_NEW", "EVENT_CANCEL":
-						ordersWriter.Write(rec.AsOrderRow())
-					case "EXECUTION":
-						tradesWriter.Write(rec.AsTradeRow())
-					}
-				}
-				ordersWriter.Flush()
-				tradesWriter.Flush()
-
-				totalMatches += int64(len(logRecords))
+		// Hand all log-based records to the sink
+		for _, rec := range records {
+			if err := sink.Write(out, rec); err != nil {
+				return fmt.Errorf("failed to write block %d: %w", rec.Block, err)
 			}
+		}
 
-			// Increase skip by how many Tx we just processed
-			skip += uint64(len(txs))
+		totalMatches += int64(len(records))
 
-			// If we got fewer than 'pageSize' Tx, no more results remain in this chunk
-			if len(txs) < int(pageSize) {
-				break
-			}
+		cp.LastChunkLow, cp.LastChunkHigh = res.job.low, res.job.high
+		cp.NextBlock = res.job.high + 1
+		if cp.NextBlock > cp.EndBlock {
+			cp.EndBlock = res.job.high // follow mode moves past the initial head
+		}
+		return saveProgress()
+	}
+	if scanCfg.StartBlock <= scanCfg.EndBlock {
+		if err := runChunkPool(ctx, client, scanCfg, emit); err != nil {
+			return stopped(ctx, cfg, cp, err)
 		}
 	}
 
+	if cfg.Follow {
+		return stopped(ctx, cfg, cp, followChain(ctx, client, cfg, watcher, cp.NextBlock, emit))
+	}
+
 	log.Printf("Finished => found %d records from block %d up to %d.",
-		totalMatches, cfg.StartBlock, cfg.EndBlock)
+		totalMatches, scanCfg.StartBlock, cfg.EndBlock)
+	if failedChunks > 0 {
+		log.Printf("%d chunk(s) failed and were left out; see %s and re-drive them.", failedChunks, cfg.LedgerPath)
+	}
+	if incompleteChunks > 0 {
+		log.Printf("%d chunk(s) were written short of their reported tx count; see %s and re-drive them.", incompleteChunks, cfg.LedgerPath)
+	}
+	if incompleteBlocks > 0 {
+		log.Printf("%d block(s) were incomplete and were left out; see %s and re-drive them.", incompleteBlocks, cfg.LedgerPath)
+	}
 	return nil
 }
 
+// stopped reports where an interrupted scan got to, so it can be resumed, and
+// returns err. Errors other than a cancellation are returned as they are.
+func stopped(ctx context.Context, cfg types.Config, cp *Checkpoint, err error) error {
+	if ctx.Err() == nil {
+		return err
+	}
+	if cp.NextBlock == cfg.StartBlock {
+		log.Printf("Stopped => no block written yet.")
+		return err
+	}
+	if cfg.CheckpointPath != "" {
+		log.Printf("Stopped => last completed block is %d (saved in %s); rerun with -resume to continue.",
+			cp.NextBlock-1, cfg.CheckpointPath)
+	} else {
+		log.Printf("Stopped => last completed block is %d; rerun with -start=%d to continue.",
+			cp.NextBlock-1, cp.NextBlock)
+	}
+	return err
+}
+
+// recordFailure writes a failed chunk to the ledger. Without a ledger the gap
+// would be silent, so that is treated as fatal.
+func recordFailure(ledger *Ledger, res chunkResult) error {
+	if ledger == nil {
+		return fmt.Errorf("chunk [%d..%d] failed and no ledger is configured: %w",
+			res.job.low, res.job.high, res.err)
+	}
+	return ledger.Record(FailedChunk{
+		Low:          res.job.low,
+		High:         res.job.high,
+		Partial:      res.stats.pages > 0,
+		PagesFetched: res.stats.pages,
+		TxsFetched:   res.stats.txs,
+		Error:        res.err.Error(),
+		FailedAt:     time.Now().UTC(),
+	})
+}
+
+// recordIncomplete writes a chunk kept with fewer txs than reported to the ledger.
+func recordIncomplete(ledger *Ledger, fc FailedChunk) error {
+	if ledger == nil {
+		return fmt.Errorf("chunk [%d..%d] is incomplete (%d of %d txs) and no ledger is configured",
+			fc.Low, fc.High, fc.TxsFetched, fc.ExpectedTxs)
+	}
+	return ledger.Record(fc)
+}
+
+// maxChunkPasses is how many times a chunk is paged through from the start when
+// its pages do not add up (see fetchChunk).
+const maxChunkPasses = 3
+
+// fetchChunk pages through every tx in [low..high] and returns the parsed log records
+// along with the raw txs. On error the result holds what was gathered so far.
+//
+// Skip-based pages can shift if the Explorer's ordering changes between calls,
+// repeating some txs and missing others. Txs are kept once per hash, and the chunk
+// is paged through again while a pass saw the same tx twice or the distinct txs do
+// not add up to the total the Explorer reports. If passes agree but stay short of
+// that total, the chunk is returned with what was found and res.incomplete set.
+func fetchChunk(
+	ctx context.Context,
+	client source.TxSource,
+	job chunkJob,
+	cfg types.Config,
+) chunkResult {
+	log.Printf("Processing block chunk %d .. %d", job.low, job.high)
+
+	res := chunkResult{
+		job:   job,
+		stats: chunkStats{blockTxs: make(map[uint64]int), blockTimes: make(map[uint64]string)},
+	}
+	seen := make(map[string]bool)
+
+	for pass := 1; ; pass++ {
+		p, err := fetchPass(ctx, client, job, cfg, &res, seen)
+		if err != nil {
+			res.err = err
+			return res
+		}
+
+		// 1) Complete: every tx the Explorer counts was seen (or it gives no count
+		// and the pages did not overlap)
+		var problem string
+		switch {
+		case p.total > 0 && int64(len(seen)) < p.total:
+			problem = fmt.Sprintf("%d distinct txs fetched, %d reported", len(seen), p.total)
+		case p.total == 0 && p.overlaps > 0:
+			problem = fmt.Sprintf("%d txs repeated across pages", p.overlaps)
+		}
+		if problem == "" {
+			break
+		}
+
+		// 2) A clean pass that found nothing new agrees with the passes before it:
+		// paging again will not find the rest. Keep what was found, but as a hole
+		// for the ledger, with the reported and fetched counts
+		if pass > 1 && p.overlaps == 0 && p.distinct == len(seen) {
+			log.Printf("Chunk [%d..%d]: %s, but pages are stable => keeping %d txs as incomplete", job.low, job.high, problem, len(seen))
+			res.incomplete = &FailedChunk{
+				Low:          job.low,
+				High:         job.high,
+				Partial:      true,
+				Kept:         true,
+				PagesFetched: res.stats.pages,
+				TxsFetched:   len(seen),
+				ExpectedTxs:  int(p.total),
+				Error:        "incomplete: " + problem,
+				FailedAt:     time.Now().UTC(),
+			}
+			break
+		}
+		if pass == maxChunkPasses {
+			res.err = fmt.Errorf("unstable pagination after %d passes: %s", pass, problem)
+			return res
+		}
+		log.Printf("Chunk [%d..%d]: unstable pagination (%s) => paging again (%d/%d)",
+			job.low, job.high, problem, pass+1, maxChunkPasses)
+	}
+
+	// The Explorer pages newest first; keep rows in ascending block order
+	sortByBlock(&res)
+
+	return res
+}
+
+// passStats describes one pass of fetchPass over a chunk.
+type passStats struct {
+	total    int64 // tx count reported by the source, 0 if unknown
+	distinct int   // distinct txs in this pass
+	overlaps int   // txs returned again by a later page of this pass
+}
+
+// fetchPass pages once through [job.low..job.high], parsing txs not in seen into res.
+func fetchPass(
+	ctx context.Context,
+	client source.TxSource,
+	job chunkJob,
+	cfg types.Config,
+	res *chunkResult,
+	seen map[string]bool,
+) (passStats, error) {
+	var p passStats
+	inPass := make(map[string]bool)
+
+	// We'll keep fetching in pages until no more Tx
+	var skip uint64
+
+	for {
+		req := &explorerPB.GetTxsRequest{
+			// These define the block range we want
+			After:  job.low,  // >= chunkLow
+			Before: job.high, // <= chunkHigh
+
+			// Normal pagination
+			Limit: pageSize,
+			Skip:  skip,
+		}
+
+		// Retry if the Explorer node is momentarily unavailable
+		page, err := GetTxsWithRetry(ctx, client, req, cfg.Retry)
+		if err != nil {
+			return p, err
+		}
+		if page.Paging != nil && page.Paging.Total > 0 {
+			p.total = page.Paging.Total
+		}
+
+		txs := page.Data
+		if len(txs) == 0 {
+			// No more txs in this block range
+			break
+		}
+		res.stats.pages++
+		res.stats.txs += len(txs)
+
+		// Process each transaction, once per hash
+		for _, tx := range txs {
+			if inPass[tx.Hash] {
+				p.overlaps++
+				continue
+			}
+			inPass[tx.Hash] = true
+			p.distinct++
+			if seen[tx.Hash] {
+				continue // parsed in an earlier pass
+			}
+			seen[tx.Hash] = true
+			res.stats.blockTxs[tx.BlockNumber]++
+			res.stats.blockTimes[tx.BlockNumber] = tx.BlockTimestamp
+
+			// 1) (Optional) parse messages if you want
+			// msgRecords := msgParser.ParseTxMessages(tx, orderHashMap)
+
+			// 2) Parse logs for actual events (new orders, cancels, executions, etc.)
+			raw := archive.FromTxData(tx)
+			events, fromDetail, err := txEvents(ctx, client, tx, cfg.Retry)
+			if err != nil {
+				return p, err
+			}
+			if fromDetail {
+				raw.Events = events
+			}
+			res.txs = append(res.txs, raw)
+			res.records = append(res.records, logParser.ParseTxEvents(tx, events, cfg.MarketID)...)
+		}
+
+		// Increase skip by how many Tx we just processed
+		skip += uint64(len(txs))
+
+		// If we got fewer than 'pageSize' Tx, no more results remain in this chunk
+		if len(txs) < int(pageSize) {
+			break
+		}
+	}
+	return p, nil
+}
+
+// sortByBlock puts records and raw txs in ascending block order, keeping the
+// order within a block.
+func sortByBlock(res *chunkResult) {
+	sort.SliceStable(res.records, func(i, j int) bool { return res.records[i].Block < res.records[j].Block })
+	sort.SliceStable(res.txs, func(i, j int) bool { return res.txs[i].Block < res.txs[j].Block })
+}
+
+// txEvents returns the events of tx from its logs. Since SDK 0.50 the per-message
+// logs of a successful tx can be empty; its events are then read from the flat event
+// list of the tx detail, at the cost of one extra call, and fromDetail is true.
+func txEvents(
+	ctx context.Context,
+	client source.TxSource,
+	tx *explorerPB.TxData,
+	policy retry.Policy,
+) (events []types.TxEvent, fromDetail bool, err error) {
+	if events := logParser.ParseEvents(tx.Logs); len(events) > 0 || tx.Code != 0 {
+		return events, false, nil
+	}
+	detail, err := GetTxByTxHashWithRetry(ctx, client, tx.Hash, policy)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get events of tx %s: %w", tx.Hash, err)
+	}
+	if detail.Data == nil {
+		return nil, false, nil
+	}
+	return logParser.EventsFromExplorer(detail.Data.Events), true, nil
+}
+
 // DerivativeTradesConfig configures how we fetch trades
 type DerivativeTradesConfig struct {
 	MarketID   string
@@ -160,11 +525,46 @@ type DerivativeTradesConfig struct {
 	StartBlock uint64 // user-supplied
 	EndBlock   uint64 // user-supplied
 	// We'll dynamically resolve to startTimeMs, endTimeMs
+
+	// Network selects the network and endpoints (default mainnet)
+	Network source.NetworkConfig
+	// Retry is how failed exchange and Explorer calls are retried
+	Retry retry.Policy
+
+	// Skip is the offset of the first page to fetch, e.g. from a TradesError.
+	Skip uint64
+	// CheckpointPath (optional) is where the next skip offset is saved after every
+	// page; it requires a sink.Resumable sink.
+	CheckpointPath string
+	// Resume continues from CheckpointPath (Skip is then ignored).
+	Resume bool
+
+	// Concurrency is how many pages are fetched in parallel (default 1). Pages are
+	// still written, and checkpointed, in order.
+	Concurrency int
+}
+
+// TradesError is returned when RunDerivativeTrades stops before the last page,
+// because a call failed for good or ctx was cancelled. Skip is the offset of the
+// first page that was not written: pass it back as DerivativeTradesConfig.Skip to
+// carry on from there.
+type TradesError struct {
+	Skip   uint64
+	Trades uint64 // trades written before stopping
+	Err    error
+}
+
+func (e *TradesError) Error() string {
+	return fmt.Sprintf("stopped at skip=%d after %d trades: %v", e.Skip, e.Trades, e.Err)
 }
 
-func fetchBlockTimestampMs(ctx context.Context, explorerCl explorerclient.ExplorerClient, blockNum uint64) (int64, error) {
+func (e *TradesError) Unwrap() error { return e.Err }
+
+func fetchBlockTimestampMs(ctx context.Context, explorerCl explorerclient.ExplorerClient, blockNum uint64, policy retry.Policy) (int64, error) {
 	blockStr := strconv.FormatUint(blockNum, 10)
-	blockRes, err := explorerCl.GetBlock(ctx, blockStr)
+	blockRes, err := retry.Do(ctx, policy, "GetBlock", func(ctx context.Context) (*explorerPB.GetBlockResponse, error) {
+		return explorerCl.GetBlock(ctx, blockStr)
+	})
 	if err != nil {
 		return 0, err
 	}
@@ -177,9 +577,27 @@ func fetchBlockTimestampMs(ctx context.Context, explorerCl explorerclient.Explor
 	return t.UnixMilli(), nil
 }
 
-func RunDerivativeTrades(cfg DerivativeTradesConfig, out io.Writer) error {
+// RunDerivativeTrades downloads trades from the exchange API and writes them to out.
+// It flushes out after every page but does not close it.
+//
+// Failed calls are retried as cfg.Retry allows. If a call still fails, or ctx is
+// cancelled, it stops after the last complete page and returns a *TradesError
+// wrapping the cause.
+func RunDerivativeTrades(ctx context.Context, cfg DerivativeTradesConfig, out sink.DerivativeTradeSink) error {
+	var resumable sink.Resumable
+	if cfg.CheckpointPath != "" {
+		r, ok := out.(sink.Resumable)
+		if !ok {
+			return fmt.Errorf("checkpointing needs a resumable sink, %T is not", out)
+		}
+		resumable = r
+	}
+
 	// 1) Create exchange client for the derivative trades
-	network := common.LoadNetwork("mainnet", "lb")
+	network, err := cfg.Network.Load()
+	if err != nil {
+		return err
+	}
 	exchClient, err := exchangeclient.NewExchangeClient(network)
 	if err != nil {
 		return fmt.Errorf("failed to create derivative exchange client: %w", err)
@@ -193,10 +611,8 @@ func RunDerivativeTrades(cfg DerivativeTradesConfig, out io.Writer) error {
 		if err != nil {
 			return fmt.Errorf("failed to create explorer client for block timestamps: %w", err)
 		}
-		ctx := context.Background()
-
 		if cfg.StartBlock != 0 {
-			ts, err := fetchBlockTimestampMs(ctx, explorerCl, cfg.StartBlock)
+			ts, err := fetchBlockTimestampMs(ctx, explorerCl, cfg.StartBlock, cfg.Retry)
 			if err != nil {
 				log.Printf("Warning: can't fetch start block %d => ignoring time filter", cfg.StartBlock)
 			} else {
@@ -204,7 +620,7 @@ func RunDerivativeTrades(cfg DerivativeTradesConfig, out io.Writer) error {
 			}
 		}
 		if cfg.EndBlock != 0 {
-			ts, err := fetchBlockTimestampMs(ctx, explorerCl, cfg.EndBlock)
+			ts, err := fetchBlockTimestampMs(ctx, explorerCl, cfg.EndBlock, cfg.Retry)
 			if err != nil {
 				log.Printf("Warning: can't fetch end block %d => ignoring time filter", cfg.EndBlock)
 			} else {
@@ -213,25 +629,6 @@ func RunDerivativeTrades(cfg DerivativeTradesConfig, out io.Writer) error {
 		}
 	}
 
-	// 3) Prepare CSV
-	writer := csv.NewWriter(out)
-	defer writer.Flush()
-
-	// 4) Write CSV header
-	writer.Write([]string{
-		"TradeId",
-		"MarketId",
-		"OrderHash",
-		"SubaccountId",
-		"ExecPrice",
-		"ExecQuantity",
-		"TradeDirection",
-		"Fee",
-		"IsLiquidation",
-		"ExecutionSide",
-		"Timestamp", // so we can see actual time
-	})
-
 	pageSize := cfg.PageSize
 	if pageSize == 0 {
 		pageSize = 100
@@ -241,11 +638,64 @@ func RunDerivativeTrades(cfg DerivativeTradesConfig, out io.Writer) error {
 		cfg.MarketID, cfg.StartBlock, cfg.EndBlock, pageSize,
 	)
 
-	var skip uint64
-	var totalTrades uint64
-	ctx2 := context.Background()
+	// 3) Work out the first page: from scratch, cfg.Skip, or the checkpoint
+	cp := &TradesCheckpoint{
+		MarketID:   cfg.MarketID,
+		StartBlock: cfg.StartBlock,
+		EndBlock:   cfg.EndBlock,
+		Skip:       cfg.Skip,
+	}
+	if cfg.Resume {
+		if cfg.CheckpointPath == "" {
+			return fmt.Errorf("resume requested but no checkpoint path configured")
+		}
+		prev, err := LoadTradesCheckpoint(cfg.CheckpointPath)
+		if err != nil {
+			return err
+		}
+		if prev != nil {
+			if err := prev.checkResumable(cfg); err != nil {
+				return fmt.Errorf("cannot resume from %s: %w", cfg.CheckpointPath, err)
+			}
+			cp = prev
+			log.Printf("Resuming at skip=%d (%d trades already written)", cp.Skip, cp.Trades)
+		} else {
+			log.Printf("No checkpoint at %s => starting at skip=%d", cfg.CheckpointPath, cp.Skip)
+		}
+	}
 
-	for {
+	// 4) saveProgress makes the written pages durable and records the next skip
+	saveProgress := func() error {
+		if resumable == nil {
+			return out.Flush()
+		}
+		pos, err := resumable.Position()
+		if err != nil {
+			return err
+		}
+		cp.Offsets = pos
+		return cp.Save(cfg.CheckpointPath)
+	}
+	if resumable != nil {
+		// Drop rows written after the checkpoint (or everything, on a fresh start)
+		if err := resumable.Rewind(cp.Offsets); err != nil {
+			return err
+		}
+		if err := saveProgress(); err != nil {
+			return err
+		}
+	}
+
+	skip := cp.Skip
+	totalTrades := cp.Trades
+	stop := func(err error) error {
+		log.Printf("Stopped => %d trades written, next page at skip=%d.", totalTrades, skip)
+		return &TradesError{Skip: skip, Trades: totalTrades, Err: err}
+	}
+
+	// 5) Fetch a page; transient errors are retried in there, anything left is
+	// terminal (bad market ID, retries exhausted...)
+	fetchPage := func(ctx context.Context, skip uint64) ([]*derivativeExchangePB.DerivativeTrade, error) {
 		req := &derivativeExchangePB.TradesV2Request{
 			Skip:      skip,
 			Limit:     int32(pageSize),
@@ -263,23 +713,30 @@ func RunDerivativeTrades(cfg DerivativeTradesConfig, out io.Writer) error {
 			req.EndTime = endTimeMs
 		}
 
-		// 5) Call the endpoint
-		res, err := exchClient.GetDerivativeTradesV2(ctx2, req)
+		res, err := GetDerivativeTradesWithRetry(ctx, exchClient, req, cfg.Retry)
 		if err != nil {
-			log.Printf("GetDerivativeTradesV2 error at skip=%d => %v", skip, err)
-			time.Sleep(2 * time.Second)
-			continue
+			return nil, err
 		}
+		return res.Trades, nil
+	}
 
-		trades := res.Trades
+	// 6) Hand each page to the sink, in order, and report whether it was the last
+	writePage := func(page tradesPage) (bool, error) {
+		if ctx.Err() != nil {
+			return true, stop(ctx.Err())
+		}
+		if page.err != nil {
+			log.Printf("GetDerivativeTradesV2 failed at skip=%d => giving up: %v", skip, page.err)
+			return true, stop(page.err)
+		}
+
+		trades := page.trades
 		if len(trades) == 0 {
 			log.Printf("No more derivative trades => done. skip=%d totalTrades=%d", skip, totalTrades)
-			break
+			return true, nil
 		}
 
-		// 6) Write them to CSV
 		for _, t := range trades {
-			time.Sleep(200 * time.Millisecond)
 			pd := t.PositionDelta
 			if pd == nil {
 				pd = &derivativeExchangePB.PositionDelta{}
@@ -295,33 +752,48 @@ func RunDerivativeTrades(cfg DerivativeTradesConfig, out io.Writer) error {
 			}
 			orderHashB64 := base64.StdEncoding.EncodeToString(raw)
 
-			record := []string{
-				t.TradeId,
-				t.MarketId,
-				orderHashB64,
-				t.SubaccountId,
-				pd.ExecutionPrice,
-				pd.ExecutionQuantity,
-				pd.TradeDirection, // "buy" / "sell"
-				t.Fee,
-				strconv.FormatBool(t.IsLiquidation),
-				t.ExecutionSide, // "maker"/"taker"
+			record := types.DerivativeTradeRecord{
+				TradeID:        t.TradeId,
+				MarketID:       t.MarketId,
+				OrderHash:      orderHashB64,
+				SubaccountID:   t.SubaccountId,
+				ExecPrice:      pd.ExecutionPrice,
+				ExecQuantity:   pd.ExecutionQuantity,
+				TradeDirection: pd.TradeDirection, // "buy" / "sell"
+				Fee:            t.Fee,
+				IsLiquidation:  t.IsLiquidation,
+				ExecutionSide:  t.ExecutionSide, // "maker"/"taker"
+				ExecutedAt:     t.ExecutedAt,
+			}
+			if err := out.WriteDerivativeTrade(record); err != nil {
+				return true, fmt.Errorf("failed to write trade %s: %w", t.TradeId, err)
 			}
-			writer.Write(record)
 		}
-		writer.Flush()
-
 		fetched := uint64(len(trades))
 		totalTrades += fetched
 		skip += fetched
+		cp.Skip, cp.Trades = skip, totalTrades
+		if err := saveProgress(); err != nil {
+			return true, err
+		}
 
 		log.Printf("Fetched %d trades this page, total=%d, new skip=%d", fetched, totalTrades, skip)
 
 		// If we got fewer trades than 'limit', we assume end
 		if fetched < pageSize {
 			log.Printf("We got %d trades, fewer than limit=%d => done", fetched, pageSize)
-			break
+			return true, nil
+		}
+		return false, nil
+	}
+
+	// Pages are fetched cfg.Concurrency at a time but written in skip order
+	if err := runTradesPool(ctx, cfg.Concurrency, skip, pageSize, fetchPage, writePage); err != nil {
+		var stopped *TradesError
+		if !errors.As(err, &stopped) && ctx.Err() != nil {
+			return stop(ctx.Err())
 		}
+		return err
 	}
 
 	log.Printf("Done fetching derivative trades. total=%d", totalTrades)
@@ -0,0 +1,255 @@
+package scanner
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/sink"
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+func TestFetchChunkRepages(t *testing.T) {
+	// 250 txs in [1..50]: pages of 100 at skip 0, 100 and 200
+	tests := []struct {
+		name    string
+		shift   func(n int) int
+		wantTxs int // 0: all of them
+		wantErr bool
+
+		// wantIncomplete: the chunk is kept, but as a hole for the ledger
+		wantIncomplete bool
+	}{
+		{"stable pages", nil, 0, false, false},
+		{"second page moved back", func(n int) int {
+			if n == 1 {
+				return -5 // repeats 5 txs of the first page and misses 5
+			}
+			return 0
+		}, 0, false, false},
+		{"second page moved forward", func(n int) int {
+			if n == 1 {
+				return 5 // misses 5 txs
+			}
+			return 0
+		}, 0, false, false},
+		{"last page moved on two passes", func(n int) int {
+			if n == 2 || n == 5 {
+				return -10
+			}
+			return 0
+		}, 0, false, false},
+		{"same txs missed on every pass", func(n int) int {
+			if n%3 != 0 {
+				return 5 // the pages agree, 5 txs are never seen
+			}
+			return 0
+		}, 245, false, true},
+		{"pages never settle", func(n int) int {
+			switch n % 3 {
+			case 1:
+				return -5
+			case 2:
+				return 10
+			}
+			return 0
+		}, 0, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeSource(1, 50, 5)
+			client.shift = tt.shift
+
+			res := fetchChunk(context.Background(), client, chunkJob{low: 1, high: 50}, types.Config{})
+			if tt.wantErr {
+				if res.err == nil {
+					t.Fatal("fetchChunk succeeded, want an unstable pagination error")
+				}
+				return
+			}
+			if res.err != nil {
+				t.Fatalf("fetchChunk: %v", res.err)
+			}
+
+			seen := make(map[string]bool)
+			var last uint64
+			for _, tx := range res.txs {
+				if seen[tx.Hash] {
+					t.Fatalf("tx %s kept twice", tx.Hash)
+				}
+				seen[tx.Hash] = true
+				if tx.Block < last {
+					t.Fatalf("tx of block %d after block %d", tx.Block, last)
+				}
+				last = tx.Block
+			}
+			switch fc := res.incomplete; {
+			case !tt.wantIncomplete && fc != nil:
+				t.Errorf("chunk kept as incomplete: %+v", *fc)
+			case tt.wantIncomplete && fc == nil:
+				t.Error("chunk kept as complete, want incomplete")
+			case tt.wantIncomplete && (!fc.Kept || fc.Low != 1 || fc.High != 50 ||
+				fc.TxsFetched != tt.wantTxs || fc.ExpectedTxs != len(client.txs)):
+				t.Errorf("incomplete chunk %+v, want [1..50] kept with %d of %d txs", *fc, tt.wantTxs, len(client.txs))
+			}
+
+			want := tt.wantTxs
+			if want == 0 {
+				want = len(client.txs)
+			}
+			if len(seen) != want {
+				t.Errorf("%d txs kept, want %d", len(seen), want)
+			}
+			blockTxs := 0
+			for _, n := range res.stats.blockTxs {
+				blockTxs += n
+			}
+			if blockTxs != want {
+				t.Errorf("blockTxs adds up to %d, want %d", blockTxs, want)
+			}
+		})
+	}
+}
+
+// cancelSink cancels the scan once it has written the order with hash.
+type cancelSink struct {
+	*sink.CSV
+	hash   string
+	cancel func()
+}
+
+func (s cancelSink) WriteOrder(rec types.CSVRecord) error {
+	if err := s.CSV.WriteOrder(rec); err != nil {
+		return err
+	}
+	if rec.OrderHash == s.hash {
+		s.cancel()
+	}
+	return nil
+}
+
+func TestRunScannerResume(t *testing.T) {
+	tests := []struct {
+		name string
+		// stray is how many rows of block 21 reached the orders file after the
+		// last checkpoint, as when the scan is killed while writing a chunk
+		stray int
+	}{
+		{"stopped after a chunk", 0},
+		{"rows past the checkpoint", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeSource(1, 30, 2)
+			withOrders(client)
+
+			dir := t.TempDir()
+			ordersPath, tradesPath := filepath.Join(dir, "orders.csv"), filepath.Join(dir, "trades.csv")
+			cpPath := filepath.Join(dir, "checkpoint.json")
+			open := func() (*sink.CSV, func()) {
+				t.Helper()
+				orders, err := os.OpenFile(ordersPath, os.O_RDWR|os.O_CREATE, 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+				trades, err := os.OpenFile(tradesPath, os.O_RDWR|os.O_CREATE, 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return sink.NewCSV(orders, trades), func() { orders.Close(); trades.Close() }
+			}
+			cfg := types.Config{
+				StartBlock: 1, EndBlock: 30, ChunkBlocks: 10, Concurrency: 1,
+				Source: client, CheckpointPath: cpPath,
+			}
+
+			// 1) Stop in the middle of the second chunk: it is still written whole
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			out, closeFiles := open()
+			err := RunScanner(ctx, cfg, cancelSink{CSV: out, hash: "0x15-1", cancel: cancel})
+			closeFiles()
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("RunScanner = %v, want context.Canceled", err)
+			}
+			cp, err := LoadCheckpoint(cpPath)
+			if err != nil || cp == nil {
+				t.Fatalf("LoadCheckpoint = %v, %v", cp, err)
+			}
+			if cp.NextBlock != 21 {
+				t.Fatalf("checkpoint NextBlock = %d, want 21", cp.NextBlock)
+			}
+
+			// 2) Rows written after the checkpoint was saved
+			f, err := os.OpenFile(ordersPath, os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := csv.NewWriter(f)
+			for i := 0; i < tt.stray; i++ {
+				w.Write(types.CSVRecord{Block: 21, Action: "EVENT_NEW", OrderHash: fmt.Sprintf("0xstray-%d", i)}.AsOrderRow())
+			}
+			w.Flush()
+			f.Close()
+
+			// 3) Resume: trimmed back to the checkpoint, then blocks 21..30
+			cfg.Resume = true
+			out, closeFiles = open()
+			err = RunScanner(context.Background(), cfg, out)
+			closeFiles()
+			if err != nil {
+				t.Fatalf("resumed RunScanner: %v", err)
+			}
+
+			var want []string
+			for b := 1; b <= 30; b++ {
+				want = append(want, fmt.Sprintf("0x%d-0", b), fmt.Sprintf("0x%d-1", b))
+			}
+			var got []string
+			for _, row := range readCSV(t, ordersPath)[1:] {
+				got = append(got, row[0])
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("orders =\n%v\nwant\n%v", got, want)
+			}
+			if rows := readCSV(t, tradesPath); len(rows) != 1 {
+				t.Errorf("trades file has %d rows, want just the header", len(rows))
+			}
+
+			cp, err = LoadCheckpoint(cpPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cp.NextBlock != 31 {
+				t.Errorf("checkpoint NextBlock = %d, want 31", cp.NextBlock)
+			}
+			for key, path := range map[string]string{"orders": ordersPath, "trades": tradesPath} {
+				info, err := os.Stat(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if cp.Offsets[key] != info.Size() {
+					t.Errorf("checkpoint offset of %s = %d, file is %d bytes", key, cp.Offsets[key], info.Size())
+				}
+			}
+		})
+	}
+}
+
+func readCSV(t *testing.T, path string) [][]string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
@@ -0,0 +1,370 @@
+package sink
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+var (
+	OrdersHeader = []string{
+		"OrderHash", "Block", "Action", "Price", "Quantity", "Margin", "OrderType", "SubaccountID", "MarketID",
+	}
+	TradesHeader = []string{
+		"OrderHash", "Block", "Action", "ExecPrice", "ExecQuantity", "ExecFee", "IsBuy", "IsLiquidation", "Pnl", "Payout", "SubaccountID", "MarketID", "ExecMargin",
+	}
+	SpotOrdersHeader = []string{
+		"OrderHash", "Block", "Action", "Price", "Quantity", "QuoteAmount", "OrderType", "SubaccountID", "MarketID",
+	}
+	SpotTradesHeader = []string{
+		"OrderHash", "Block", "Action", "ExecPrice", "ExecQuantity", "QuoteAmount", "ExecFee", "IsBuy", "SubaccountID", "MarketID",
+	}
+	ConditionalOrdersHeader = []string{
+		"OrderHash", "Block", "Action", "TriggerPrice", "Price", "Quantity", "Margin", "OrderType", "IsMarket", "PlacedOrderHash", "SubaccountID", "MarketID",
+	}
+	FundingHeader = []string{
+		"MarketID", "Block", "Timestamp", "CumulativeFunding", "FundingRate", "MarkPrice", "IsHourlyFunding",
+	}
+	FundingPaymentsHeader = []string{
+		"SubaccountID", "MarketID", "Block", "Timestamp", "Quantity", "CumulativeFunding", "FundingDelta", "Payment",
+	}
+	PositionsHeader = []string{
+		"SubaccountID", "MarketID", "Block", "Timestamp", "Change", "Quantity", "EntryPrice", "Margin", "RealizedPnl", "Funding", "Liquidations",
+	}
+	DerivativeTradesHeader = []string{
+		"TradeId",
+		"MarketId",
+		"OrderHash",
+		"SubaccountId",
+		"ExecPrice",
+		"ExecQuantity",
+		"TradeDirection",
+		"Fee",
+		"IsLiquidation",
+		"ExecutionSide",
+		"Timestamp", // so we can see actual time
+	}
+)
+
+// CSV is the default Sink: orders and trades go to two CSV files with fixed headers
+// (see README), spot records to two more if set with WithSpot, conditional
+// orders and funding updates to one more each if set with WithConditional and
+// WithFunding. It is Resumable when every writer is an *os.File.
+type CSV struct {
+	orders, trades         *csvTable
+	spotOrders, spotTrades *csvTable
+	conditional            *csvTable
+	funding                *csvTable
+}
+
+// csvTable is one output file of a CSV sink. Its header is written on first use.
+type csvTable struct {
+	w       io.Writer
+	writer  *csv.Writer
+	header  []string
+	started bool
+}
+
+func newCSVTable(w io.Writer, header []string) *csvTable {
+	return &csvTable{w: w, writer: csv.NewWriter(w), header: header}
+}
+
+func (t *csvTable) start() {
+	if !t.started {
+		t.started = true
+		t.writer.Write(t.header)
+	}
+}
+
+// write adds a row; rows for a table that was not set up are dropped.
+func (t *csvTable) write(row []string) error {
+	if t == nil {
+		return nil
+	}
+	t.start()
+	return t.writer.Write(row)
+}
+
+// NewCSV returns a Sink writing orders and trades CSV rows. Headers are written
+// on first use unless Rewind says the files already have them.
+// Close flushes but does not close orders or trades.
+func NewCSV(orders, trades io.Writer) *CSV {
+	return &CSV{
+		orders: newCSVTable(orders, OrdersHeader),
+		trades: newCSVTable(trades, TradesHeader),
+	}
+}
+
+// WithSpot also writes spot orders and trades, to their own CSVs (see
+// SpotOrdersHeader and SpotTradesHeader). Without it spot records are dropped.
+func (c *CSV) WithSpot(orders, trades io.Writer) *CSV {
+	c.spotOrders = newCSVTable(orders, SpotOrdersHeader)
+	c.spotTrades = newCSVTable(trades, SpotTradesHeader)
+	return c
+}
+
+// WithConditional also writes conditional orders to their own CSV (see
+// ConditionalOrdersHeader). Without it they are dropped.
+func (c *CSV) WithConditional(w io.Writer) *CSV {
+	c.conditional = newCSVTable(w, ConditionalOrdersHeader)
+	return c
+}
+
+// WithFunding also writes funding updates to their own CSV (see FundingHeader).
+// Without it they are dropped.
+func (c *CSV) WithFunding(w io.Writer) *CSV {
+	c.funding = newCSVTable(w, FundingHeader)
+	return c
+}
+
+// tables returns the tables that are set up, by Position key.
+func (c *CSV) tables() map[string]*csvTable {
+	tables := map[string]*csvTable{"orders": c.orders, "trades": c.trades}
+	if c.spotOrders != nil {
+		tables["spot_orders"], tables["spot_trades"] = c.spotOrders, c.spotTrades
+	}
+	if c.conditional != nil {
+		tables["conditional_orders"] = c.conditional
+	}
+	if c.funding != nil {
+		tables["funding"] = c.funding
+	}
+	return tables
+}
+
+func (c *CSV) WriteOrder(rec types.CSVRecord) error {
+	return c.orders.write(rec.AsOrderRow())
+}
+
+func (c *CSV) WriteTrade(rec types.CSVRecord) error {
+	return c.trades.write(rec.AsTradeRow())
+}
+
+func (c *CSV) WriteSpotOrder(rec types.CSVRecord) error {
+	return c.spotOrders.write(rec.AsSpotOrderRow())
+}
+
+func (c *CSV) WriteSpotTrade(rec types.CSVRecord) error {
+	return c.spotTrades.write(rec.AsSpotTradeRow())
+}
+
+func (c *CSV) WriteConditional(rec types.CSVRecord) error {
+	return c.conditional.write(rec.AsConditionalRow())
+}
+
+func (c *CSV) WriteFunding(rec types.CSVRecord) error {
+	return c.funding.write(rec.AsFundingRow())
+}
+
+// Flush writes the headers of files still without rows, and flushes every file.
+func (c *CSV) Flush() error {
+	for _, t := range c.tables() {
+		t.start()
+		t.writer.Flush()
+		if err := t.writer.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *CSV) Close() error {
+	return c.Flush()
+}
+
+// files returns the underlying files by Position key, or an error if a writer is not a file.
+func (c *CSV) files() (map[string]*os.File, error) {
+	files := map[string]*os.File{}
+	for key, t := range c.tables() {
+		f, ok := t.w.(*os.File)
+		if !ok {
+			return nil, fmt.Errorf("csv sink is only resumable when writing to files")
+		}
+		files[key] = f
+	}
+	return files, nil
+}
+
+// Position flushes and syncs the files and returns their sizes as "orders" and
+// "trades" (plus "spot_orders", "spot_trades", "conditional_orders" and "funding").
+func (c *CSV) Position() (Position, error) {
+	files, err := c.files()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Flush(); err != nil {
+		return nil, err
+	}
+
+	pos := Position{}
+	for key, f := range files {
+		if err := f.Sync(); err != nil {
+			return nil, fmt.Errorf("failed to sync %s: %w", f.Name(), err)
+		}
+		off, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		pos[key] = off
+	}
+	return pos, nil
+}
+
+// Rewind truncates the files to pos and appends from there. With a nil pos the
+// files are emptied and fresh headers are written; so are files missing from
+// pos, e.g. when a scan is resumed with spot output added.
+func (c *CSV) Rewind(pos Position) error {
+	files, err := c.files()
+	if err != nil {
+		return err
+	}
+	tables := c.tables()
+	for key, f := range files {
+		off, ok := pos[key]
+		if err := truncateTo(f, off); err != nil {
+			return fmt.Errorf("failed to rewind %s file: %w", strings.ReplaceAll(key, "_", " "), err)
+		}
+		// Resumed files already have their headers
+		tables[key].started = ok
+	}
+	return nil
+}
+
+// truncateTo cuts f back to size and positions the write offset at its end.
+// Anything past size was written after the last checkpoint and would be duplicated.
+func truncateTo(f *os.File, size int64) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < size {
+		return fmt.Errorf("%s is %d bytes, shorter than checkpoint offset %d", f.Name(), info.Size(), size)
+	}
+	if err := f.Truncate(size); err != nil {
+		return err
+	}
+	_, err = f.Seek(size, io.SeekStart)
+	return err
+}
+
+// DerivativeTradesCSV writes RunDerivativeTrades output as CSV.
+type DerivativeTradesCSV struct {
+	w       io.Writer
+	writer  *csv.Writer
+	started bool
+}
+
+// NewDerivativeTradesCSV returns a DerivativeTradeSink writing CSV rows to w.
+// Close flushes but does not close w. It is resumable when w is an *os.File.
+func NewDerivativeTradesCSV(w io.Writer) *DerivativeTradesCSV {
+	return &DerivativeTradesCSV{w: w, writer: csv.NewWriter(w)}
+}
+
+func (c *DerivativeTradesCSV) start() {
+	if !c.started {
+		c.started = true
+		c.writer.Write(DerivativeTradesHeader)
+	}
+}
+
+func (c *DerivativeTradesCSV) WriteDerivativeTrade(rec types.DerivativeTradeRecord) error {
+	c.start()
+	return c.writer.Write(rec.AsRow())
+}
+
+func (c *DerivativeTradesCSV) Flush() error {
+	c.start()
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+func (c *DerivativeTradesCSV) Close() error {
+	return c.Flush()
+}
+
+// Position flushes and syncs the file and returns its size as "trades".
+func (c *DerivativeTradesCSV) Position() (Position, error) {
+	f, ok := c.w.(*os.File)
+	if !ok {
+		return nil, fmt.Errorf("csv sink is only resumable when writing to a file")
+	}
+	if err := c.Flush(); err != nil {
+		return nil, err
+	}
+	if err := f.Sync(); err != nil {
+		return nil, fmt.Errorf("failed to sync %s: %w", f.Name(), err)
+	}
+	off, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	return Position{"trades": off}, nil
+}
+
+// Rewind truncates the file to pos and appends from there. With a nil pos the
+// file is emptied and a fresh header is written.
+func (c *DerivativeTradesCSV) Rewind(pos Position) error {
+	f, ok := c.w.(*os.File)
+	if !ok {
+		return fmt.Errorf("csv sink is only resumable when writing to a file")
+	}
+	if err := truncateTo(f, pos["trades"]); err != nil {
+		return fmt.Errorf("failed to rewind trades file: %w", err)
+	}
+	c.started = pos != nil
+	return nil
+}
+
+// FundingPaymentsCSV writes the payments of a funding.Ledger as CSV.
+type FundingPaymentsCSV struct {
+	table *csvTable
+}
+
+// NewFundingPaymentsCSV returns a FundingPaymentSink writing CSV rows to w.
+// Close flushes but does not close w.
+func NewFundingPaymentsCSV(w io.Writer) *FundingPaymentsCSV {
+	return &FundingPaymentsCSV{table: newCSVTable(w, FundingPaymentsHeader)}
+}
+
+func (c *FundingPaymentsCSV) WriteFundingPayment(p types.FundingPayment) error {
+	return c.table.write(p.AsRow())
+}
+
+func (c *FundingPaymentsCSV) Flush() error {
+	c.table.start()
+	c.table.writer.Flush()
+	return c.table.writer.Error()
+}
+
+func (c *FundingPaymentsCSV) Close() error {
+	return c.Flush()
+}
+
+// PositionsCSV writes the snapshots of a position.Tracker as CSV.
+type PositionsCSV struct {
+	table *csvTable
+}
+
+// NewPositionsCSV returns a PositionSink writing CSV rows to w.
+// Close flushes but does not close w.
+func NewPositionsCSV(w io.Writer) *PositionsCSV {
+	return &PositionsCSV{table: newCSVTable(w, PositionsHeader)}
+}
+
+func (c *PositionsCSV) WritePositionSnapshot(p types.PositionSnapshot) error {
+	return c.table.write(p.AsRow())
+}
+
+func (c *PositionsCSV) Flush() error {
+	c.table.start()
+	c.table.writer.Flush()
+	return c.table.writer.Error()
+}
+
+func (c *PositionsCSV) Close() error {
+	return c.Flush()
+}
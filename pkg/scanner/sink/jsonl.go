@@ -0,0 +1,100 @@
+package sink
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+// JSONL writes every record, orders and trades alike, as one JSON object per line
+// with all CSVRecord fields (see its json tags). Use "action" and "market_type" to
+// tell them apart.
+// It is Resumable when w is an *os.File, e.g. not when streaming to stdout.
+type JSONL struct {
+	w   io.Writer
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+// NewJSONL returns a Sink writing JSON lines to w.
+// Close flushes but does not close w.
+func NewJSONL(w io.Writer) *JSONL {
+	buf := bufio.NewWriter(w)
+	return &JSONL{w: w, buf: buf, enc: json.NewEncoder(buf)}
+}
+
+func (j *JSONL) WriteOrder(rec types.CSVRecord) error {
+	return j.enc.Encode(rec)
+}
+
+func (j *JSONL) WriteTrade(rec types.CSVRecord) error {
+	return j.enc.Encode(rec)
+}
+
+func (j *JSONL) WriteSpotOrder(rec types.CSVRecord) error {
+	return j.enc.Encode(rec)
+}
+
+func (j *JSONL) WriteSpotTrade(rec types.CSVRecord) error {
+	return j.enc.Encode(rec)
+}
+
+func (j *JSONL) WriteConditional(rec types.CSVRecord) error {
+	return j.enc.Encode(rec)
+}
+
+func (j *JSONL) WriteFunding(rec types.CSVRecord) error {
+	return j.enc.Encode(rec)
+}
+
+// Flush pushes buffered lines to w, so a pipe reader sees each chunk as it is written.
+func (j *JSONL) Flush() error {
+	return j.buf.Flush()
+}
+
+func (j *JSONL) Close() error {
+	return j.Flush()
+}
+
+func (j *JSONL) file() (*os.File, error) {
+	f, ok := j.w.(*os.File)
+	if !ok {
+		return nil, fmt.Errorf("jsonl sink is only resumable when writing to a file")
+	}
+	return f, nil
+}
+
+// Position flushes and syncs the file and returns its size as "records".
+func (j *JSONL) Position() (Position, error) {
+	f, err := j.file()
+	if err != nil {
+		return nil, err
+	}
+	if err := j.Flush(); err != nil {
+		return nil, err
+	}
+	if err := f.Sync(); err != nil {
+		return nil, fmt.Errorf("failed to sync %s: %w", f.Name(), err)
+	}
+	off, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	return Position{"records": off}, nil
+}
+
+// Rewind truncates the file to pos and appends from there.
+func (j *JSONL) Rewind(pos Position) error {
+	f, err := j.file()
+	if err != nil {
+		return err
+	}
+	if err := truncateTo(f, pos["records"]); err != nil {
+		return fmt.Errorf("failed to rewind records file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package sink
+
+import (
+	"sync"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+// Memory collects everything in slices, for library callers and experiments.
+type Memory struct {
+	mu               sync.Mutex
+	Orders           []types.CSVRecord
+	Trades           []types.CSVRecord
+	SpotOrders       []types.CSVRecord
+	SpotTrades       []types.CSVRecord
+	Conditionals     []types.CSVRecord
+	Fundings         []types.CSVRecord
+	FundingPayments  []types.FundingPayment
+	DerivativeTrades []types.DerivativeTradeRecord
+}
+
+func (m *Memory) WriteOrder(rec types.CSVRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Orders = append(m.Orders, rec)
+	return nil
+}
+
+func (m *Memory) WriteTrade(rec types.CSVRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Trades = append(m.Trades, rec)
+	return nil
+}
+
+func (m *Memory) WriteSpotOrder(rec types.CSVRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.SpotOrders = append(m.SpotOrders, rec)
+	return nil
+}
+
+func (m *Memory) WriteSpotTrade(rec types.CSVRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.SpotTrades = append(m.SpotTrades, rec)
+	return nil
+}
+
+func (m *Memory) WriteConditional(rec types.CSVRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Conditionals = append(m.Conditionals, rec)
+	return nil
+}
+
+func (m *Memory) WriteFunding(rec types.CSVRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Fundings = append(m.Fundings, rec)
+	return nil
+}
+
+func (m *Memory) WriteFundingPayment(p types.FundingPayment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.FundingPayments = append(m.FundingPayments, p)
+	return nil
+}
+
+func (m *Memory) WriteDerivativeTrade(rec types.DerivativeTradeRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.DerivativeTrades = append(m.DerivativeTrades, rec)
+	return nil
+}
+
+func (m *Memory) Flush() error { return nil }
+func (m *Memory) Close() error { return nil }
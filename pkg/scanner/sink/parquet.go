@@ -0,0 +1,370 @@
+package sink
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"strings"
+
+	sdkmath "cosmossdk.io/math"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+// parquetColumn is one column of a parquet file and how to read it from a record.
+// value returns parquet.NullValue() for a null.
+type parquetColumn struct {
+	name  string
+	node  parquet.Node
+	value func(rec types.CSVRecord) (parquet.Value, error)
+}
+
+var (
+	// 18 decimals is the precision of the chain's LegacyDec; 38 digits fit 16 bytes
+	decimalNode = parquet.Optional(parquet.Decimal(18, 38, parquet.FixedLenByteArrayType(16)))
+	// Low-cardinality strings are dictionary encoded
+	dictStringNode = parquet.Encoded(parquet.String(), &parquet.RLEDictionary)
+)
+
+var orderColumns = []parquetColumn{
+	{"order_hash", parquet.String(), stringColumn(func(r types.CSVRecord) string { return r.OrderHash })},
+	{"block", parquet.Uint(64), blockColumn},
+	{"block_time", parquet.Optional(parquet.Timestamp(parquet.Millisecond)), blockTimeColumn},
+	{"action", dictStringNode, stringColumn(func(r types.CSVRecord) string { return r.Action })},
+	{"price", decimalNode, decimalColumn(func(r types.CSVRecord) string { return r.Price })},
+	{"quantity", decimalNode, decimalColumn(func(r types.CSVRecord) string { return r.Quantity })},
+	{"margin", decimalNode, decimalColumn(func(r types.CSVRecord) string { return r.Margin })},
+	{"order_type", dictStringNode, stringColumn(func(r types.CSVRecord) string { return r.OrderType })},
+	{"subaccount_id", dictStringNode, stringColumn(func(r types.CSVRecord) string { return r.SubaccountID })},
+	{"market_id", dictStringNode, stringColumn(func(r types.CSVRecord) string { return r.MarketID })},
+	{"tx_hash", parquet.String(), stringColumn(func(r types.CSVRecord) string { return r.TxHash })},
+}
+
+var tradeColumns = []parquetColumn{
+	{"order_hash", parquet.String(), stringColumn(func(r types.CSVRecord) string { return r.OrderHash })},
+	{"block", parquet.Uint(64), blockColumn},
+	{"block_time", parquet.Optional(parquet.Timestamp(parquet.Millisecond)), blockTimeColumn},
+	{"action", dictStringNode, stringColumn(func(r types.CSVRecord) string { return r.Action })},
+	{"exec_price", decimalNode, decimalColumn(func(r types.CSVRecord) string { return r.ExecPrice })},
+	{"exec_quantity", decimalNode, decimalColumn(func(r types.CSVRecord) string { return r.ExecQuantity })},
+	{"exec_fee", decimalNode, decimalColumn(func(r types.CSVRecord) string { return r.ExecFee })},
+	{"is_buy", parquet.Leaf(parquet.BooleanType), boolColumn(func(r types.CSVRecord) bool { return r.IsBuy })},
+	{"is_liquidation", parquet.Leaf(parquet.BooleanType), boolColumn(func(r types.CSVRecord) bool { return r.IsLiquidation })},
+	{"pnl", decimalNode, decimalColumn(func(r types.CSVRecord) string { return r.Pnl })},
+	{"payout", decimalNode, decimalColumn(func(r types.CSVRecord) string { return r.Payout })},
+	{"exec_margin", decimalNode, decimalColumn(func(r types.CSVRecord) string { return r.ExecMargin })},
+	{"subaccount_id", dictStringNode, stringColumn(func(r types.CSVRecord) string { return r.SubaccountID })},
+	{"market_id", dictStringNode, stringColumn(func(r types.CSVRecord) string { return r.MarketID })},
+	{"tx_hash", parquet.String(), stringColumn(func(r types.CSVRecord) string { return r.TxHash })},
+}
+
+var spotOrderColumns = []parquetColumn{
+	{"order_hash", parquet.String(), stringColumn(func(r types.CSVRecord) string { return r.OrderHash })},
+	{"block", parquet.Uint(64), blockColumn},
+	{"block_time", parquet.Optional(parquet.Timestamp(parquet.Millisecond)), blockTimeColumn},
+	{"action", dictStringNode, stringColumn(func(r types.CSVRecord) string { return r.Action })},
+	{"price", decimalNode, decimalColumn(func(r types.CSVRecord) string { return r.Price })},
+	{"quantity", decimalNode, decimalColumn(func(r types.CSVRecord) string { return r.Quantity })},
+	{"quote_amount", decimalNode, decimalColumn(func(r types.CSVRecord) string { return r.QuoteAmount })},
+	{"order_type", dictStringNode, stringColumn(func(r types.CSVRecord) string { return r.OrderType })},
+	{"subaccount_id", dictStringNode, stringColumn(func(r types.CSVRecord) string { return r.SubaccountID })},
+	{"market_id", dictStringNode, stringColumn(func(r types.CSVRecord) string { return r.MarketID })},
+	{"tx_hash", parquet.String(), stringColumn(func(r types.CSVRecord) string { return r.TxHash })},
+}
+
+var spotTradeColumns = []parquetColumn{
+	{"order_hash", parquet.String(), stringColumn(func(r types.CSVRecord) string { return r.OrderHash })},
+	{"block", parquet.Uint(64), blockColumn},
+	{"block_time", parquet.Optional(parquet.Timestamp(parquet.Millisecond)), blockTimeColumn},
+	{"action", dictStringNode, stringColumn(func(r types.CSVRecord) string { return r.Action })},
+	{"exec_price", decimalNode, decimalColumn(func(r types.CSVRecord) string { return r.ExecPrice })},
+	{"exec_quantity", decimalNode, decimalColumn(func(r types.CSVRecord) string { return r.ExecQuantity })},
+	{"quote_amount", decimalNode, decimalColumn(func(r types.CSVRecord) string { return r.QuoteAmount })},
+	{"exec_fee", decimalNode, decimalColumn(func(r types.CSVRecord) string { return r.ExecFee })},
+	{"is_buy", parquet.Leaf(parquet.BooleanType), boolColumn(func(r types.CSVRecord) bool { return r.IsBuy })},
+	{"subaccount_id", dictStringNode, stringColumn(func(r types.CSVRecord) string { return r.SubaccountID })},
+	{"market_id", dictStringNode, stringColumn(func(r types.CSVRecord) string { return r.MarketID })},
+	{"tx_hash", parquet.String(), stringColumn(func(r types.CSVRecord) string { return r.TxHash })},
+}
+
+var conditionalColumns = []parquetColumn{
+	{"order_hash", parquet.String(), stringColumn(func(r types.CSVRecord) string { return r.OrderHash })},
+	{"block", parquet.Uint(64), blockColumn},
+	{"block_time", parquet.Optional(parquet.Timestamp(parquet.Millisecond)), blockTimeColumn},
+	{"action", dictStringNode, stringColumn(func(r types.CSVRecord) string { return r.Action })},
+	{"trigger_price", decimalNode, decimalColumn(func(r types.CSVRecord) string { return r.TriggerPrice })},
+	{"price", decimalNode, decimalColumn(func(r types.CSVRecord) string { return r.Price })},
+	{"quantity", decimalNode, decimalColumn(func(r types.CSVRecord) string { return r.Quantity })},
+	{"margin", decimalNode, decimalColumn(func(r types.CSVRecord) string { return r.Margin })},
+	{"order_type", dictStringNode, stringColumn(func(r types.CSVRecord) string { return r.OrderType })},
+	{"is_market", parquet.Leaf(parquet.BooleanType), boolColumn(func(r types.CSVRecord) bool { return r.IsMarket })},
+	{"placed_order_hash", parquet.String(), stringColumn(func(r types.CSVRecord) string { return r.PlacedOrderHash })},
+	{"subaccount_id", dictStringNode, stringColumn(func(r types.CSVRecord) string { return r.SubaccountID })},
+	{"market_id", dictStringNode, stringColumn(func(r types.CSVRecord) string { return r.MarketID })},
+	{"tx_hash", parquet.String(), stringColumn(func(r types.CSVRecord) string { return r.TxHash })},
+}
+
+var fundingColumns = []parquetColumn{
+	{"market_id", dictStringNode, stringColumn(func(r types.CSVRecord) string { return r.MarketID })},
+	{"block", parquet.Uint(64), blockColumn},
+	{"block_time", parquet.Optional(parquet.Timestamp(parquet.Millisecond)), blockTimeColumn},
+	{"cumulative_funding", decimalNode, decimalColumn(func(r types.CSVRecord) string { return r.CumulativeFunding })},
+	{"funding_rate", decimalNode, decimalColumn(func(r types.CSVRecord) string { return r.FundingRate })},
+	{"mark_price", decimalNode, decimalColumn(func(r types.CSVRecord) string { return r.MarkPrice })},
+	{"is_hourly_funding", parquet.Leaf(parquet.BooleanType), boolColumn(func(r types.CSVRecord) bool { return r.IsHourlyFunding })},
+	{"tx_hash", parquet.String(), stringColumn(func(r types.CSVRecord) string { return r.TxHash })},
+}
+
+// ParquetOptions tunes the parquet writers.
+type ParquetOptions struct {
+	// RowGroupRows caps the rows per row group (default 1,000,000).
+	RowGroupRows int64
+	// Compression is one of "zstd" (default), "snappy", "gzip", "lz4" or "none".
+	Compression string
+}
+
+// Parquet writes orders and trades as two typed parquet files: block as uint64,
+// prices and amounts as DECIMAL(38, 18), flags as booleans and the block time as
+// a millisecond timestamp. Like CSV, spot records, conditional orders and funding
+// updates go to files of their own if set with WithSpot, WithConditional and
+// WithFunding, and are dropped otherwise.
+//
+// Flush is a no-op: rows stay buffered until a row group is full, otherwise the
+// per-chunk flushes of RunScanner would produce tiny row groups. Close writes the
+// last row group and the file footers, and must be called. Not Resumable.
+type Parquet struct {
+	orders, trades         *parquetTable
+	spotOrders, spotTrades *parquetTable
+	conditional            *parquetTable
+	funding                *parquetTable
+
+	opts []parquet.WriterOption
+}
+
+// NewParquet returns a Sink writing orders and trades parquet files.
+// Close finishes both files but does not close orders or trades.
+func NewParquet(orders, trades io.Writer, opts ParquetOptions) (*Parquet, error) {
+	codec, err := parquetCodec(opts.Compression)
+	if err != nil {
+		return nil, err
+	}
+	rowGroupRows := opts.RowGroupRows
+	if rowGroupRows <= 0 {
+		rowGroupRows = 1_000_000
+	}
+
+	writerOpts := []parquet.WriterOption{
+		parquet.Compression(codec),
+		parquet.MaxRowsPerRowGroup(rowGroupRows),
+		parquet.CreatedBy("challenge-week scanner", "", ""),
+	}
+	return &Parquet{
+		orders: newParquetTable(orders, "order", orderColumns, writerOpts),
+		trades: newParquetTable(trades, "trade", tradeColumns, writerOpts),
+		opts:   writerOpts,
+	}, nil
+}
+
+// WithSpot also writes spot orders and trades, to their own files.
+func (p *Parquet) WithSpot(orders, trades io.Writer) *Parquet {
+	p.spotOrders = newParquetTable(orders, "spot_order", spotOrderColumns, p.opts)
+	p.spotTrades = newParquetTable(trades, "spot_trade", spotTradeColumns, p.opts)
+	return p
+}
+
+// WithConditional also writes conditional orders to their own file.
+func (p *Parquet) WithConditional(w io.Writer) *Parquet {
+	p.conditional = newParquetTable(w, "conditional_order", conditionalColumns, p.opts)
+	return p
+}
+
+// WithFunding also writes funding updates to their own file.
+func (p *Parquet) WithFunding(w io.Writer) *Parquet {
+	p.funding = newParquetTable(w, "funding", fundingColumns, p.opts)
+	return p
+}
+
+func parquetCodec(name string) (compress.Codec, error) {
+	switch strings.ToLower(name) {
+	case "", "zstd":
+		return &parquet.Zstd, nil
+	case "snappy":
+		return &parquet.Snappy, nil
+	case "gzip":
+		return &parquet.Gzip, nil
+	case "lz4":
+		return &parquet.Lz4Raw, nil
+	case "none":
+		return &parquet.Uncompressed, nil
+	}
+	return nil, fmt.Errorf("unknown parquet compression %q", name)
+}
+
+func (p *Parquet) WriteOrder(rec types.CSVRecord) error {
+	return p.orders.write(rec)
+}
+
+func (p *Parquet) WriteTrade(rec types.CSVRecord) error {
+	return p.trades.write(rec)
+}
+
+func (p *Parquet) WriteSpotOrder(rec types.CSVRecord) error {
+	return p.spotOrders.write(rec)
+}
+
+func (p *Parquet) WriteSpotTrade(rec types.CSVRecord) error {
+	return p.spotTrades.write(rec)
+}
+
+func (p *Parquet) WriteConditional(rec types.CSVRecord) error {
+	return p.conditional.write(rec)
+}
+
+func (p *Parquet) WriteFunding(rec types.CSVRecord) error {
+	return p.funding.write(rec)
+}
+
+func (p *Parquet) Flush() error {
+	return nil
+}
+
+func (p *Parquet) Close() error {
+	tables := []struct {
+		name  string
+		table *parquetTable
+	}{
+		{"orders", p.orders}, {"trades", p.trades},
+		{"spot orders", p.spotOrders}, {"spot trades", p.spotTrades},
+		{"conditional orders", p.conditional}, {"funding", p.funding},
+	}
+	for _, t := range tables {
+		if t.table == nil {
+			continue
+		}
+		if err := t.table.writer.Close(); err != nil {
+			return fmt.Errorf("failed to finish %s parquet: %w", t.name, err)
+		}
+	}
+	return nil
+}
+
+// parquetTable is one parquet file written row by row from a column list.
+type parquetTable struct {
+	writer  *parquet.Writer
+	columns []parquetColumn
+	// index[i] is the leaf column index of columns[i] in the schema
+	index []int
+}
+
+func newParquetTable(out io.Writer, name string, columns []parquetColumn, opts []parquet.WriterOption) *parquetTable {
+	group := parquet.Group{}
+	for _, col := range columns {
+		group[col.name] = col.node
+	}
+	schema := parquet.NewSchema(name, group)
+
+	t := &parquetTable{columns: columns}
+	for _, col := range columns {
+		leaf, _ := schema.Lookup(col.name)
+		t.index = append(t.index, leaf.ColumnIndex)
+	}
+	t.writer = parquet.NewWriter(out, append([]parquet.WriterOption{schema}, opts...)...)
+	return t
+}
+
+// write adds rec as a row. A nil table (not set up) drops it.
+func (t *parquetTable) write(rec types.CSVRecord) error {
+	if t == nil {
+		return nil
+	}
+	row := make(parquet.Row, len(t.columns))
+	for i, col := range t.columns {
+		v, err := col.value(rec)
+		if err != nil {
+			return fmt.Errorf("block %d, column %s: %w", rec.Block, col.name, err)
+		}
+		// Definition level 1 marks a present value in an optional column
+		def := 0
+		if col.node.Optional() && !v.IsNull() {
+			def = 1
+		}
+		row[t.index[i]] = v.Level(0, def, t.index[i])
+	}
+	_, err := t.writer.WriteRows([]parquet.Row{row})
+	return err
+}
+
+func stringColumn(get func(types.CSVRecord) string) func(types.CSVRecord) (parquet.Value, error) {
+	return func(r types.CSVRecord) (parquet.Value, error) {
+		return parquet.ByteArrayValue([]byte(get(r))), nil
+	}
+}
+
+func boolColumn(get func(types.CSVRecord) bool) func(types.CSVRecord) (parquet.Value, error) {
+	return func(r types.CSVRecord) (parquet.Value, error) {
+		return parquet.BooleanValue(get(r)), nil
+	}
+}
+
+// decimalColumn writes a value too large for DECIMAL(38, 18) as null with a warning,
+// rather than failing the scan over one row.
+func decimalColumn(get func(types.CSVRecord) string) func(types.CSVRecord) (parquet.Value, error) {
+	return func(r types.CSVRecord) (parquet.Value, error) {
+		v, err := decimalValue(get(r))
+		if errors.Is(err, errDecimalRange) {
+			log.Printf("Parquet: %v in tx %s (block %d) => written as null", err, r.TxHash, r.Block)
+			return parquet.NullValue(), nil
+		}
+		return v, err
+	}
+}
+
+func blockColumn(r types.CSVRecord) (parquet.Value, error) {
+	return parquet.Int64Value(int64(r.Block)), nil
+}
+
+// blockTimeColumn parses the Explorer block timestamp; a missing one is null.
+func blockTimeColumn(r types.CSVRecord) (parquet.Value, error) {
+	t, err := types.ParseBlockTime(r.BlockTimestamp)
+	if err != nil {
+		return parquet.NullValue(), nil
+	}
+	return parquet.Int64Value(t.UnixMilli()), nil
+}
+
+// maxDecimal is 10^38, the first unscaled value that does not fit DECIMAL(38, 18).
+var maxDecimal = new(big.Int).Exp(big.NewInt(10), big.NewInt(38), nil)
+
+// errDecimalRange is returned by decimalValue for a value that does not fit.
+var errDecimalRange = errors.New("does not fit DECIMAL(38, 18)")
+
+// decimalValue converts a chain decimal string into a DECIMAL(38, 18) value: the
+// unscaled integer as 16 bytes of big-endian two's complement. Empty is null.
+func decimalValue(s string) (parquet.Value, error) {
+	if s == "" {
+		return parquet.NullValue(), nil
+	}
+	dec, err := sdkmath.LegacyNewDecFromStr(s)
+	if err != nil {
+		return parquet.Value{}, err
+	}
+
+	// LegacyDec keeps its value as an integer scaled by 10^18, which is exactly
+	// the unscaled DECIMAL value
+	unscaled := dec.BigInt()
+	if new(big.Int).Abs(unscaled).Cmp(maxDecimal) >= 0 {
+		return parquet.Value{}, fmt.Errorf("%s %w", s, errDecimalRange)
+	}
+
+	// Two's complement: negative values are stored as 2^128 + v
+	if unscaled.Sign() < 0 {
+		unscaled = new(big.Int).Add(unscaled, new(big.Int).Lsh(big.NewInt(1), 128))
+	}
+	out := make([]byte, 16)
+	unscaled.FillBytes(out)
+	return parquet.FixedLenByteArrayValue(out), nil
+}
@@ -0,0 +1,260 @@
+package sink
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+func TestDecimalValue(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string // 16 bytes in hex, "" for null
+		wantErr bool
+	}{
+		{in: "", want: ""},
+		{in: "0", want: "00000000000000000000000000000000"},
+		{in: "1", want: "00000000000000000de0b6b3a7640000"},
+		{in: "-1", want: "fffffffffffffffff21f494c589c0000"},
+		{in: "0.000000000000000001", want: "00000000000000000000000000000001"},
+		{in: "-0.000000000000000001", want: "ffffffffffffffffffffffffffffffff"},
+		{in: "12345678901.234567890123456789", want: "0000000027e41b3246bec9b16e398115"},
+		{in: "99999999999999999999.999999999999999999", want: "4b3b4ca85a86c47a098a223fffffffff"},
+		{in: "-99999999999999999999.999999999999999999", want: "b4c4b357a5793b85f675ddc000000001"},
+		{in: "100000000000000000000", wantErr: true},
+		{in: "-100000000000000000000", wantErr: true},
+		{in: "abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			v, err := decimalValue(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("decimalValue(%q) = %v, want an error", tt.in, v)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decimalValue(%q): %v", tt.in, err)
+			}
+			if tt.want == "" {
+				if !v.IsNull() {
+					t.Errorf("decimalValue(%q) = %v, want null", tt.in, v)
+				}
+				return
+			}
+			if got := hex.EncodeToString(v.ByteArray()); got != tt.want {
+				t.Errorf("decimalValue(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParquetRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	create := func(name string) *os.File {
+		t.Helper()
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { f.Close() })
+		return f
+	}
+	out, err := NewParquet(create("orders.parquet"), create("trades.parquet"), ParquetOptions{RowGroupRows: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.WithSpot(create("spot_orders.parquet"), create("spot_trades.parquet"))
+	out.WithConditional(create("conditional_orders.parquet"))
+	out.WithFunding(create("funding.parquet"))
+
+	const blockTime = "2025-01-02 03:04:05.678 +0000 UTC"
+	for b := uint64(1); b <= 5; b++ {
+		rec := types.CSVRecord{
+			TxHash: fmt.Sprintf("0xtx%d", b), Block: b, BlockTimestamp: blockTime, Action: "EVENT_NEW",
+			MarketID: "0xmarket", MarketType: types.MarketDerivative, OrderHash: fmt.Sprintf("0xorder%d", b),
+			SubaccountID: "0xsub", OrderType: "BUY", Price: "1.5", Quantity: fmt.Sprint(b), Margin: "",
+		}
+		if err := Write(out, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	records := []types.CSVRecord{
+		{TxHash: "0xtx6", Block: 6, BlockTimestamp: blockTime, Action: "EXECUTION", MarketType: types.MarketDerivative,
+			OrderHash: "0xorder1", ExecPrice: "-2.25", ExecQuantity: "3", ExecFee: "0.000000000000000001",
+			ExecMargin: "100", IsBuy: true, IsLiquidation: true, Pnl: "123456789012345678901234", Payout: "0"},
+		{Block: 7, Action: "EVENT_NEW", MarketType: types.MarketSpot, Price: "2", Quantity: "3", QuoteAmount: "6"},
+		{Block: 7, Action: "EXECUTION", MarketType: types.MarketSpot, ExecPrice: "2", ExecQuantity: "1", QuoteAmount: "2"},
+		{Block: 8, Action: "CONDITIONAL_TRIGGER", MarketType: types.MarketDerivative, OrderHash: "0xcond", PlacedOrderHash: "0xplaced", IsMarket: true},
+		{Block: 9, Action: "FUNDING", MarketType: types.MarketDerivative, CumulativeFunding: "12.5", IsHourlyFunding: true},
+	}
+	for _, rec := range records {
+		if err := Write(out, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Column types of the orders file
+	orders := readParquet(t, filepath.Join(dir, "orders.parquet"))
+	if got := rowGroupSizes(orders); fmt.Sprint(got) != "[2 2 1]" {
+		t.Errorf("orders row groups = %v, want [2 2 1]", got)
+	}
+	schema := orders.Schema()
+	lookup := func(name string) parquet.Type {
+		t.Helper()
+		col, ok := schema.Lookup(name)
+		if !ok {
+			t.Fatalf("no column %s", name)
+		}
+		return col.Node.Type()
+	}
+	if d := lookup("price").LogicalType().Decimal; d == nil || d.Scale != 18 || d.Precision != 38 {
+		t.Errorf("price logical type = %v, want DECIMAL(38, 18)", lookup("price").LogicalType())
+	}
+	if i := lookup("block").LogicalType().Integer; i == nil || i.BitWidth != 64 || i.IsSigned {
+		t.Errorf("block logical type = %v, want uint64", lookup("block").LogicalType())
+	}
+	if ts := lookup("block_time").LogicalType().Timestamp; ts == nil || ts.Unit.Millis == nil {
+		t.Errorf("block_time logical type = %v, want a millisecond timestamp", lookup("block_time").LogicalType())
+	}
+	if lookup("order_hash").LogicalType().UTF8 == nil {
+		t.Errorf("order_hash logical type = %v, want a string", lookup("order_hash").LogicalType())
+	}
+
+	// Values
+	rows := readRows(t, orders)
+	if len(rows) != 5 {
+		t.Fatalf("%d orders, want 5", len(rows))
+	}
+	row := rows[2]
+	if got := row.value("block").Int64(); got != 3 {
+		t.Errorf("block = %d, want 3", got)
+	}
+	if got := time.UnixMilli(row.value("block_time").Int64()).UTC().Format(time.RFC3339Nano); got != "2025-01-02T03:04:05.678Z" {
+		t.Errorf("block_time = %s", got)
+	}
+	if got := unscaled(row.value("price")); got != "1500000000000000000" {
+		t.Errorf("price = %s, want 1.5e18 unscaled", got)
+	}
+	if got := unscaled(row.value("quantity")); got != "3000000000000000000" {
+		t.Errorf("quantity = %s, want 3e18 unscaled", got)
+	}
+	if !row.value("margin").IsNull() {
+		t.Errorf("empty margin is not null")
+	}
+	if got := string(row.value("order_hash").ByteArray()); got != "0xorder3" {
+		t.Errorf("order_hash = %s, want 0xorder3", got)
+	}
+
+	trades := readRows(t, readParquet(t, filepath.Join(dir, "trades.parquet")))
+	if len(trades) != 1 {
+		t.Fatalf("%d trades, want 1", len(trades))
+	}
+	trade := trades[0]
+	if got := unscaled(trade.value("exec_price")); got != "-2250000000000000000" {
+		t.Errorf("exec_price = %s, want -2.25e18 unscaled", got)
+	}
+	if got := unscaled(trade.value("exec_fee")); got != "1" {
+		t.Errorf("exec_fee = %s, want 1 unscaled", got)
+	}
+	if got := unscaled(trade.value("exec_margin")); got != "100000000000000000000" {
+		t.Errorf("exec_margin = %s, want 100e18 unscaled", got)
+	}
+	if !trade.value("is_buy").Boolean() || !trade.value("is_liquidation").Boolean() {
+		t.Errorf("is_buy / is_liquidation not set")
+	}
+	if !trade.value("pnl").IsNull() {
+		t.Errorf("out-of-range pnl is not null")
+	}
+
+	// The other files get their records
+	for name, want := range map[string]int{
+		"spot_orders.parquet": 1, "spot_trades.parquet": 1, "conditional_orders.parquet": 1, "funding.parquet": 1,
+	} {
+		if got := readParquet(t, filepath.Join(dir, name)).NumRows(); got != int64(want) {
+			t.Errorf("%s has %d rows, want %d", name, got, want)
+		}
+	}
+	funding := readRows(t, readParquet(t, filepath.Join(dir, "funding.parquet")))
+	if got := unscaled(funding[0].value("cumulative_funding")); got != "12500000000000000000" {
+		t.Errorf("cumulative_funding = %s, want 12.5e18 unscaled", got)
+	}
+}
+
+func readParquet(t *testing.T, path string) *parquet.File {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pf, err := parquet.OpenFile(f, info.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pf
+}
+
+func rowGroupSizes(f *parquet.File) []int64 {
+	var sizes []int64
+	for _, rg := range f.RowGroups() {
+		sizes = append(sizes, rg.NumRows())
+	}
+	return sizes
+}
+
+// parquetRow is a row read back with its schema, to look values up by column name.
+type parquetRow struct {
+	schema *parquet.Schema
+	row    parquet.Row
+}
+
+func (r parquetRow) value(name string) parquet.Value {
+	col, _ := r.schema.Lookup(name)
+	return r.row[col.ColumnIndex]
+}
+
+func readRows(t *testing.T, f *parquet.File) []parquetRow {
+	t.Helper()
+	var out []parquetRow
+	for _, rg := range f.RowGroups() {
+		rows := rg.Rows()
+		buf := make([]parquet.Row, rg.NumRows())
+		n, err := rows.ReadRows(buf)
+		if err != nil && !errors.Is(err, io.EOF) {
+			t.Fatal(err)
+		}
+		rows.Close()
+		for _, row := range buf[:n] {
+			out = append(out, parquetRow{f.Schema(), row})
+		}
+	}
+	return out
+}
+
+// unscaled decodes a DECIMAL(38, 18) value back to its unscaled integer.
+func unscaled(v parquet.Value) string {
+	n := new(big.Int).SetBytes(v.ByteArray())
+	if n.Bit(127) == 1 {
+		n.Sub(n, new(big.Int).Lsh(big.NewInt(1), 128))
+	}
+	return n.String()
+}
@@ -0,0 +1,185 @@
+package sink
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+// RecordReader reads back records written by a sink. Read returns io.EOF at the end.
+type RecordReader interface {
+	Read() (types.CSVRecord, error)
+}
+
+// JSONLReader reads the output of a JSONL sink.
+type JSONLReader struct {
+	dec *json.Decoder
+}
+
+func NewJSONLReader(r io.Reader) *JSONLReader {
+	return &JSONLReader{dec: json.NewDecoder(bufio.NewReader(r))}
+}
+
+func (j *JSONLReader) Read() (types.CSVRecord, error) {
+	var rec types.CSVRecord
+	err := j.dec.Decode(&rec)
+	return rec, err
+}
+
+// CSVReader reads one of the CSV sink files, whichever its header: columns are
+// matched by name and the others are left as in the base record (e.g. Action and
+// MarketType, which most files do not have).
+type CSVReader struct {
+	reader *csv.Reader
+	header []string
+	base   types.CSVRecord
+}
+
+// NewCSVReader reads the header of r and returns a reader of its rows.
+func NewCSVReader(r io.Reader, base types.CSVRecord) (*CSVReader, error) {
+	reader := csv.NewReader(bufio.NewReader(r))
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read csv header: %w", err)
+	}
+	return &CSVReader{reader: reader, header: header, base: base}, nil
+}
+
+// Has reports whether the file has the column name.
+func (c *CSVReader) Has(name string) bool {
+	for _, column := range c.header {
+		if column == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CSVReader) Read() (types.CSVRecord, error) {
+	row, err := c.reader.Read()
+	if err != nil {
+		return types.CSVRecord{}, err
+	}
+	rec := c.base
+	for i, value := range row {
+		if i >= len(c.header) {
+			break
+		}
+		if err := setColumn(&rec, c.header[i], value); err != nil {
+			return rec, err
+		}
+	}
+	return rec, nil
+}
+
+// setColumn sets the field of rec written in the CSV column name.
+func setColumn(rec *types.CSVRecord, name, value string) error {
+	switch name {
+	case "Block":
+		block, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("bad block %q: %w", value, err)
+		}
+		rec.Block = block
+	case "Timestamp":
+		rec.BlockTimestamp = value
+	case "Action":
+		rec.Action = value
+	case "OrderHash":
+		rec.OrderHash = value
+	case "SubaccountID":
+		rec.SubaccountID = value
+	case "MarketID":
+		rec.MarketID = value
+	case "Price":
+		rec.Price = value
+	case "Quantity":
+		rec.Quantity = value
+	case "Margin":
+		rec.Margin = value
+	case "OrderType":
+		rec.OrderType = value
+	case "QuoteAmount":
+		rec.QuoteAmount = value
+	case "ExecPrice":
+		rec.ExecPrice = value
+	case "ExecQuantity":
+		rec.ExecQuantity = value
+	case "ExecFee":
+		rec.ExecFee = value
+	case "ExecMargin":
+		rec.ExecMargin = value
+	case "IsBuy":
+		rec.IsBuy = value == "true"
+	case "IsLiquidation":
+		rec.IsLiquidation = value == "true"
+	case "Pnl":
+		rec.Pnl = value
+	case "Payout":
+		rec.Payout = value
+	case "TriggerPrice":
+		rec.TriggerPrice = value
+	case "IsMarket":
+		rec.IsMarket = value == "true"
+	case "PlacedOrderHash":
+		rec.PlacedOrderHash = value
+	case "CumulativeFunding":
+		rec.CumulativeFunding = value
+	case "FundingRate":
+		rec.FundingRate = value
+	case "MarkPrice":
+		rec.MarkPrice = value
+	case "IsHourlyFunding":
+		rec.IsHourlyFunding = value == "true"
+	}
+	return nil
+}
+
+// MergeByBlock reads every reader to the end and calls fn with their records in
+// block order, each reader being in block order itself. On equal blocks the
+// earlier reader goes first.
+func MergeByBlock(readers []RecordReader, fn func(types.CSVRecord) error) error {
+	heads := make([]*types.CSVRecord, len(readers))
+	next := func(i int) error {
+		rec, err := readers[i].Read()
+		if errors.Is(err, io.EOF) {
+			heads[i] = nil
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		heads[i] = &rec
+		return nil
+	}
+	for i := range readers {
+		if err := next(i); err != nil {
+			return err
+		}
+	}
+
+	for {
+		first := -1
+		for i, head := range heads {
+			if head != nil && (first < 0 || head.Block < heads[first].Block) {
+				first = i
+			}
+		}
+		if first < 0 {
+			return nil
+		}
+		if err := fn(*heads[first]); err != nil {
+			return err
+		}
+		if err := next(first); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package sink
+
+import (
+	"strings"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+// Sink receives the records produced by RunScanner.
+// Orders are EVENT_NEW / EVENT_CANCEL records, trades are EXECUTION records.
+// Records arrive in block order. The caller that created a Sink closes it.
+type Sink interface {
+	WriteOrder(rec types.CSVRecord) error
+	WriteTrade(rec types.CSVRecord) error
+	Flush() error
+	Close() error
+}
+
+// DerivativeTradeSink receives trades downloaded from the exchange API by RunDerivativeTrades.
+type DerivativeTradeSink interface {
+	WriteDerivativeTrade(rec types.DerivativeTradeRecord) error
+	Flush() error
+	Close() error
+}
+
+// Position is an opaque, durable point in a sink's output, e.g. a byte offset per file.
+// It is stored in scan checkpoints.
+type Position map[string]int64
+
+// Resumable is implemented by sinks that RunScanner can checkpoint and resume.
+type Resumable interface {
+	// Position makes everything written so far durable and returns where the output ends.
+	Position() (Position, error)
+	// Rewind discards everything written after pos. A nil pos means start from empty.
+	Rewind(pos Position) error
+}
+
+// SpotSink is implemented by sinks that also take spot market records, kept apart
+// from the derivative ones (e.g. their own files or tables).
+type SpotSink interface {
+	WriteSpotOrder(rec types.CSVRecord) error
+	WriteSpotTrade(rec types.CSVRecord) error
+}
+
+// ConditionalSink is implemented by sinks that also take conditional order records
+// (CONDITIONAL_NEW, CONDITIONAL_CANCEL and CONDITIONAL_TRIGGER).
+type ConditionalSink interface {
+	WriteConditional(rec types.CSVRecord) error
+}
+
+// FundingSink is implemented by sinks that also take FUNDING records.
+type FundingSink interface {
+	WriteFunding(rec types.CSVRecord) error
+}
+
+// FundingPaymentSink receives the payments derived by funding.Ledger.
+type FundingPaymentSink interface {
+	WriteFundingPayment(p types.FundingPayment) error
+	Flush() error
+	Close() error
+}
+
+// PositionSink receives the snapshots written by position.Tracker.
+type PositionSink interface {
+	WritePositionSnapshot(p types.PositionSnapshot) error
+	Flush() error
+	Close() error
+}
+
+// Write routes a parsed record to the matching Sink method. Records of other
+// actions are ignored, and so are spot, conditional and funding records if s is
+// not a SpotSink, ConditionalSink or FundingSink.
+func Write(s Sink, rec types.CSVRecord) error {
+	if rec.Action == "FUNDING" {
+		if funding, ok := s.(FundingSink); ok {
+			return funding.WriteFunding(rec)
+		}
+		return nil
+	}
+	if strings.HasPrefix(rec.Action, "CONDITIONAL_") {
+		if cond, ok := s.(ConditionalSink); ok {
+			return cond.WriteConditional(rec)
+		}
+		return nil
+	}
+	if rec.MarketType == types.MarketSpot {
+		spot, ok := s.(SpotSink)
+		if !ok {
+			return nil
+		}
+		switch rec.Action {
+		case "EVENT_NEW", "EVENT_CANCEL":
+			return spot.WriteSpotOrder(rec)
+		case "EXECUTION":
+			return spot.WriteSpotTrade(rec)
+		}
+		return nil
+	}
+
+	switch rec.Action {
+	case "EVENT_NEW", "EVENT_CANCEL":
+		return s.WriteOrder(rec)
+	case "EXECUTION":
+		return s.WriteTrade(rec)
+	}
+	return nil
+}
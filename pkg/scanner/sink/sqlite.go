@@ -0,0 +1,416 @@
+package sink
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver (pure Go, no cgo)
+
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+// sqliteSchema has one table per record kind. Rows are keyed by (tx_hash, msg_index,
+// event_index, item_index), so writing the same record twice updates it in place,
+// whichever source it was read from (see types.CSVRecord.EventIndex).
+// Decimals are stored as TEXT to keep their full precision.
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS orders (
+		tx_hash       TEXT    NOT NULL,
+		msg_index     INTEGER NOT NULL,
+		event_index   INTEGER NOT NULL,
+		item_index    INTEGER NOT NULL,
+		block         INTEGER NOT NULL,
+		block_time    TEXT,
+		market_id     TEXT    NOT NULL,
+		order_hash    TEXT    NOT NULL,
+		subaccount_id TEXT    NOT NULL,
+		order_type    TEXT    NOT NULL,
+		price         TEXT    NOT NULL,
+		quantity      TEXT    NOT NULL,
+		margin        TEXT    NOT NULL,
+		PRIMARY KEY (tx_hash, msg_index, event_index, item_index)
+	)`,
+	`CREATE TABLE IF NOT EXISTS cancels (
+		tx_hash       TEXT    NOT NULL,
+		msg_index     INTEGER NOT NULL,
+		event_index   INTEGER NOT NULL,
+		item_index    INTEGER NOT NULL,
+		block         INTEGER NOT NULL,
+		block_time    TEXT,
+		market_id     TEXT    NOT NULL,
+		order_hash    TEXT    NOT NULL,
+		subaccount_id TEXT    NOT NULL,
+		order_type    TEXT    NOT NULL,
+		price         TEXT    NOT NULL,
+		quantity      TEXT    NOT NULL,
+		margin        TEXT    NOT NULL,
+		PRIMARY KEY (tx_hash, msg_index, event_index, item_index)
+	)`,
+	`CREATE TABLE IF NOT EXISTS executions (
+		tx_hash        TEXT    NOT NULL,
+		msg_index      INTEGER NOT NULL,
+		event_index    INTEGER NOT NULL,
+		item_index     INTEGER NOT NULL,
+		block          INTEGER NOT NULL,
+		block_time     TEXT,
+		market_id      TEXT    NOT NULL,
+		order_hash     TEXT    NOT NULL,
+		subaccount_id  TEXT    NOT NULL,
+		exec_price     TEXT    NOT NULL,
+		exec_quantity  TEXT    NOT NULL,
+		exec_fee       TEXT    NOT NULL,
+		is_buy         INTEGER NOT NULL,
+		is_liquidation INTEGER NOT NULL,
+		pnl            TEXT    NOT NULL,
+		payout         TEXT    NOT NULL,
+		PRIMARY KEY (tx_hash, msg_index, event_index, item_index)
+	)`,
+	`CREATE TABLE IF NOT EXISTS spot_orders (
+		tx_hash       TEXT    NOT NULL,
+		msg_index     INTEGER NOT NULL,
+		event_index   INTEGER NOT NULL,
+		item_index    INTEGER NOT NULL,
+		block         INTEGER NOT NULL,
+		block_time    TEXT,
+		market_id     TEXT    NOT NULL,
+		order_hash    TEXT    NOT NULL,
+		subaccount_id TEXT    NOT NULL,
+		order_type    TEXT    NOT NULL,
+		price         TEXT    NOT NULL,
+		quantity      TEXT    NOT NULL,
+		quote_amount  TEXT    NOT NULL,
+		PRIMARY KEY (tx_hash, msg_index, event_index, item_index)
+	)`,
+	`CREATE TABLE IF NOT EXISTS spot_cancels (
+		tx_hash       TEXT    NOT NULL,
+		msg_index     INTEGER NOT NULL,
+		event_index   INTEGER NOT NULL,
+		item_index    INTEGER NOT NULL,
+		block         INTEGER NOT NULL,
+		block_time    TEXT,
+		market_id     TEXT    NOT NULL,
+		order_hash    TEXT    NOT NULL,
+		subaccount_id TEXT    NOT NULL,
+		order_type    TEXT    NOT NULL,
+		price         TEXT    NOT NULL,
+		quantity      TEXT    NOT NULL,
+		quote_amount  TEXT    NOT NULL,
+		PRIMARY KEY (tx_hash, msg_index, event_index, item_index)
+	)`,
+	`CREATE TABLE IF NOT EXISTS spot_executions (
+		tx_hash        TEXT    NOT NULL,
+		msg_index      INTEGER NOT NULL,
+		event_index    INTEGER NOT NULL,
+		item_index     INTEGER NOT NULL,
+		block          INTEGER NOT NULL,
+		block_time     TEXT,
+		market_id      TEXT    NOT NULL,
+		order_hash     TEXT    NOT NULL,
+		subaccount_id  TEXT    NOT NULL,
+		exec_price     TEXT    NOT NULL,
+		exec_quantity  TEXT    NOT NULL,
+		quote_amount   TEXT    NOT NULL,
+		exec_fee       TEXT    NOT NULL,
+		is_buy         INTEGER NOT NULL,
+		PRIMARY KEY (tx_hash, msg_index, event_index, item_index)
+	)`,
+	`CREATE TABLE IF NOT EXISTS conditional_orders (
+		tx_hash           TEXT    NOT NULL,
+		msg_index         INTEGER NOT NULL,
+		event_index       INTEGER NOT NULL,
+		item_index        INTEGER NOT NULL,
+		block             INTEGER NOT NULL,
+		block_time        TEXT,
+		action            TEXT    NOT NULL,
+		market_id         TEXT    NOT NULL,
+		order_hash        TEXT    NOT NULL,
+		subaccount_id     TEXT    NOT NULL,
+		order_type        TEXT    NOT NULL,
+		trigger_price     TEXT    NOT NULL,
+		price             TEXT    NOT NULL,
+		quantity          TEXT    NOT NULL,
+		margin            TEXT    NOT NULL,
+		is_market         INTEGER NOT NULL,
+		placed_order_hash TEXT    NOT NULL,
+		PRIMARY KEY (tx_hash, msg_index, event_index, item_index)
+	)`,
+	`CREATE TABLE IF NOT EXISTS funding (
+		tx_hash            TEXT    NOT NULL,
+		msg_index          INTEGER NOT NULL,
+		event_index        INTEGER NOT NULL,
+		item_index         INTEGER NOT NULL,
+		block              INTEGER NOT NULL,
+		block_time         TEXT,
+		market_id          TEXT    NOT NULL,
+		cumulative_funding TEXT    NOT NULL,
+		funding_rate       TEXT    NOT NULL,
+		mark_price         TEXT    NOT NULL,
+		is_hourly_funding  INTEGER NOT NULL,
+		PRIMARY KEY (tx_hash, msg_index, event_index, item_index)
+	)`,
+	`CREATE INDEX IF NOT EXISTS orders_block ON orders (block)`,
+	`CREATE INDEX IF NOT EXISTS orders_order_hash ON orders (order_hash)`,
+	`CREATE INDEX IF NOT EXISTS cancels_block ON cancels (block)`,
+	`CREATE INDEX IF NOT EXISTS cancels_order_hash ON cancels (order_hash)`,
+	`CREATE INDEX IF NOT EXISTS executions_block ON executions (block)`,
+	`CREATE INDEX IF NOT EXISTS executions_order_hash ON executions (order_hash)`,
+	`CREATE INDEX IF NOT EXISTS executions_subaccount ON executions (subaccount_id, block)`,
+	`CREATE INDEX IF NOT EXISTS spot_orders_block ON spot_orders (block)`,
+	`CREATE INDEX IF NOT EXISTS spot_cancels_block ON spot_cancels (block)`,
+	`CREATE INDEX IF NOT EXISTS spot_executions_block ON spot_executions (block)`,
+	`CREATE INDEX IF NOT EXISTS spot_executions_subaccount ON spot_executions (subaccount_id, block)`,
+	`CREATE INDEX IF NOT EXISTS conditional_orders_block ON conditional_orders (block)`,
+	`CREATE INDEX IF NOT EXISTS conditional_orders_order_hash ON conditional_orders (order_hash)`,
+	`CREATE INDEX IF NOT EXISTS conditional_orders_placed ON conditional_orders (placed_order_hash)`,
+	`CREATE INDEX IF NOT EXISTS funding_market ON funding (market_id, block)`,
+}
+
+const upsertOrderColumns = `(tx_hash, msg_index, event_index, item_index, block, block_time, market_id,
+		order_hash, subaccount_id, order_type, price, quantity, margin)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (tx_hash, msg_index, event_index, item_index) DO UPDATE SET
+		block = excluded.block, block_time = excluded.block_time, market_id = excluded.market_id,
+		order_hash = excluded.order_hash, subaccount_id = excluded.subaccount_id,
+		order_type = excluded.order_type, price = excluded.price, quantity = excluded.quantity,
+		margin = excluded.margin`
+
+var (
+	upsertOrder  = `INSERT INTO orders ` + upsertOrderColumns
+	upsertCancel = `INSERT INTO cancels ` + upsertOrderColumns
+)
+
+const upsertExecution = `INSERT INTO executions (tx_hash, msg_index, event_index, item_index, block, block_time,
+		market_id, order_hash, subaccount_id, exec_price, exec_quantity, exec_fee, is_buy,
+		is_liquidation, pnl, payout)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (tx_hash, msg_index, event_index, item_index) DO UPDATE SET
+		block = excluded.block, block_time = excluded.block_time, market_id = excluded.market_id,
+		order_hash = excluded.order_hash, subaccount_id = excluded.subaccount_id,
+		exec_price = excluded.exec_price, exec_quantity = excluded.exec_quantity,
+		exec_fee = excluded.exec_fee, is_buy = excluded.is_buy,
+		is_liquidation = excluded.is_liquidation, pnl = excluded.pnl, payout = excluded.payout`
+
+const upsertSpotOrderColumns = `(tx_hash, msg_index, event_index, item_index, block, block_time, market_id,
+		order_hash, subaccount_id, order_type, price, quantity, quote_amount)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (tx_hash, msg_index, event_index, item_index) DO UPDATE SET
+		block = excluded.block, block_time = excluded.block_time, market_id = excluded.market_id,
+		order_hash = excluded.order_hash, subaccount_id = excluded.subaccount_id,
+		order_type = excluded.order_type, price = excluded.price, quantity = excluded.quantity,
+		quote_amount = excluded.quote_amount`
+
+var (
+	upsertSpotOrder  = `INSERT INTO spot_orders ` + upsertSpotOrderColumns
+	upsertSpotCancel = `INSERT INTO spot_cancels ` + upsertSpotOrderColumns
+)
+
+const upsertSpotExecution = `INSERT INTO spot_executions (tx_hash, msg_index, event_index, item_index, block,
+		block_time, market_id, order_hash, subaccount_id, exec_price, exec_quantity, quote_amount,
+		exec_fee, is_buy)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (tx_hash, msg_index, event_index, item_index) DO UPDATE SET
+		block = excluded.block, block_time = excluded.block_time, market_id = excluded.market_id,
+		order_hash = excluded.order_hash, subaccount_id = excluded.subaccount_id,
+		exec_price = excluded.exec_price, exec_quantity = excluded.exec_quantity,
+		quote_amount = excluded.quote_amount, exec_fee = excluded.exec_fee, is_buy = excluded.is_buy`
+
+const upsertConditional = `INSERT INTO conditional_orders (tx_hash, msg_index, event_index, item_index, block,
+		block_time, action, market_id, order_hash, subaccount_id, order_type, trigger_price, price,
+		quantity, margin, is_market, placed_order_hash)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (tx_hash, msg_index, event_index, item_index) DO UPDATE SET
+		block = excluded.block, block_time = excluded.block_time, action = excluded.action,
+		market_id = excluded.market_id, order_hash = excluded.order_hash,
+		subaccount_id = excluded.subaccount_id, order_type = excluded.order_type,
+		trigger_price = excluded.trigger_price, price = excluded.price, quantity = excluded.quantity,
+		margin = excluded.margin, is_market = excluded.is_market,
+		placed_order_hash = excluded.placed_order_hash`
+
+const upsertFunding = `INSERT INTO funding (tx_hash, msg_index, event_index, item_index, block, block_time,
+		market_id, cumulative_funding, funding_rate, mark_price, is_hourly_funding)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (tx_hash, msg_index, event_index, item_index) DO UPDATE SET
+		block = excluded.block, block_time = excluded.block_time, market_id = excluded.market_id,
+		cumulative_funding = excluded.cumulative_funding, funding_rate = excluded.funding_rate,
+		mark_price = excluded.mark_price, is_hourly_funding = excluded.is_hourly_funding`
+
+// SQLite writes orders, cancels and executions into a SQLite database with upserts,
+// so scanning a range that overlaps what is already stored leaves no duplicates.
+// Spot records go to the spot_orders, spot_cancels and spot_executions tables, and
+// conditional orders (new, cancelled and triggered alike) to conditional_orders,
+// and funding updates to funding.
+//
+// Writes are batched in a transaction that Flush commits (RunScanner flushes once
+// per chunk). It is Resumable, but since rows are keyed there is nothing to
+// discard: Rewind keeps the database as it is, even for a fresh scan.
+type SQLite struct {
+	db *sql.DB
+	tx *sql.Tx
+}
+
+// NewSQLite opens (or creates) the database at path and its tables.
+// Close commits pending writes and closes the database.
+func NewSQLite(path string) (*SQLite, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	// A single connection: transactions and pragmas apply to it
+	db.SetMaxOpenConns(1)
+
+	stmts := append([]string{
+		`PRAGMA journal_mode = WAL`,
+		`PRAGMA synchronous = NORMAL`,
+	}, sqliteSchema...)
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to set up %s: %w", path, err)
+		}
+	}
+	// Tables of older scans are keyed without msg_index and cannot be upserted into
+	if _, err := db.Exec(`SELECT msg_index FROM orders LIMIT 0`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s was written by an older scanner without msg_index keys; scan into a new database", path)
+	}
+	return &SQLite{db: db}, nil
+}
+
+// begin opens the batch transaction on first use.
+func (s *SQLite) begin() (*sql.Tx, error) {
+	if s.tx == nil {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return nil, err
+		}
+		s.tx = tx
+	}
+	return s.tx, nil
+}
+
+func (s *SQLite) WriteOrder(rec types.CSVRecord) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+
+	query := upsertOrder
+	if rec.Action == "EVENT_CANCEL" {
+		query = upsertCancel
+	}
+	_, err = tx.Exec(query,
+		rec.TxHash, rec.MsgIndex, rec.EventIndex, rec.ItemIndex, int64(rec.Block), sqliteTime(rec.BlockTimestamp),
+		rec.MarketID, rec.OrderHash, rec.SubaccountID, rec.OrderType, rec.Price, rec.Quantity, rec.Margin,
+	)
+	return err
+}
+
+func (s *SQLite) WriteTrade(rec types.CSVRecord) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(upsertExecution,
+		rec.TxHash, rec.MsgIndex, rec.EventIndex, rec.ItemIndex, int64(rec.Block), sqliteTime(rec.BlockTimestamp),
+		rec.MarketID, rec.OrderHash, rec.SubaccountID, rec.ExecPrice, rec.ExecQuantity, rec.ExecFee,
+		rec.IsBuy, rec.IsLiquidation, rec.Pnl, rec.Payout,
+	)
+	return err
+}
+
+func (s *SQLite) WriteSpotOrder(rec types.CSVRecord) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+
+	query := upsertSpotOrder
+	if rec.Action == "EVENT_CANCEL" {
+		query = upsertSpotCancel
+	}
+	_, err = tx.Exec(query,
+		rec.TxHash, rec.MsgIndex, rec.EventIndex, rec.ItemIndex, int64(rec.Block), sqliteTime(rec.BlockTimestamp),
+		rec.MarketID, rec.OrderHash, rec.SubaccountID, rec.OrderType, rec.Price, rec.Quantity, rec.QuoteAmount,
+	)
+	return err
+}
+
+func (s *SQLite) WriteSpotTrade(rec types.CSVRecord) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(upsertSpotExecution,
+		rec.TxHash, rec.MsgIndex, rec.EventIndex, rec.ItemIndex, int64(rec.Block), sqliteTime(rec.BlockTimestamp),
+		rec.MarketID, rec.OrderHash, rec.SubaccountID, rec.ExecPrice, rec.ExecQuantity, rec.QuoteAmount,
+		rec.ExecFee, rec.IsBuy,
+	)
+	return err
+}
+
+func (s *SQLite) WriteConditional(rec types.CSVRecord) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(upsertConditional,
+		rec.TxHash, rec.MsgIndex, rec.EventIndex, rec.ItemIndex, int64(rec.Block), sqliteTime(rec.BlockTimestamp),
+		rec.Action, rec.MarketID, rec.OrderHash, rec.SubaccountID, rec.OrderType, rec.TriggerPrice,
+		rec.Price, rec.Quantity, rec.Margin, rec.IsMarket, rec.PlacedOrderHash,
+	)
+	return err
+}
+
+func (s *SQLite) WriteFunding(rec types.CSVRecord) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(upsertFunding,
+		rec.TxHash, rec.MsgIndex, rec.EventIndex, rec.ItemIndex, int64(rec.Block), sqliteTime(rec.BlockTimestamp),
+		rec.MarketID, rec.CumulativeFunding, rec.FundingRate, rec.MarkPrice, rec.IsHourlyFunding,
+	)
+	return err
+}
+
+// Flush commits the pending batch.
+func (s *SQLite) Flush() error {
+	if s.tx == nil {
+		return nil
+	}
+	err := s.tx.Commit()
+	s.tx = nil
+	return err
+}
+
+func (s *SQLite) Close() error {
+	if err := s.Flush(); err != nil {
+		s.db.Close()
+		return err
+	}
+	return s.db.Close()
+}
+
+// Position commits the pending batch. The database has no offsets to record.
+func (s *SQLite) Position() (Position, error) {
+	if err := s.Flush(); err != nil {
+		return nil, err
+	}
+	return Position{}, nil
+}
+
+// Rewind is a no-op: rows written after the checkpoint are simply upserted again.
+func (s *SQLite) Rewind(pos Position) error {
+	return nil
+}
+
+// sqliteTime formats the Explorer block timestamp as RFC 3339 in UTC (SQLite's
+// date functions understand it), or NULL if it is missing.
+func sqliteTime(raw string) any {
+	t, err := types.ParseBlockTime(raw)
+	if err != nil {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,140 @@
+package sink
+
+import (
+	"path/filepath"
+	"testing"
+
+	explorerPB "github.com/InjectiveLabs/sdk-go/exchange/explorer_rpc/pb"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/logs"
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+// The same tx in both representations of tx.Logs: two messages, each placing an
+// order that fills. The flat list also has the tx-level fee events.
+const (
+	perMessageLogs = `[
+		{"msg_index":"0","events":[
+			{"type":"message","attributes":[{"key":"action","value":"/injective.exchange.v1beta1.MsgCreateDerivativeLimitOrder"}]},
+			{"type":"injective.exchange.v1beta1.EventNewDerivativeOrders","attributes":[
+				{"key":"market_id","value":"\"0xmarket\""},
+				{"key":"buy_orders","value":"[{\"order_info\":{\"subaccount_id\":\"0xsub\",\"price\":\"100\",\"quantity\":\"2\"},\"order_type\":\"BUY\",\"margin\":\"200\",\"order_hash\":\"0xorder1\"}]"},
+				{"key":"sell_orders","value":"[]"}]},
+			{"type":"injective.exchange.v1beta1.EventBatchDerivativeExecution","attributes":[
+				{"key":"market_id","value":"\"0xmarket\""},
+				{"key":"is_buy","value":"true"},
+				{"key":"trades","value":"[{\"subaccount_id\":\"0xsub\",\"order_hash\":\"0xorder1\",\"fee\":\"0.2\",\"payout\":\"0\",\"pnl\":\"0\",\"position_delta\":{\"is_long\":true,\"execution_quantity\":\"2\",\"execution_margin\":\"200\",\"execution_price\":\"100\"}}]"}]}]},
+		{"msg_index":"1","events":[
+			{"type":"message","attributes":[{"key":"action","value":"/injective.exchange.v1beta1.MsgCreateDerivativeLimitOrder"}]},
+			{"type":"injective.exchange.v1beta1.EventBatchDerivativeExecution","attributes":[
+				{"key":"market_id","value":"\"0xmarket\""},
+				{"key":"is_buy","value":"false"},
+				{"key":"trades","value":"[{\"subaccount_id\":\"0xsub\",\"order_hash\":\"0xorder2\",\"fee\":\"0.1\",\"payout\":\"0\",\"pnl\":\"0\",\"position_delta\":{\"is_long\":false,\"execution_quantity\":\"1\",\"execution_margin\":\"100\",\"execution_price\":\"101\"}}]"}]}]}
+	]`
+
+	flatEvents = `[
+		{"type":"tx","attributes":[{"key":"fee","value":"100000inj"},{"key":"fee_payer","value":"inj1payer"}]},
+		{"type":"tx","attributes":[{"key":"acc_seq","value":"inj1payer/7"}]},
+		{"type":"message","attributes":[{"key":"action","value":"/injective.exchange.v1beta1.MsgCreateDerivativeLimitOrder"},{"key":"msg_index","value":"0"}]},
+		{"type":"injective.exchange.v1beta1.EventNewDerivativeOrders","attributes":[
+			{"key":"market_id","value":"\"0xmarket\""},
+			{"key":"buy_orders","value":"[{\"order_info\":{\"subaccount_id\":\"0xsub\",\"price\":\"100\",\"quantity\":\"2\"},\"order_type\":\"BUY\",\"margin\":\"200\",\"order_hash\":\"0xorder1\"}]"},
+			{"key":"sell_orders","value":"[]"},
+			{"key":"msg_index","value":"0"}]},
+		{"type":"injective.exchange.v1beta1.EventBatchDerivativeExecution","attributes":[
+			{"key":"market_id","value":"\"0xmarket\""},
+			{"key":"is_buy","value":"true"},
+			{"key":"trades","value":"[{\"subaccount_id\":\"0xsub\",\"order_hash\":\"0xorder1\",\"fee\":\"0.2\",\"payout\":\"0\",\"pnl\":\"0\",\"position_delta\":{\"is_long\":true,\"execution_quantity\":\"2\",\"execution_margin\":\"200\",\"execution_price\":\"100\"}}]"},
+			{"key":"msg_index","value":"0"}]},
+		{"type":"message","attributes":[{"key":"action","value":"/injective.exchange.v1beta1.MsgCreateDerivativeLimitOrder"},{"key":"msg_index","value":"1"}]},
+		{"type":"injective.exchange.v1beta1.EventBatchDerivativeExecution","attributes":[
+			{"key":"market_id","value":"\"0xmarket\""},
+			{"key":"is_buy","value":"false"},
+			{"key":"trades","value":"[{\"subaccount_id\":\"0xsub\",\"order_hash\":\"0xorder2\",\"fee\":\"0.1\",\"payout\":\"0\",\"pnl\":\"0\",\"position_delta\":{\"is_long\":false,\"execution_quantity\":\"1\",\"execution_margin\":\"100\",\"execution_price\":\"101\"}}]"},
+			{"key":"msg_index","value":"1"}]}
+	]`
+)
+
+func TestSQLiteUpsert(t *testing.T) {
+	tx := &explorerPB.TxData{Hash: "0xtx", BlockNumber: 100, BlockTimestamp: "2025-01-01 00:00:00 +0000 UTC"}
+	fromLogs := logs.ParseTxEvents(tx, logs.ParseEvents([]byte(perMessageLogs)), "")
+	fromFlat := logs.ParseTxEvents(tx, logs.ParseEvents([]byte(flatEvents)), "")
+	if len(fromLogs) != 3 || len(fromFlat) != 3 {
+		t.Fatalf("parsed %d records from the logs and %d from the flat events, want 3 each", len(fromLogs), len(fromFlat))
+	}
+
+	db, err := NewSQLite(filepath.Join(t.TempDir(), "scan.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	write := func(records []types.CSVRecord) {
+		t.Helper()
+		for _, rec := range records {
+			if err := Write(db, rec); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := db.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	count := func(table string) int {
+		t.Helper()
+		var n int
+		if err := db.db.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	// 1) The range as read from the Explorer, then again from the chain
+	write(fromLogs)
+	write(fromFlat)
+	if got := count("orders"); got != 1 {
+		t.Errorf("%d orders, want 1", got)
+	}
+	if got := count("executions"); got != 2 {
+		t.Errorf("%d executions, want 2", got)
+	}
+
+	// 2) Re-writing the range updates the rows in place
+	for i := range fromLogs {
+		if fromLogs[i].Action == "EXECUTION" {
+			fromLogs[i].ExecFee = "0.3"
+		}
+	}
+	write(fromLogs)
+	if got := count("executions"); got != 2 {
+		t.Errorf("%d executions after the re-write, want 2", got)
+	}
+	var fee string
+	err = db.db.QueryRow(`SELECT exec_fee FROM executions WHERE tx_hash = '0xtx' AND msg_index = 1 AND event_index = 0 AND item_index = 0`).Scan(&fee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fee != "0.3" {
+		t.Errorf("exec_fee = %s after the re-write, want 0.3", fee)
+	}
+}
+
+func TestNewSQLiteRefusesOldSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.db")
+	db, err := NewSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An orders table as older scanners created it
+	for _, stmt := range []string{`DROP TABLE orders`, `CREATE TABLE orders (tx_hash TEXT, event_index INTEGER, item_index INTEGER)`} {
+		if _, err := db.db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	if db, err := NewSQLite(path); err == nil {
+		db.Close()
+		t.Fatal("NewSQLite opened a database without msg_index keys")
+	}
+}
@@ -0,0 +1,100 @@
+package sink
+
+import (
+	"fmt"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+// Tee is a Sink writing every record to a primary sink and to others, e.g. a
+// position.Tracker next to the CSV output. Spot, conditional and funding records
+// go to the sinks that take them. Checkpoints only cover the primary sink: the
+// others are not rewound on resume.
+type Tee struct {
+	primary Sink
+	others  []Sink
+}
+
+func NewTee(primary Sink, others ...Sink) *Tee {
+	return &Tee{primary: primary, others: others}
+}
+
+func (t *Tee) each(fn func(Sink) error) error {
+	if err := fn(t.primary); err != nil {
+		return err
+	}
+	for _, s := range t.others {
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Tee) WriteOrder(rec types.CSVRecord) error {
+	return t.each(func(s Sink) error { return s.WriteOrder(rec) })
+}
+
+func (t *Tee) WriteTrade(rec types.CSVRecord) error {
+	return t.each(func(s Sink) error { return s.WriteTrade(rec) })
+}
+
+func (t *Tee) WriteSpotOrder(rec types.CSVRecord) error {
+	return t.write(rec)
+}
+
+func (t *Tee) WriteSpotTrade(rec types.CSVRecord) error {
+	return t.write(rec)
+}
+
+func (t *Tee) WriteConditional(rec types.CSVRecord) error {
+	return t.write(rec)
+}
+
+func (t *Tee) WriteFunding(rec types.CSVRecord) error {
+	return t.write(rec)
+}
+
+// write routes rec to each sink as Write does, for the optional record kinds.
+func (t *Tee) write(rec types.CSVRecord) error {
+	return t.each(func(s Sink) error { return Write(s, rec) })
+}
+
+func (t *Tee) Flush() error {
+	return t.each(func(s Sink) error { return s.Flush() })
+}
+
+// Close closes every sink, returning the first error.
+func (t *Tee) Close() error {
+	var first error
+	t.each(func(s Sink) error {
+		if err := s.Close(); err != nil && first == nil {
+			first = err
+		}
+		return nil
+	})
+	return first
+}
+
+// Position flushes the other sinks and returns the primary sink's position.
+func (t *Tee) Position() (Position, error) {
+	r, ok := t.primary.(Resumable)
+	if !ok {
+		return nil, fmt.Errorf("checkpointing needs a resumable sink, %T is not", t.primary)
+	}
+	for _, s := range t.others {
+		if err := s.Flush(); err != nil {
+			return nil, err
+		}
+	}
+	return r.Position()
+}
+
+// Rewind rewinds the primary sink only.
+func (t *Tee) Rewind(pos Position) error {
+	r, ok := t.primary.(Resumable)
+	if !ok {
+		return fmt.Errorf("checkpointing needs a resumable sink, %T is not", t.primary)
+	}
+	return r.Rewind(pos)
+}
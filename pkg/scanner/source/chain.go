@@ -0,0 +1,328 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	explorerPB "github.com/InjectiveLabs/sdk-go/exchange/explorer_rpc/pb"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/retry"
+)
+
+// chainPollInterval is how often the chain source checks for new blocks in StreamTxs.
+const chainPollInterval = time.Second
+
+// Chain reads straight from a CometBFT RPC node (tx_search, block, blockchain, header, status),
+// e.g. our own archive node, and translates the results to Explorer types.
+//
+// Tx messages are protobuf on the chain and are not decoded: TxData.Messages is
+// empty. Logs hold the tx's per-message logs when the node still has them (SDK < 0.50),
+// otherwise its flat event list; logs.ParseEvents reads both.
+type Chain struct {
+	rpc *RPC
+
+	mu         sync.Mutex
+	blockTimes map[uint64]string
+}
+
+// NewChain returns a source reading from the CometBFT RPC at endpoint. The node must
+// index txs (tx_index = "kv") for GetTxs to work.
+//
+// Every request to the node waits for policy.Limiter, including the header lookups
+// inside GetTxs, but is made once: callers retry source calls as a whole (see
+// scanner.GetTxsWithRetry), so retrying here too would multiply the attempts.
+func NewChain(endpoint string, policy retry.Policy) *Chain {
+	policy.MaxAttempts = 1
+	return &Chain{rpc: NewRPC(endpoint, policy), blockTimes: make(map[uint64]string)}
+}
+
+type rpcEvent struct {
+	Type       string `json:"type"`
+	Attributes []struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+		Index bool   `json:"index"`
+	} `json:"attributes"`
+}
+
+type rpcTx struct {
+	Hash     string `json:"hash"`
+	Height   string `json:"height"`
+	TxResult struct {
+		Code      uint32     `json:"code"`
+		Log       string     `json:"log"`
+		Codespace string     `json:"codespace"`
+		Events    []rpcEvent `json:"events"`
+	} `json:"tx_result"`
+}
+
+// GetTxs pages through tx_search for the block range, oldest first.
+// req.Skip must be a multiple of req.Limit.
+func (c *Chain) GetTxs(ctx context.Context, req *explorerPB.GetTxsRequest) (*explorerPB.GetTxsResponse, error) {
+	perPage := uint64(req.Limit)
+	if perPage == 0 || perPage > 100 {
+		perPage = 100
+	}
+	if req.Skip%perPage != 0 {
+		return nil, fmt.Errorf("chain source: skip %d is not a multiple of limit %d", req.Skip, perPage)
+	}
+	page := req.Skip/perPage + 1
+
+	var res struct {
+		Txs        []rpcTx `json:"txs"`
+		TotalCount string  `json:"total_count"`
+	}
+	params := url.Values{
+		"query":    {fmt.Sprintf(`"tx.height>=%d AND tx.height<=%d"`, req.After, req.Before)},
+		"page":     {strconv.FormatUint(page, 10)},
+		"per_page": {strconv.FormatUint(perPage, 10)},
+		"order_by": {`"asc"`},
+	}
+	if err := c.rpc.Call(ctx, "tx_search", params, &res); err != nil {
+		// CometBFT rejects a page past the end instead of returning it empty
+		if page > 1 && strings.Contains(err.Error(), "page should be within") {
+			return &explorerPB.GetTxsResponse{Paging: &explorerPB.Paging{}}, nil
+		}
+		return nil, err
+	}
+
+	total, _ := strconv.ParseInt(res.TotalCount, 10, 64)
+	out := &explorerPB.GetTxsResponse{Paging: &explorerPB.Paging{Total: total}}
+	for _, rt := range res.Txs {
+		height, err := strconv.ParseUint(rt.Height, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("tx %s: bad height %q", rt.Hash, rt.Height)
+		}
+		timestamp, err := c.blockTime(ctx, height)
+		if err != nil {
+			return nil, err
+		}
+		logs, err := txLogs(rt)
+		if err != nil {
+			return nil, fmt.Errorf("tx %s: %w", rt.Hash, err)
+		}
+		out.Data = append(out.Data, &explorerPB.TxData{
+			BlockNumber:    height,
+			BlockTimestamp: timestamp,
+			Hash:           explorerHash(rt.Hash),
+			Codespace:      rt.TxResult.Codespace,
+			Code:           rt.TxResult.Code,
+			Logs:           logs,
+		})
+	}
+	return out, nil
+}
+
+// txLogs returns the per-message logs if the node kept them, or else the flat event list.
+func txLogs(rt rpcTx) ([]byte, error) {
+	var logs []struct {
+		Events []json.RawMessage `json:"events"`
+	}
+	if json.Unmarshal([]byte(rt.TxResult.Log), &logs) == nil {
+		for _, l := range logs {
+			if len(l.Events) > 0 {
+				return []byte(rt.TxResult.Log), nil
+			}
+		}
+	}
+	return json.Marshal(rt.TxResult.Events)
+}
+
+// explorerHash formats a CometBFT tx hash (upper-case hex) like the Explorer does.
+func explorerHash(hash string) string {
+	return "0x" + strings.ToLower(strings.TrimPrefix(hash, "0x"))
+}
+
+func (c *Chain) GetTxByTxHash(ctx context.Context, hash string) (*explorerPB.GetTxByTxHashResponse, error) {
+	var rt rpcTx
+	params := url.Values{"hash": {"0x" + strings.TrimPrefix(hash, "0x")}}
+	if err := c.rpc.Call(ctx, "tx", params, &rt); err != nil {
+		return nil, err
+	}
+	height, _ := strconv.ParseUint(rt.Height, 10, 64)
+	timestamp, err := c.blockTime(ctx, height)
+	if err != nil {
+		return nil, err
+	}
+
+	detail := &explorerPB.TxDetailData{
+		BlockNumber:    height,
+		BlockTimestamp: timestamp,
+		Hash:           explorerHash(rt.Hash),
+		Code:           rt.TxResult.Code,
+		Codespace:      rt.TxResult.Codespace,
+	}
+	for _, e := range rt.TxResult.Events {
+		ev := &explorerPB.Event{Type: e.Type, Attributes: make(map[string]string, len(e.Attributes))}
+		for _, a := range e.Attributes {
+			ev.Attributes[a.Key] = a.Value
+		}
+		detail.Events = append(detail.Events, ev)
+	}
+	return &explorerPB.GetTxByTxHashResponse{Data: detail}, nil
+}
+
+func (c *Chain) GetBlock(ctx context.Context, height string) (*explorerPB.GetBlockResponse, error) {
+	h, err := strconv.ParseUint(height, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("bad block height %q", height)
+	}
+	var res struct {
+		Block struct {
+			Header struct {
+				Time time.Time `json:"time"`
+			} `json:"header"`
+			Data struct {
+				Txs []string `json:"txs"`
+			} `json:"data"`
+		} `json:"block"`
+	}
+	if err := c.rpc.Call(ctx, "block", Height(h), &res); err != nil {
+		return nil, err
+	}
+	timestamp := FormatBlockTime(res.Block.Header.Time)
+	c.rememberBlockTime(h, timestamp)
+
+	return &explorerPB.GetBlockResponse{Data: &explorerPB.BlockDetailInfo{
+		Height:    h,
+		NumTxs:    int64(len(res.Block.Data.Txs)),
+		Timestamp: timestamp,
+	}}, nil
+}
+
+// GetBlocks reads a range from the blockchain method, which returns at most the 20
+// newest block metas of [minHeight..maxHeight]. An empty req returns the latest block.
+func (c *Chain) GetBlocks(ctx context.Context, req *explorerPB.GetBlocksRequest) (*explorerPB.GetBlocksResponse, error) {
+	if req.After == 0 && req.Before == 0 {
+		height, timestamp, err := c.latest(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &explorerPB.GetBlocksResponse{Data: []*explorerPB.BlockInfo{{Height: height, Timestamp: timestamp}}}, nil
+	}
+
+	params := url.Values{"minHeight": {fmt.Sprint(max(req.After, 1))}}
+	if req.Before != 0 {
+		params.Set("maxHeight", fmt.Sprint(req.Before))
+	}
+	var res struct {
+		BlockMetas []struct {
+			Header struct {
+				Height string    `json:"height"`
+				Time   time.Time `json:"time"`
+			} `json:"header"`
+			NumTxs string `json:"num_txs"`
+		} `json:"block_metas"`
+	}
+	if err := c.rpc.Call(ctx, "blockchain", params, &res); err != nil {
+		return nil, err
+	}
+
+	out := &explorerPB.GetBlocksResponse{}
+	for _, m := range res.BlockMetas {
+		if req.Limit > 0 && len(out.Data) == int(req.Limit) {
+			break
+		}
+		height, err := strconv.ParseUint(m.Header.Height, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad block height %q", m.Header.Height)
+		}
+		numTxs, err := strconv.ParseInt(m.NumTxs, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad tx count %q of block %d", m.NumTxs, height)
+		}
+		timestamp := FormatBlockTime(m.Header.Time)
+		c.rememberBlockTime(height, timestamp)
+		out.Data = append(out.Data, &explorerPB.BlockInfo{Height: height, NumTxs: numTxs, Timestamp: timestamp})
+	}
+	return out, nil
+}
+
+func (c *Chain) latest(ctx context.Context) (uint64, string, error) {
+	var res struct {
+		SyncInfo struct {
+			LatestBlockHeight string    `json:"latest_block_height"`
+			LatestBlockTime   time.Time `json:"latest_block_time"`
+		} `json:"sync_info"`
+	}
+	if err := c.rpc.Call(ctx, "status", nil, &res); err != nil {
+		return 0, "", err
+	}
+	height, err := strconv.ParseUint(res.SyncInfo.LatestBlockHeight, 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("bad latest height %q", res.SyncInfo.LatestBlockHeight)
+	}
+	return height, FormatBlockTime(res.SyncInfo.LatestBlockTime), nil
+}
+
+// StreamTxs polls the node's status and yields one (empty) tx per new block height.
+// That is all follow mode needs from the stream.
+func (c *Chain) StreamTxs(ctx context.Context) (TxStream, error) {
+	return &chainStream{ctx: ctx, chain: c}, nil
+}
+
+type chainStream struct {
+	ctx   context.Context
+	chain *Chain
+	last  uint64
+}
+
+func (s *chainStream) Recv() (*explorerPB.StreamTxsResponse, error) {
+	for {
+		height, timestamp, err := s.chain.latest(s.ctx)
+		if err != nil {
+			return nil, err
+		}
+		if height > s.last {
+			s.last = height
+			return &explorerPB.StreamTxsResponse{BlockNumber: height, BlockTimestamp: timestamp}, nil
+		}
+
+		t := time.NewTimer(chainPollInterval)
+		select {
+		case <-t.C:
+		case <-s.ctx.Done():
+			t.Stop()
+			return nil, s.ctx.Err()
+		}
+	}
+}
+
+// blockTime returns the timestamp of a block, from the header on first use.
+func (c *Chain) blockTime(ctx context.Context, height uint64) (string, error) {
+	c.mu.Lock()
+	timestamp, ok := c.blockTimes[height]
+	c.mu.Unlock()
+	if ok {
+		return timestamp, nil
+	}
+
+	var res struct {
+		Header struct {
+			Time time.Time `json:"time"`
+		} `json:"header"`
+	}
+	if err := c.rpc.Call(ctx, "header", Height(height), &res); err != nil {
+		return "", fmt.Errorf("header %d: %w", height, err)
+	}
+	timestamp = FormatBlockTime(res.Header.Time)
+	c.rememberBlockTime(height, timestamp)
+	return timestamp, nil
+}
+
+// rememberBlockTime caches a block time. Scans move forward, so the cache is simply
+// dropped when it gets large.
+func (c *Chain) rememberBlockTime(height uint64, timestamp string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.blockTimes) >= 10_000 {
+		c.blockTimes = make(map[uint64]string)
+	}
+	c.blockTimes[height] = timestamp
+}
@@ -0,0 +1,114 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	explorerPB "github.com/InjectiveLabs/sdk-go/exchange/explorer_rpc/pb"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrNotRecorded is returned by Dir for a request that has no file.
+var ErrNotRecorded = errors.New("response not recorded")
+
+// Dir serves Explorer responses stored as protobuf JSON files, for fixtures and
+// offline scans. One file per request:
+//
+//	txs/<after>-<before>-<skip>-<limit>.json   GetTxsResponse
+//	blocks/<height>.json                        GetBlockResponse
+//	blocks/<after>-<before>-<limit>.json        GetBlocksResponse (a range)
+//	tx/<hash>.json                              GetTxByTxHashResponse
+//	latest.json                                 GetBlocksResponse
+//
+// A request without a file fails with ErrNotRecorded, so a scan over a recorded
+// range must use the same chunk and page sizes as the recording. StreamTxs is not
+// supported: a directory has no new blocks.
+type Dir struct {
+	root string
+}
+
+// NewDir returns a source reading the responses under root.
+func NewDir(root string) (*Dir, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+	return &Dir{root: root}, nil
+}
+
+func txsFile(req *explorerPB.GetTxsRequest) string {
+	return filepath.Join("txs", fmt.Sprintf("%d-%d-%d-%d.json", req.After, req.Before, req.Skip, req.Limit))
+}
+
+func blockFile(height string) string {
+	return filepath.Join("blocks", filepath.Base(height)+".json")
+}
+
+func txFile(hash string) string {
+	return filepath.Join("tx", strings.ToLower(filepath.Base(hash))+".json")
+}
+
+// blocksFile is latest.json for the latest blocks, else the range's file.
+func blocksFile(req *explorerPB.GetBlocksRequest) string {
+	if req.After == 0 && req.Before == 0 {
+		return "latest.json"
+	}
+	return filepath.Join("blocks", fmt.Sprintf("%d-%d-%d.json", req.After, req.Before, req.Limit))
+}
+
+func (d *Dir) load(name string, msg proto.Message) error {
+	raw, err := os.ReadFile(filepath.Join(d.root, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%s: %w", name, ErrNotRecorded)
+	}
+	if err != nil {
+		return err
+	}
+	if err := protojson.Unmarshal(raw, msg); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", name, err)
+	}
+	return nil
+}
+
+func (d *Dir) GetTxs(ctx context.Context, req *explorerPB.GetTxsRequest) (*explorerPB.GetTxsResponse, error) {
+	res := &explorerPB.GetTxsResponse{}
+	return res, d.load(txsFile(req), res)
+}
+
+func (d *Dir) GetTxByTxHash(ctx context.Context, hash string) (*explorerPB.GetTxByTxHashResponse, error) {
+	res := &explorerPB.GetTxByTxHashResponse{}
+	return res, d.load(txFile(hash), res)
+}
+
+func (d *Dir) GetBlock(ctx context.Context, height string) (*explorerPB.GetBlockResponse, error) {
+	res := &explorerPB.GetBlockResponse{}
+	return res, d.load(blockFile(height), res)
+}
+
+func (d *Dir) GetBlocks(ctx context.Context, req *explorerPB.GetBlocksRequest) (*explorerPB.GetBlocksResponse, error) {
+	res := &explorerPB.GetBlocksResponse{}
+	return res, d.load(blocksFile(req), res)
+}
+
+// Recorded reports whether src reads or writes recorded responses (Dir, Recorder).
+// A scan over such a source must request the same windows every time, so it may
+// not size chunks from timing.
+func Recorded(src TxSource) bool {
+	switch src.(type) {
+	case *Dir, *Recorder:
+		return true
+	}
+	return false
+}
+
+func (d *Dir) StreamTxs(ctx context.Context) (TxStream, error) {
+	return nil, errors.New("a directory source cannot stream new txs")
+}
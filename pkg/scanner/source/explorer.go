@@ -0,0 +1,52 @@
+package source
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/InjectiveLabs/sdk-go/client/common"
+	explorerclient "github.com/InjectiveLabs/sdk-go/client/explorer"
+	explorerPB "github.com/InjectiveLabs/sdk-go/exchange/explorer_rpc/pb"
+)
+
+// Explorer reads from the Injective Explorer gRPC API.
+type Explorer struct {
+	client explorerclient.ExplorerClient
+	// rpc is the raw gRPC client, for requests the SDK client does not pass on
+	rpc     explorerPB.InjectiveExplorerRPCClient
+	cookies common.CookieAssistant
+}
+
+// NewExplorer connects to the Explorer of network.
+func NewExplorer(network common.Network) (*Explorer, error) {
+	client, err := explorerclient.NewExplorerClient(network)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create explorer client: %w", err)
+	}
+	return &Explorer{
+		client:  client,
+		rpc:     explorerPB.NewInjectiveExplorerRPCClient(client.QueryClient()),
+		cookies: network.ExplorerCookieAssistant,
+	}, nil
+}
+
+func (e *Explorer) GetTxs(ctx context.Context, req *explorerPB.GetTxsRequest) (*explorerPB.GetTxsResponse, error) {
+	return e.client.GetTxs(ctx, req)
+}
+
+func (e *Explorer) GetTxByTxHash(ctx context.Context, hash string) (*explorerPB.GetTxByTxHashResponse, error) {
+	return e.client.GetTxByTxHash(ctx, hash)
+}
+
+func (e *Explorer) GetBlock(ctx context.Context, height string) (*explorerPB.GetBlockResponse, error) {
+	return e.client.GetBlock(ctx, height)
+}
+
+// GetBlocks goes through the raw gRPC client: the SDK's GetBlocks drops the range.
+func (e *Explorer) GetBlocks(ctx context.Context, req *explorerPB.GetBlocksRequest) (*explorerPB.GetBlocksResponse, error) {
+	return common.ExecuteCall(ctx, e.cookies, e.rpc.GetBlocks, req)
+}
+
+func (e *Explorer) StreamTxs(ctx context.Context) (TxStream, error) {
+	return e.client.StreamTxs(ctx)
+}
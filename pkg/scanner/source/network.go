@@ -0,0 +1,63 @@
+package source
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	"github.com/InjectiveLabs/sdk-go/client/common"
+	"google.golang.org/grpc/credentials"
+)
+
+// NetworkConfig selects the Injective network and gRPC endpoints to talk to.
+// The zero value is mainnet through the public load balancer.
+type NetworkConfig struct {
+	// Name is mainnet, testnet, devnet or local (default mainnet).
+	Name string
+
+	// ExplorerEndpoint and ExchangeEndpoint replace the network's gRPC endpoints,
+	// e.g. "localhost:9911" for a local stand-in server.
+	ExplorerEndpoint string
+	ExchangeEndpoint string
+
+	// TLS is "tls" or "insecure" (plaintext) to override the network's transport
+	// for the gRPC endpoints. Empty keeps the network's default.
+	TLS string
+}
+
+// Load returns the sdk-go network described by c.
+func (c NetworkConfig) Load() (common.Network, error) {
+	name := c.Name
+	if name == "" {
+		name = "mainnet"
+	}
+	switch name {
+	case "mainnet", "testnet", "devnet", "devnet-1", "local":
+	default:
+		return common.Network{}, fmt.Errorf("unknown network %q (mainnet, testnet, devnet or local)", name)
+	}
+	network := common.LoadNetwork(name, "lb")
+
+	// The load balancer's sticky-session cookies mean nothing to another server
+	if c.ExplorerEndpoint != "" {
+		network.ExplorerGrpcEndpoint = c.ExplorerEndpoint
+		network.ExplorerCookieAssistant = &common.DisabledCookieAssistant{}
+	}
+	if c.ExchangeEndpoint != "" {
+		network.ExchangeGrpcEndpoint = c.ExchangeEndpoint
+		network.ExchangeCookieAssistant = &common.DisabledCookieAssistant{}
+	}
+
+	// sdk-go clients only use TLS when ChainTLSCert is set, and then dial with
+	// ExchangeTLSCert whatever the service, so all three move together.
+	switch c.TLS {
+	case "":
+	case "tls":
+		creds := credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+		network.ChainTLSCert, network.ExchangeTLSCert, network.ExplorerTLSCert = creds, creds, creds
+	case "insecure":
+		network.ChainTLSCert, network.ExchangeTLSCert, network.ExplorerTLSCert = nil, nil, nil
+	default:
+		return common.Network{}, fmt.Errorf("unknown TLS mode %q (tls or insecure)", c.TLS)
+	}
+	return network, nil
+}
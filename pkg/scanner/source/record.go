@@ -0,0 +1,94 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	explorerPB "github.com/InjectiveLabs/sdk-go/exchange/explorer_rpc/pb"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Recorder passes requests through to another source and saves every successful
+// response under a directory, in the layout Dir reads. Scanning with NewDir on that
+// directory later replays the exact same responses without touching the network.
+//
+// The tx stream is passed through unrecorded.
+type Recorder struct {
+	src  TxSource
+	root string
+}
+
+// NewRecorder records the responses of src under root, creating it if needed.
+func NewRecorder(src TxSource, root string) (*Recorder, error) {
+	for _, sub := range []string{"txs", "blocks", "tx"} {
+		if err := os.MkdirAll(filepath.Join(root, sub), 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &Recorder{src: src, root: root}, nil
+}
+
+// save writes msg to name atomically, so a concurrent or interrupted scan never
+// leaves a truncated response behind.
+func (r *Recorder) save(name string, msg proto.Message) error {
+	raw, err := protojson.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(r.root, name)
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".record-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to record %s: %w", name, err)
+	}
+	return nil
+}
+
+func (r *Recorder) GetTxs(ctx context.Context, req *explorerPB.GetTxsRequest) (*explorerPB.GetTxsResponse, error) {
+	res, err := r.src.GetTxs(ctx, req)
+	if err != nil {
+		return res, err
+	}
+	return res, r.save(txsFile(req), res)
+}
+
+func (r *Recorder) GetTxByTxHash(ctx context.Context, hash string) (*explorerPB.GetTxByTxHashResponse, error) {
+	res, err := r.src.GetTxByTxHash(ctx, hash)
+	if err != nil {
+		return res, err
+	}
+	return res, r.save(txFile(hash), res)
+}
+
+func (r *Recorder) GetBlock(ctx context.Context, height string) (*explorerPB.GetBlockResponse, error) {
+	res, err := r.src.GetBlock(ctx, height)
+	if err != nil {
+		return res, err
+	}
+	return res, r.save(blockFile(height), res)
+}
+
+func (r *Recorder) GetBlocks(ctx context.Context, req *explorerPB.GetBlocksRequest) (*explorerPB.GetBlocksResponse, error) {
+	res, err := r.src.GetBlocks(ctx, req)
+	if err != nil {
+		return res, err
+	}
+	return res, r.save(blocksFile(req), res)
+}
+
+func (r *Recorder) StreamTxs(ctx context.Context) (TxStream, error) {
+	return r.src.StreamTxs(ctx)
+}
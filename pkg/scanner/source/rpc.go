@@ -0,0 +1,84 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/retry"
+)
+
+// RPC is a minimal client for a CometBFT node's JSON-RPC over HTTP (port 26657).
+type RPC struct {
+	endpoint string
+	http     *http.Client
+
+	// Retry is how failed calls are retried; its Limiter paces every request.
+	// JSON-RPC errors from the node are not retried.
+	Retry retry.Policy
+}
+
+// NewRPC returns a client for the CometBFT RPC at endpoint, e.g. "http://localhost:26657",
+// retrying and pacing calls as policy says. Pass the scan's policy so its limiter
+// covers these calls too.
+func NewRPC(endpoint string, policy retry.Policy) *RPC {
+	return &RPC{
+		endpoint: strings.TrimRight(endpoint, "/"),
+		http:     &http.Client{Timeout: 30 * time.Second},
+		Retry:    policy,
+	}
+}
+
+// Call calls method with params and decodes its result into out, retrying
+// transient errors as r.Retry allows.
+func (r *RPC) Call(ctx context.Context, method string, params url.Values, out interface{}) error {
+	u := r.endpoint + "/" + method
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+
+	_, err := retry.Do(ctx, r.Retry, method, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, r.get(ctx, u, out)
+	})
+	return err
+}
+
+func (r *RPC) get(ctx context.Context, u string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+			Data    string `json:"data"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		if resp.StatusCode/100 != 2 {
+			return &retry.HTTPError{StatusCode: resp.StatusCode, Err: err}
+		}
+		return fmt.Errorf("HTTP %d: %w", resp.StatusCode, err)
+	}
+	if body.Error != nil {
+		return fmt.Errorf("rpc error %d: %s %s", body.Error.Code, body.Error.Message, body.Error.Data)
+	}
+	return json.Unmarshal(body.Result, out)
+}
+
+// Height returns the params for a method taking a block height.
+func Height(height uint64) url.Values {
+	return url.Values{"height": {fmt.Sprint(height)}}
+}
@@ -0,0 +1,67 @@
+// Package source provides the transactions the scanner reads: from the Injective
+// Explorer API, from a CometBFT RPC node, or from a directory of recorded responses.
+package source
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/InjectiveLabs/sdk-go/client/common"
+	explorerPB "github.com/InjectiveLabs/sdk-go/exchange/explorer_rpc/pb"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/retry"
+)
+
+// TxSource is where the scanner gets transactions and blocks from. It speaks the
+// Explorer's request/response types, so the Explorer client is the reference
+// implementation and the others translate to it.
+type TxSource interface {
+	// GetTxs returns one page of the txs in [req.After..req.Before].
+	GetTxs(ctx context.Context, req *explorerPB.GetTxsRequest) (*explorerPB.GetTxsResponse, error)
+	// GetTxByTxHash returns a single tx with its flat event list.
+	GetTxByTxHash(ctx context.Context, hash string) (*explorerPB.GetTxByTxHashResponse, error)
+	// GetBlock returns a block's tx count and timestamp.
+	GetBlock(ctx context.Context, height string) (*explorerPB.GetBlockResponse, error)
+	// GetBlocks returns up to req.Limit blocks in [req.After..req.Before], newest
+	// first, with their tx counts. An empty req returns the latest blocks, which is
+	// how the chain head is found.
+	GetBlocks(ctx context.Context, req *explorerPB.GetBlocksRequest) (*explorerPB.GetBlocksResponse, error)
+	// StreamTxs streams new txs, used as a new-block signal by follow mode.
+	StreamTxs(ctx context.Context) (TxStream, error)
+}
+
+// TxStream is a stream of new txs. Recv blocks until the next one.
+type TxStream interface {
+	Recv() (*explorerPB.StreamTxsResponse, error)
+}
+
+// blockTimeLayout is how the Explorer formats block timestamps.
+const blockTimeLayout = "2006-01-02 15:04:05.999 -0700 MST"
+
+// FormatBlockTime formats t like the Explorer's block timestamps, so records
+// look the same whichever source they came from.
+func FormatBlockTime(t time.Time) string {
+	return t.UTC().Format(blockTimeLayout)
+}
+
+// Open returns the source called kind: "explorer" (network's Explorer), "chain"
+// (CometBFT RPC at node, default the network's) or "dir" (responses under dir).
+// policy is the scan's retry policy, whose limiter the chain source shares.
+func Open(kind string, network common.Network, node, dir string, policy retry.Policy) (TxSource, error) {
+	switch kind {
+	case "", "explorer":
+		return NewExplorer(network)
+	case "chain":
+		if node == "" {
+			node = network.TmEndpoint
+		}
+		return NewChain(node, policy), nil
+	case "dir":
+		if dir == "" {
+			return nil, fmt.Errorf("the dir source needs a directory")
+		}
+		return NewDir(dir)
+	}
+	return nil, fmt.Errorf("unknown source %q (explorer, chain or dir)", kind)
+}
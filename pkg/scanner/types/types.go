@@ -3,8 +3,12 @@ package types
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/retry"
+	"github.com/kprimice/challenge-week/pkg/scanner/source"
 )
 
 // Config is reused in scanner.go
@@ -12,30 +16,152 @@ type Config struct {
 	MarketID   string
 	StartBlock uint64
 	EndBlock   uint64
+
+	// Network selects the network and endpoints (default mainnet). It gives the
+	// Explorer used when Source is nil and the default TmEndpoint.
+	Network source.NetworkConfig
+
+	// Source is where txs are read from (default: the Network's Explorer).
+	Source source.TxSource
+	// Retry is how failed calls to the Source and to CometBFT are retried.
+	Retry retry.Policy
+
+	// Concurrency is how many block chunks are fetched in parallel (default 1).
+	// Output is still written in block order.
+	Concurrency int
+
+	// ChunkBlocks is the number of blocks per chunk (default 100). With ChunkTxs
+	// set it is only the size of the first chunks.
+	ChunkBlocks uint64
+	// ChunkTxs (optional) turns on adaptive chunk sizing: each new chunk is sized
+	// from the tx density and fetch time of the chunks before it, aiming at about
+	// ChunkTxs txs and at most ChunkLatency (default 30s) per chunk, within
+	// [MinChunkBlocks..MaxChunkBlocks] (default 1..100000). It is ignored with a
+	// recording or recorded Source, whose windows must not depend on timing.
+	ChunkTxs       int
+	ChunkLatency   time.Duration
+	MinChunkBlocks uint64
+	MaxChunkBlocks uint64
+
+	// CheckpointPath is where progress is saved after every written chunk (optional).
+	CheckpointPath string
+	// Resume continues from CheckpointPath, appending to the existing output files.
+	Resume bool
+
+	// LedgerPath is the JSONL file where failed chunks are recorded for re-driving.
+	LedgerPath string
+
+	// Verify compares the txs fetched per block with the block's tx count from the Explorer.
+	Verify bool
+	// RefetchMismatched re-fetches a block that failed verification before giving up on it.
+	RefetchMismatched bool
+
+	// BlockEvents also reads each block's BeginBlock/EndBlock events from CometBFT's
+	// block_results, where the exchange module emits fills of resting limit orders
+	// matched in its EndBlocker. One extra RPC call per block.
+	BlockEvents bool
+	// TmEndpoint is the CometBFT RPC used for BlockEvents (default: the network's).
+	TmEndpoint string
+
+	// Follow backfills up to the block below the chain head (EndBlock is ignored), then
+	// keeps tailing new blocks, from the head on, as the Explorer tx stream signals them.
+	Follow bool
+
+	// ArchiveDir (optional) is where the raw txs of every written chunk are kept, so
+	// the parsers can be run again over them with RunReparse.
+	ArchiveDir string
+
+	// MarketType keeps the records of derivative markets (MarketDerivative, the
+	// default), of spot markets (MarketSpot) or of both ("all").
+	MarketType string
+}
+
+// Market types of a CSVRecord.
+const (
+	MarketDerivative = "derivative"
+	MarketSpot       = "spot"
+)
+
+// KeepMarketType reports whether a record of market type t passes the filter
+// (a Config.MarketType value).
+func KeepMarketType(filter, t string) bool {
+	switch filter {
+	case "all":
+		return true
+	case "":
+		return t == MarketDerivative
+	}
+	return t == filter
+}
+
+// CheckMarketType validates a Config.MarketType value.
+func CheckMarketType(filter string) error {
+	switch filter {
+	case "", MarketDerivative, MarketSpot, "all":
+		return nil
+	}
+	return fmt.Errorf("unknown market type %q (derivative, spot or all)", filter)
 }
 
 // CSVRecord is a single row in the CSV output. Each parse function returns one or more CSVRecords.
+// The json tags are used by the JSONL output, which keeps every field.
 type CSVRecord struct {
-	TxHash         string
-	Block          uint64
-	BlockTimestamp string
-	Action         string
-	MarketID       string
-	Price          string
-	Quantity       string
-	OrderType      string
-	SubaccountID   string
-	Margin         string
-	ExecPrice      string
-	ExecQuantity   string
-	ExecFee        string
-	OrderHash      string
+	TxHash         string `json:"tx_hash"`
+	Block          uint64 `json:"block"`
+	BlockTimestamp string `json:"block_timestamp"`
+	Action         string `json:"action"`
+	MarketID       string `json:"market_id"`
+	Price          string `json:"price"`
+	Quantity       string `json:"quantity"`
+	OrderType      string `json:"order_type"`
+	SubaccountID   string `json:"subaccount_id"`
+	Margin         string `json:"margin"`
+	ExecPrice      string `json:"exec_price"`
+	ExecQuantity   string `json:"exec_quantity"`
+	ExecFee        string `json:"exec_fee"`
+	OrderHash      string `json:"order_hash"`
+	Cid            string `json:"cid"`
+
+	// Fields for derivative executions. ExecMargin is the margin the fill adds to
+	// the position.
+	IsBuy         bool   `json:"is_buy"`
+	IsLiquidation bool   `json:"is_liquidation"`
+	Pnl           string `json:"pnl"`
+	Payout        string `json:"payout"`
+	ExecMargin    string `json:"exec_margin,omitempty"`
+
+	// MarketType is MarketDerivative or MarketSpot. For spot records QuoteAmount is
+	// price * quantity in the quote denom (Quantity / ExecQuantity being the base
+	// amount), and ExecFee is paid in the quote denom too.
+	MarketType  string `json:"market_type"`
+	QuoteAmount string `json:"quote_amount,omitempty"`
+
+	// Fields for conditional (stop / take-profit) orders: CONDITIONAL_NEW,
+	// CONDITIONAL_CANCEL and CONDITIONAL_TRIGGER. On a trigger OrderHash is the
+	// conditional order and PlacedOrderHash the order it created, whose fills carry
+	// that hash.
+	TriggerPrice    string `json:"trigger_price,omitempty"`
+	IsMarket        bool   `json:"is_market,omitempty"`
+	PlacedOrderHash string `json:"placed_order_hash,omitempty"`
 
-	// Fields for derivative executions
-	IsBuy         bool
-	IsLiquidation bool
-	Pnl           string
-	Payout        string
+	// Fields for FUNDING records (EventPerpetualMarketFundingUpdate, in the
+	// BeginBlocker). CumulativeFunding is the market's running total: a position
+	// pays quantity * its change (longs pay when it rises, shorts receive).
+	// FundingRate and MarkPrice are only set on hourly updates.
+	CumulativeFunding string `json:"cumulative_funding,omitempty"`
+	FundingRate       string `json:"funding_rate,omitempty"`
+	MarkPrice         string `json:"mark_price,omitempty"`
+	IsHourlyFunding   bool   `json:"is_hourly_funding,omitempty"`
+
+	// MsgIndex is the message of the tx that emitted the source event (-1 for block
+	// events), EventIndex the position of that event among the exchange events of the
+	// message, and ItemIndex the position of the record within the event (e.g. one of
+	// its trades). Other events are not counted, since the per-message logs leave out
+	// the ante/fee events that the flat event list has. With TxHash they identify a
+	// record across re-scans, whichever source it was read from.
+	MsgIndex   int `json:"msg_index"`
+	EventIndex int `json:"event_index"`
+	ItemIndex  int `json:"item_index"`
 }
 
 func (r CSVRecord) AsOrderRow() []string {
@@ -70,17 +196,181 @@ func (r CSVRecord) AsTradeRow() []string {
 		trimTrailingZeros(r.Payout),
 		r.SubaccountID,
 		r.MarketID,
+		trimTrailingZeros(r.ExecMargin),
 		// parseBlockTime(r.BlockTimestamp),
 		// r.TxHash,
 	}
 }
 
-func parseBlockTime(raw string) string {
+// AsSpotOrderRow is the spot orders CSV row (see sink.SpotOrdersHeader).
+func (r CSVRecord) AsSpotOrderRow() []string {
+	return []string{
+		r.OrderHash,
+		uint64ToStr(r.Block),
+		r.Action,
+		trimTrailingZeros(r.Price),
+		trimTrailingZeros(r.Quantity),
+		trimTrailingZeros(r.QuoteAmount),
+		r.OrderType,
+		r.SubaccountID,
+		r.MarketID,
+	}
+}
+
+// AsSpotTradeRow is the spot trades CSV row (see sink.SpotTradesHeader).
+func (r CSVRecord) AsSpotTradeRow() []string {
+	return []string{
+		r.OrderHash,
+		uint64ToStr(r.Block),
+		r.Action,
+		trimTrailingZeros(r.ExecPrice),
+		trimTrailingZeros(r.ExecQuantity),
+		trimTrailingZeros(r.QuoteAmount),
+		trimTrailingZeros(r.ExecFee),
+		boolToStr(r.IsBuy),
+		r.SubaccountID,
+		r.MarketID,
+	}
+}
+
+// AsConditionalRow is the conditional orders CSV row (see sink.ConditionalOrdersHeader).
+func (r CSVRecord) AsConditionalRow() []string {
+	return []string{
+		r.OrderHash,
+		uint64ToStr(r.Block),
+		r.Action,
+		trimTrailingZeros(r.TriggerPrice),
+		trimTrailingZeros(r.Price),
+		trimTrailingZeros(r.Quantity),
+		trimTrailingZeros(r.Margin),
+		r.OrderType,
+		boolToStr(r.IsMarket),
+		r.PlacedOrderHash,
+		r.SubaccountID,
+		r.MarketID,
+	}
+}
+
+// AsFundingRow is the funding CSV row (see sink.FundingHeader).
+func (r CSVRecord) AsFundingRow() []string {
+	return []string{
+		r.MarketID,
+		uint64ToStr(r.Block),
+		parseBlockTime(r.BlockTimestamp),
+		trimTrailingZeros(r.CumulativeFunding),
+		trimTrailingZeros(r.FundingRate),
+		trimTrailingZeros(r.MarkPrice),
+		boolToStr(r.IsHourlyFunding),
+	}
+}
+
+// FundingPayment is what one position paid or received at one funding update,
+// derived by funding.Ledger. Amounts are in the quote denom.
+type FundingPayment struct {
+	Block             uint64
+	BlockTimestamp    string
+	MarketID          string
+	SubaccountID      string
+	Quantity          string // signed position size: > 0 long, < 0 short
+	CumulativeFunding string
+	FundingDelta      string // change of CumulativeFunding since the previous update
+	Payment           string // > 0 received, < 0 paid
+}
+
+func (p FundingPayment) AsRow() []string {
+	return []string{
+		p.SubaccountID,
+		p.MarketID,
+		uint64ToStr(p.Block),
+		parseBlockTime(p.BlockTimestamp),
+		trimTrailingZeros(p.Quantity),
+		trimTrailingZeros(p.CumulativeFunding),
+		trimTrailingZeros(p.FundingDelta),
+		trimTrailingZeros(p.Payment),
+	}
+}
+
+// PositionSnapshot is the state of one position at the end of a block, written by
+// position.Tracker. Change says what happened to it in the block: OPEN, INCREASE,
+// REDUCE, CLOSE, FLIP, LIQUIDATION (reduced or closed by a liquidation), TRADE
+// (traded both ways, same size after) or FUNDING (funding only); END rows are the
+// open positions left when the input ends.
+type PositionSnapshot struct {
+	Block          uint64
+	BlockTimestamp string
+	SubaccountID   string
+	MarketID       string
+	Change         string
+	Quantity       string // signed: > 0 long, < 0 short
+	EntryPrice     string
+	Margin         string
+	RealizedPnl    string
+	Funding        string
+	Liquidations   int
+}
+
+func (p PositionSnapshot) AsRow() []string {
+	return []string{
+		p.SubaccountID,
+		p.MarketID,
+		uint64ToStr(p.Block),
+		parseBlockTime(p.BlockTimestamp),
+		p.Change,
+		trimTrailingZeros(p.Quantity),
+		trimTrailingZeros(p.EntryPrice),
+		trimTrailingZeros(p.Margin),
+		trimTrailingZeros(p.RealizedPnl),
+		trimTrailingZeros(p.Funding),
+		strconv.Itoa(p.Liquidations),
+	}
+}
+
+// DerivativeTradeRecord is one trade downloaded from the exchange API by RunDerivativeTrades.
+type DerivativeTradeRecord struct {
+	TradeID        string
+	MarketID       string
+	OrderHash      string // base64, like the logs
+	SubaccountID   string
+	ExecPrice      string
+	ExecQuantity   string
+	TradeDirection string // "buy" / "sell"
+	Fee            string
+	IsLiquidation  bool
+	ExecutionSide  string // "maker"/"taker"
+	ExecutedAt     int64  // UNIX millis
+}
+
+func (r DerivativeTradeRecord) AsRow() []string {
+	var timestamp string
+	if r.ExecutedAt > 0 {
+		timestamp = time.UnixMilli(r.ExecutedAt).UTC().Format(time.RFC3339Nano)
+	}
+	return []string{
+		r.TradeID,
+		r.MarketID,
+		r.OrderHash,
+		r.SubaccountID,
+		r.ExecPrice,
+		r.ExecQuantity,
+		r.TradeDirection,
+		r.Fee,
+		boolToStr(r.IsLiquidation),
+		r.ExecutionSide,
+		timestamp,
+	}
+}
+
+// ParseBlockTime parses a block timestamp as returned by the Explorer.
+func ParseBlockTime(raw string) (time.Time, error) {
 	// The Explorer often returns times like: "2024-12-27 17:03:37.467 +0000 UTC"
 	// which matches the Go layout: "2006-01-02 15:04:05.999999999 -0700 MST"
 
 	layout := "2006-01-02 15:04:05.999999999 -0700 MST"
-	t, err := time.Parse(layout, strings.TrimSpace(raw))
+	return time.Parse(layout, strings.TrimSpace(raw))
+}
+
+func parseBlockTime(raw string) string {
+	t, err := ParseBlockTime(raw)
 	if err != nil {
 		// Fallback: just return raw string if parse fails
 		return raw
@@ -120,6 +410,15 @@ type TxLog struct {
 	} `json:"events"`
 }
 
+// TxEvent is one event of a tx, whichever representation it was read from: the
+// per-message logs (SDK < 0.50) or the tx's flat event list (SDK 0.50+).
+// MsgIndex is -1 for tx-level events such as fees.
+type TxEvent struct {
+	MsgIndex   int              `json:"msg_index"`
+	Type       string           `json:"type"`
+	Attributes []EventAttribute `json:"attributes"`
+}
+
 type EventAttribute struct {
 	Key   string `json:"key"`
 	Value string `json:"value"`
@@ -164,6 +463,17 @@ type MsgBatchUpdateOrders struct {
 	} `json:"derivative_orders_to_cancel"`
 }
 
+// BatchSpotTrade is one trade of an EventBatchSpotExecution
+type BatchSpotTrade struct {
+	Quantity     string `json:"quantity"`
+	Price        string `json:"price"`
+	SubaccountId string `json:"subaccount_id"`
+	Fee          string `json:"fee"`
+	OrderHash    string `json:"order_hash"`
+	FeeRecipient string `json:"fee_recipient_address"`
+	Cid          string `json:"cid"`
+}
+
 type BatchDerivativeTrade struct {
 	SubaccountId string `json:"subaccount_id"`
 	OrderHash    string `json:"order_hash"`
@@ -0,0 +1,177 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	explorerPB "github.com/InjectiveLabs/sdk-go/exchange/explorer_rpc/pb"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/archive"
+	"github.com/kprimice/challenge-week/pkg/scanner/retry"
+	"github.com/kprimice/challenge-week/pkg/scanner/source"
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+// BlockMismatch is a block where the number of txs we fetched differs from
+// the tx count the Explorer reports for that block.
+type BlockMismatch struct {
+	Block    uint64
+	Expected int
+	Fetched  int
+}
+
+// blocksPageSize is how many blocks one GetBlocks call asks for when verifying.
+const blocksPageSize = 100
+
+// verifyChunk checks every block of res.job against its tx count, read for the whole
+// chunk with GetBlocks (see blockTxCounts).
+//
+// Mismatched blocks are re-fetched on their own when cfg.RefetchMismatched is set.
+// Blocks that still do not match have their records and txs removed from res, so it
+// only covers verified blocks, and are reported in res.mismatches.
+// An error means the counts could not be checked at all.
+func verifyChunk(
+	ctx context.Context,
+	client source.TxSource,
+	cfg types.Config,
+	res *chunkResult,
+) error {
+	counts, err := blockTxCounts(ctx, client, res.job.low, res.job.high, cfg.Retry)
+	if err != nil {
+		return fmt.Errorf("verify blocks %d..%d: %w", res.job.low, res.job.high, err)
+	}
+
+	for block := res.job.low; block <= res.job.high; block++ {
+		expected := counts[block]
+		fetched := res.stats.blockTxs[block]
+		if fetched == expected {
+			continue
+		}
+
+		log.Printf("Block %d incomplete: fetched %d of %d txs", block, fetched, expected)
+
+		// 1) Try the block on its own; paging a single block is far less likely to shift
+		var refetched chunkResult
+		if cfg.RefetchMismatched {
+			refetched = fetchChunk(ctx, client, chunkJob{low: block, high: block}, cfg)
+			if refetched.err == nil {
+				fetched = refetched.stats.blockTxs[block]
+			} else {
+				log.Printf("Re-fetch of block %d failed: %v", block, refetched.err)
+			}
+		}
+
+		// 2) Swap in the re-fetched block, or drop it if it is still short
+		res.records = withoutBlock(res.records, block)
+		res.txs = withoutBlockTxs(res.txs, block)
+		if fetched == expected {
+			log.Printf("Block %d complete after re-fetch (%d txs)", block, fetched)
+			res.records = append(res.records, refetched.records...)
+			res.txs = append(res.txs, refetched.txs...)
+			sortByBlock(res)
+		} else {
+			res.mismatches = append(res.mismatches, BlockMismatch{Block: block, Expected: expected, Fetched: fetched})
+		}
+	}
+
+	return nil
+}
+
+// blockTxCounts returns the tx count of every block in [low..high]. It pages the
+// range with GetBlocks, newest first, asking one block past each end in case the
+// source treats the bounds as exclusive. Blocks the pages leave out are looked up
+// one at a time with GetBlock.
+func blockTxCounts(ctx context.Context, client source.TxSource, low, high uint64, policy retry.Policy) (map[uint64]int, error) {
+	counts := make(map[uint64]int, high-low+1)
+
+	// 1) Whole pages of blocks
+	for before := high; before >= low; {
+		req := &explorerPB.GetBlocksRequest{After: max(low, 1) - 1, Before: before + 1, Limit: blocksPageSize}
+		res, err := GetBlocksWithRetry(ctx, client, req, policy)
+		if err != nil {
+			return nil, err
+		}
+		oldest := before + 1
+		for _, b := range res.Data {
+			if b.Height < low || b.Height > before {
+				continue
+			}
+			counts[b.Height] = int(b.NumTxs)
+			oldest = min(oldest, b.Height)
+		}
+		// Nothing new in range: leave the rest to GetBlock
+		if oldest > before || oldest == low {
+			break
+		}
+		before = oldest - 1
+	}
+
+	// 2) Single blocks the pages missed
+	for block := low; block <= high; block++ {
+		if _, ok := counts[block]; ok {
+			continue
+		}
+		count, err := blockTxCount(ctx, client, block, policy)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %w", block, err)
+		}
+		counts[block] = count
+	}
+	return counts, nil
+}
+
+// blockTxCount returns the number of txs the source has for a block.
+func blockTxCount(ctx context.Context, client source.TxSource, block uint64, policy retry.Policy) (int, error) {
+	res, err := GetBlockWithRetry(ctx, client, strconv.FormatUint(block, 10), policy)
+	if err != nil {
+		return 0, err
+	}
+	if res.Data == nil {
+		return 0, fmt.Errorf("no data for block %d (%s)", block, res.Errmsg)
+	}
+	return int(res.Data.NumTxs), nil
+}
+
+func withoutBlock(records []types.CSVRecord, block uint64) []types.CSVRecord {
+	kept := records[:0]
+	for _, rec := range records {
+		if rec.Block != block {
+			kept = append(kept, rec)
+		}
+	}
+	return kept
+}
+
+func withoutBlockTxs(txs []archive.Tx, block uint64) []archive.Tx {
+	kept := txs[:0]
+	for _, tx := range txs {
+		if tx.Block != block {
+			kept = append(kept, tx)
+		}
+	}
+	return kept
+}
+
+// recordMismatch writes a block that failed verification to the ledger.
+func recordMismatch(ledger *Ledger, m BlockMismatch) error {
+	if ledger == nil {
+		return fmt.Errorf("block %d is incomplete (%d of %d txs) and no ledger is configured",
+			m.Block, m.Fetched, m.Expected)
+	}
+	return ledger.Record(m.asFailedChunk())
+}
+
+func (m BlockMismatch) asFailedChunk() FailedChunk {
+	return FailedChunk{
+		Low:         m.Block,
+		High:        m.Block,
+		Partial:     m.Fetched > 0,
+		TxsFetched:  m.Fetched,
+		ExpectedTxs: m.Expected,
+		Error:       fmt.Sprintf("incomplete: fetched %d of %d txs", m.Fetched, m.Expected),
+		FailedAt:    time.Now().UTC(),
+	}
+}
@@ -0,0 +1,99 @@
+package scanner
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/kprimice/challenge-week/pkg/scanner/types"
+)
+
+func TestVerifyChunk(t *testing.T) {
+	// 2 txs in each of blocks [1..250]: 3 pages of GetBlocks
+	tests := []struct {
+		name     string
+		refetch  bool
+		hidden   []string
+		blockTxs map[uint64]int
+		unlisted map[uint64]bool
+
+		wantMismatches  []BlockMismatch
+		wantTxs         int
+		wantBlockCalls  int
+		wantBlocksCalls int
+	}{
+		{name: "all blocks match", wantTxs: 500, wantBlocksCalls: 3},
+		{
+			name:            "short block dropped",
+			hidden:          []string{"0x7-1"},
+			wantMismatches:  []BlockMismatch{{Block: 7, Expected: 2, Fetched: 1}},
+			wantTxs:         498,
+			wantBlocksCalls: 3,
+		},
+		{
+			name:            "short block complete after re-fetch",
+			refetch:         true,
+			hidden:          []string{"0x7-1", "0x180-0"},
+			wantTxs:         500,
+			wantBlocksCalls: 3,
+		},
+		{
+			name:            "block still short after re-fetch",
+			refetch:         true,
+			blockTxs:        map[uint64]int{9: 3},
+			wantMismatches:  []BlockMismatch{{Block: 9, Expected: 3, Fetched: 2}},
+			wantTxs:         498,
+			wantBlocksCalls: 3,
+		},
+		{
+			name:            "blocks missing from the range looked up alone",
+			unlisted:        map[uint64]bool{1: true, 120: true},
+			wantTxs:         500,
+			wantBlockCalls:  2,
+			wantBlocksCalls: 4, // an empty page past block 2 ends the range
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeSource(1, 250, 2)
+			client.hidden = map[string]bool{}
+			for _, hash := range tt.hidden {
+				client.hidden[hash] = true
+			}
+			client.blockTxs = tt.blockTxs
+			client.unlisted = tt.unlisted
+
+			cfg := types.Config{Verify: true, RefetchMismatched: tt.refetch}
+			res := fetchChunk(context.Background(), client, chunkJob{low: 1, high: 250}, cfg)
+			if res.err != nil {
+				t.Fatalf("fetchChunk: %v", res.err)
+			}
+			if err := verifyChunk(context.Background(), client, cfg, &res); err != nil {
+				t.Fatalf("verifyChunk: %v", err)
+			}
+
+			if !reflect.DeepEqual(res.mismatches, tt.wantMismatches) {
+				t.Errorf("mismatches = %+v, want %+v", res.mismatches, tt.wantMismatches)
+			}
+			if len(res.txs) != tt.wantTxs {
+				t.Errorf("got %d txs, want %d", len(res.txs), tt.wantTxs)
+			}
+			for i, tx := range res.txs {
+				if i > 0 && tx.Block < res.txs[i-1].Block {
+					t.Fatalf("txs out of block order at %d: %d after %d", i, tx.Block, res.txs[i-1].Block)
+				}
+				for _, m := range tt.wantMismatches {
+					if tx.Block == m.Block {
+						t.Errorf("tx %s of mismatched block %d kept", tx.Hash, m.Block)
+					}
+				}
+			}
+			if client.blockCalls != tt.wantBlockCalls {
+				t.Errorf("%d GetBlock calls, want %d", client.blockCalls, tt.wantBlockCalls)
+			}
+			if client.blocksCalls != tt.wantBlocksCalls {
+				t.Errorf("%d GetBlocks calls, want %d", client.blocksCalls, tt.wantBlocksCalls)
+			}
+		})
+	}
+}